@@ -18,6 +18,12 @@ type AttributesChange struct {
 
 func (ac *AttributesChange) ProcessChange(root *fileref.Ref) (err error) {
 
+	if ac.Path == "/" {
+		root.Attributes = ac.Attributes
+		root.CalculateHash()
+		return
+	}
+
 	var (
 		path, _   = filepath.Split(ac.Path)
 		tSubDirs  = getSubDirs(path)
@@ -49,7 +55,16 @@ func (ac *AttributesChange) ProcessChange(root *fileref.Ref) (err error) {
 		file *fileref.FileRef
 	)
 	for i, child := range dirRef.Children {
-		if child.GetType() == fileref.FILE && child.GetPath() == ac.Path {
+		if child.GetPath() != ac.Path {
+			continue
+		}
+		if child.GetType() == fileref.DIRECTORY {
+			// the attributes of a directory are inherited by its new children
+			child.(*fileref.Ref).Attributes = ac.Attributes
+			root.CalculateHash()
+			return
+		}
+		if child.GetType() == fileref.FILE {
 			file = child.(*fileref.FileRef)
 			idx = i
 			break
@@ -13,6 +13,7 @@ const (
 	RENAME_OPERATION       = "rename"
 	COPY_OPERATION         = "copy"
 	UPDATE_ATTRS_OPERATION = "update_attrs"
+	UPDATE_META_OPERATION  = "update_custom_meta" // not committed by the released blobbers yet
 )
 
 type change struct {
@@ -0,0 +1,65 @@
+package allocationchange
+
+import (
+	"path/filepath"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+)
+
+type CustomMetaChange struct {
+	change
+
+	ConnectionID string `json:"connection_id"`
+	AllocationID string `json:"allocation_id"`
+	Path         string `json:"path"`
+	CustomMeta   string `json:"custom_meta"` // new custom meta (JSON)
+}
+
+func (mc *CustomMetaChange) ProcessChange(root *fileref.Ref) (err error) {
+
+	var (
+		path, _   = filepath.Split(mc.Path)
+		tSubDirs  = getSubDirs(path)
+		dirRef    = root
+		treelevel int
+	)
+
+	for treelevel < len(tSubDirs) {
+		var found bool
+		for _, child := range dirRef.Children {
+			if child.GetType() == fileref.DIRECTORY && treelevel < len(tSubDirs) {
+				if (child.(*fileref.Ref)).Name == tSubDirs[treelevel] {
+					dirRef = child.(*fileref.Ref)
+					found = true
+					break
+				}
+			}
+		}
+		if found {
+			treelevel++
+		} else {
+			return errors.New("custom_meta_change_process",
+				"Invalid reference path from the blobber")
+		}
+	}
+
+	for _, child := range dirRef.Children {
+		if child.GetType() == fileref.FILE && child.GetPath() == mc.Path {
+			child.(*fileref.FileRef).CustomMeta = mc.CustomMeta
+			root.CalculateHash()
+			return
+		}
+	}
+
+	return errors.New("custom_meta_change_process",
+		"File, to update custom meta for, not found in blobber")
+}
+
+func (mc *CustomMetaChange) GetAffectedPath() string {
+	return mc.Path
+}
+
+func (mc *CustomMetaChange) GetSize() int64 {
+	return int64(0)
+}
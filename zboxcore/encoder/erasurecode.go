@@ -16,6 +16,9 @@ type codec interface {
 	Decode(in [][]byte) ([]byte, error)
 }
 
+// ErrCorrupted is returned by Decode when the shards don't verify.
+var ErrCorrupted = errors.New("Shards don't match, data corrupted")
+
 type StreamEncoder struct {
 	iDataShards   int
 	iParityShards int
@@ -63,11 +66,15 @@ func (e *StreamEncoder) Decode(in [][]byte, shardSize int) ([]byte, error) {
 		Logger.Error("Reconstruct failed -", err)
 		return []byte{}, err
 	}
-	_, err = e.erasureCode.Verify(in)
+	ok, err := e.erasureCode.Verify(in)
 	if err != nil {
 		Logger.Error("Verification failed after reconstruction, data likely corrupted.", err.Error())
 		return []byte{}, err
 	}
+	if !ok {
+		Logger.Error("Verification failed after reconstruction, data likely corrupted.")
+		return []byte{}, ErrCorrupted
+	}
 
 	var bytesBuf bytes.Buffer
 	bufWriter := bufio.NewWriter(&bytesBuf)
@@ -3,9 +3,11 @@ package fileref
 import (
 	"encoding/json"
 	"math"
+	"mime"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/0chain/errors"
 	"github.com/0chain/gosdk/core/common"
@@ -38,6 +40,21 @@ type Attributes struct {
 	// blobbers to be trusted.
 	WhoPaysForReads common.WhoPays `json:"who_pays_for_reads,omitempty"`
 
+	// The ContentType overrides the mime type detected on upload.
+	ContentType string `json:"content_type,omitempty"`
+	// The ContentDisposition is the Content-Disposition header value the
+	// file should be served with, e.g. attachment; filename="a.txt".
+	ContentDisposition string `json:"content_disposition,omitempty"`
+
+	// The ExpiresAt is the time the file expires at, zero for no expiry.
+	// It's enforced by the clients, an expired file can't be downloaded.
+	ExpiresAt common.Timestamp `json:"expires_at,omitempty"`
+
+	// The Locked marks the file read-only. It's enforced by the clients, a
+	// locked file can't be updated, renamed, moved or deleted till it's
+	// unlocked with new attributes.
+	Locked bool `json:"locked,omitempty"`
+
 	// add more file / directory attributes by needs with
 	// 'omitempty' json tag to avoid hash difference for
 	// equal values
@@ -48,11 +65,34 @@ func (a *Attributes) IsZero() bool {
 	return (*a) == (Attributes{})
 }
 
+// SetTTL sets the expiry of the Attributes to the ttl from now.
+func (a *Attributes) SetTTL(ttl time.Duration) {
+	a.ExpiresAt = common.Now() + common.Timestamp(ttl/time.Second)
+}
+
+// IsExpired returns true, if the Attributes expires at or before the now.
+func (a *Attributes) IsExpired(now common.Timestamp) bool {
+	return a.ExpiresAt > 0 && a.ExpiresAt <= now
+}
+
 // Validate the Attributes.
 func (a *Attributes) Validate() (err error) {
 	if err = a.WhoPaysForReads.Validate(); err != nil {
 		return errors.Wrap(err, "invalid who_pays_for_reads field")
 	}
+	if len(a.ContentType) > 0 {
+		if _, _, err = mime.ParseMediaType(a.ContentType); err != nil {
+			return errors.Wrap(err, "invalid content_type field")
+		}
+	}
+	if len(a.ContentDisposition) > 0 {
+		if _, _, err = mime.ParseMediaType(a.ContentDisposition); err != nil {
+			return errors.Wrap(err, "invalid content_disposition field")
+		}
+	}
+	if a.ExpiresAt < 0 {
+		return errors.New("invalid_attributes", "invalid expires_at field: negative time")
+	}
 	return
 }
 
@@ -219,6 +259,8 @@ func (fr *FileRef) GetHashData() string {
 	hashArray = append(hashArray, fr.MerkleRoot)
 	hashArray = append(hashArray, strconv.FormatInt(fr.ActualFileSize, 10))
 	hashArray = append(hashArray, fr.ActualFileHash)
+	// the zero fields of the attributes are omitted, the files without the
+	// newer attributes keep the hash they had before those were added
 	var attrs, _ = json.Marshal(&fr.Attributes)
 	hashArray = append(hashArray, string(attrs))
 	return strings.Join(hashArray, ":")
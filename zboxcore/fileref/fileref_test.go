@@ -0,0 +1,84 @@
+package fileref
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0chain/gosdk/core/common"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAttributes_Validate(t *testing.T) {
+	tests := []struct {
+		name    string
+		attrs   Attributes
+		wantErr bool
+	}{
+		{
+			name: "Test_Zero_Success",
+		},
+		{
+			name: "Test_All_Fields_Success",
+			attrs: Attributes{
+				WhoPaysForReads:    common.WhoPays3rdParty,
+				ContentType:        "text/plain; charset=utf-8",
+				ContentDisposition: `attachment; filename="a.txt"`,
+				ExpiresAt:          common.Now(),
+				Locked:             true,
+			},
+		},
+		{
+			name:    "Test_Invalid_Who_Pays_Failed",
+			attrs:   Attributes{WhoPaysForReads: 5},
+			wantErr: true,
+		},
+		{
+			name:    "Test_Invalid_Content_Type_Failed",
+			attrs:   Attributes{ContentType: "text/plain;;"},
+			wantErr: true,
+		},
+		{
+			name:    "Test_Invalid_Content_Disposition_Failed",
+			attrs:   Attributes{ContentDisposition: "attachment; filename"},
+			wantErr: true,
+		},
+		{
+			name:    "Test_Negative_Expiry_Failed",
+			attrs:   Attributes{ExpiresAt: -1},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.attrs.Validate()
+			require.EqualValues(t, tt.wantErr, err != nil, "%v", err)
+		})
+	}
+}
+
+func TestAttributes_IsExpired(t *testing.T) {
+	require := require.New(t)
+	var attrs Attributes
+	require.False(attrs.IsExpired(common.Now()))
+
+	attrs.SetTTL(time.Hour)
+	require.False(attrs.IsExpired(common.Now()))
+	require.True(attrs.IsExpired(common.Now() + 3600))
+}
+
+func TestFileRef_GetHashData(t *testing.T) {
+	require := require.New(t)
+	fr := &FileRef{Ref: Ref{Type: FILE, Name: "a.txt", Path: "/a.txt"}}
+
+	// the files without attributes keep their hash
+	require.True(strings.HasSuffix(fr.GetHashData(), ":{}"))
+	hash := fr.CalculateHash()
+
+	fr.Attributes.Locked = true
+	require.True(strings.HasSuffix(fr.GetHashData(), `:{"locked":true}`))
+	require.NotEqual(hash, fr.CalculateHash())
+
+	fr.Attributes.Locked = false
+	require.EqualValues(hash, fr.CalculateHash())
+}
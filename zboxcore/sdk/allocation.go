@@ -8,6 +8,7 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"mime/multipart"
 	"net/http"
@@ -83,6 +84,12 @@ type ConsolidatedFileMeta struct {
 	CommitMetaTxns  []fileref.CommitMetaTxn
 	Collaborators   []fileref.Collaborator
 	Attributes      fileref.Attributes
+	CustomMeta      string
+}
+
+// GetCustomMeta returns the key/value pairs attached to the file.
+func (m *ConsolidatedFileMeta) GetCustomMeta() (map[string]string, error) {
+	return parseCustomMeta(m.CustomMeta)
 }
 
 type AllocationStats struct {
@@ -175,6 +182,7 @@ type Allocation struct {
 	downloadProgressMap     map[string]*DownloadRequest
 	repairRequestInProgress *RepairRequest
 	initialized             bool
+	metaCache               *metaCache
 }
 
 func (a *Allocation) GetStats() *AllocationStats {
@@ -190,9 +198,10 @@ func (a *Allocation) GetBlobberStats() map[string]*BlobberAllocationStats {
 		go getAllocationDataFromBlobber(blobber, a.Tx, rspCh, wg)
 	}
 	wg.Wait()
+	// the blobbers which fail don't respond
+	close(rspCh)
 	result := make(map[string]*BlobberAllocationStats, len(a.Blobbers))
-	for i := 0; i < numList; i++ {
-		resp := <-rspCh
+	for resp := range rspCh {
 		result[resp.BlobberURL] = resp
 	}
 	return result
@@ -243,17 +252,17 @@ func (a *Allocation) dispatchWork(ctx context.Context) {
 }
 
 func (a *Allocation) UpdateFile(localpath string, remotepath string,
-	attrs fileref.Attributes, status StatusCallback) error {
+	attrs fileref.Attributes, status StatusCallback, opts ...UploadOption) error {
 
 	return a.uploadOrUpdateFile(localpath, remotepath, status, true, "", false,
-		false, attrs)
+		false, attrs, opts...)
 }
 
 func (a *Allocation) UploadFile(localpath string, remotepath string,
-	attrs fileref.Attributes, status StatusCallback) error {
+	attrs fileref.Attributes, status StatusCallback, opts ...UploadOption) error {
 
 	return a.uploadOrUpdateFile(localpath, remotepath, status, false, "", false,
-		false, attrs)
+		false, attrs, opts...)
 }
 
 func (a *Allocation) CreateDir(dirName string) error {
@@ -274,6 +283,8 @@ func (a *Allocation) CreateDir(dirName string) error {
 	req.name = dirName
 
 	err := req.ProcessDir(a)
+	// the dir isn't committed, the blobbers which created it list it already
+	dropMetaCache(a.ID, dirName)
 	return err
 }
 
@@ -284,40 +295,104 @@ func (a *Allocation) RepairFile(localpath string, remotepath string,
 		false, true, fileref.Attributes{})
 }
 
+// RepairFileFromBlobbers repairs the remotepath without a local copy. The file
+// is read block by block from the blobbers which have it, the shards are
+// encoded again and uploaded only to the blobbers which miss the file. The
+// thumbnail isn't repaired, neither are the encrypted files as their content
+// can't be encrypted again with the same key.
+func (a *Allocation) RepairFileFromBlobbers(remotepath string,
+	status StatusCallback) error {
+
+	if !a.isInitialized() {
+		return notInitialized
+	}
+	remotepath = zboxutil.RemoteClean(remotepath)
+	if !zboxutil.IsRemoteAbs(remotepath) {
+		return errors.New("invalid_path", "Path should be valid and absolute")
+	}
+
+	found, repairRequired, fileRef, err := a.repairRequired(remotepath)
+	if err != nil {
+		return err
+	}
+	if !repairRequired {
+		return errors.New("", "Repair not required")
+	}
+	if len(fileRef.EncryptedKey) > 0 {
+		return errors.New("repair_not_supported", "Encrypted files can't be repaired from the blobbers")
+	}
+	if found.CountOnes() < a.DataShards {
+		return errors.New("repair_not_possible", "Not enough blobbers have the file to repair it")
+	}
+
+	reader, err := a.OpenReader(remotepath)
+	if err != nil {
+		return err
+	}
+	// read only from the blobbers holding the same file
+	reader.req.downloadMask = reader.req.downloadMask.And(found)
+
+	uploadReq := a.newUploadRequest(remotepath, fileRef.ActualFileSize, status,
+		false, false, fileRef.Attributes)
+	uploadReq.reader = reader
+	uploadReq.filepath = remotepath
+	uploadReq.isRepair = true
+	uploadReq.filemeta.Hash = fileRef.ActualFileHash
+	uploadReq.filemeta.CustomMeta = fileRef.CustomMeta
+	uploadReq.uploadMask = found.Not().And(uploadReq.uploadMask)
+	uploadReq.fullconsensus = float32(uploadReq.uploadMask.CountOnes())
+	uploadReq.completedCallback = func(filepath string) {
+		reader.Close()
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		delete(a.uploadProgressMap, filepath)
+	}
+
+	go func() {
+		a.uploadChan <- uploadReq
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		a.uploadProgressMap[remotepath] = uploadReq
+	}()
+	return nil
+}
+
 func (a *Allocation) UpdateFileWithThumbnail(localpath string, remotepath string,
-	thumbnailpath string, attrs fileref.Attributes, status StatusCallback) error {
+	thumbnailpath string, attrs fileref.Attributes, status StatusCallback,
+	opts ...UploadOption) error {
 
 	return a.uploadOrUpdateFile(localpath, remotepath, status, true,
-		thumbnailpath, false, false, attrs)
+		thumbnailpath, false, false, attrs, opts...)
 }
 
 func (a *Allocation) UploadFileWithThumbnail(localpath string,
 	remotepath string, thumbnailpath string, attrs fileref.Attributes,
-	status StatusCallback) error {
+	status StatusCallback, opts ...UploadOption) error {
 
 	return a.uploadOrUpdateFile(localpath, remotepath, status, false,
-		thumbnailpath, false, false, attrs)
+		thumbnailpath, false, false, attrs, opts...)
 }
 
 func (a *Allocation) EncryptAndUpdateFile(localpath string, remotepath string,
-	attrs fileref.Attributes, status StatusCallback) error {
+	attrs fileref.Attributes, status StatusCallback, opts ...UploadOption) error {
 
 	return a.uploadOrUpdateFile(localpath, remotepath, status, true, "", true,
-		false, attrs)
+		false, attrs, opts...)
 }
 
 func (a *Allocation) EncryptAndUploadFile(localpath string, remotepath string,
-	attrs fileref.Attributes, status StatusCallback) error {
+	attrs fileref.Attributes, status StatusCallback, opts ...UploadOption) error {
 
 	return a.uploadOrUpdateFile(localpath, remotepath, status, false, "", true,
-		false, attrs)
+		false, attrs, opts...)
 }
 
 func (a *Allocation) EncryptAndUpdateFileWithThumbnail(localpath string,
-	remotepath string, thumbnailpath string, attrs fileref.Attributes, status StatusCallback) error {
+	remotepath string, thumbnailpath string, attrs fileref.Attributes, status StatusCallback,
+	opts ...UploadOption) error {
 
 	return a.uploadOrUpdateFile(localpath, remotepath, status, true,
-		thumbnailpath, true, false, attrs)
+		thumbnailpath, true, false, attrs, opts...)
 }
 
 func (a *Allocation) EncryptAndUploadFileWithThumbnail(
@@ -326,6 +401,7 @@ func (a *Allocation) EncryptAndUploadFileWithThumbnail(
 	thumbnailpath string,
 	attrs fileref.Attributes,
 	status StatusCallback,
+	opts ...UploadOption,
 ) error {
 
 	return a.uploadOrUpdateFile(
@@ -337,6 +413,7 @@ func (a *Allocation) EncryptAndUploadFileWithThumbnail(
 		true,
 		false,
 		attrs,
+		opts...,
 	)
 }
 
@@ -348,12 +425,17 @@ func (a *Allocation) uploadOrUpdateFile(localpath string,
 	encryption bool,
 	isRepair bool,
 	attrs fileref.Attributes,
+	opts ...UploadOption,
 ) error {
 
 	if !a.isInitialized() {
 		return notInitialized
 	}
 
+	if err := attrs.Validate(); err != nil {
+		return errors.Wrap(err, "invalid attributes")
+	}
+
 	fileInfo, err := GetFileInfo(localpath)
 	if err != nil {
 		return errors.Wrap(err, "Local file error")
@@ -377,30 +459,15 @@ func (a *Allocation) uploadOrUpdateFile(localpath string,
 	}
 	remotepath = zboxutil.GetFullRemotePath(localpath, remotepath)
 
-	var fileName string
-	_, fileName = filepath.Split(remotepath)
-	uploadReq := &UploadRequest{}
-	uploadReq.remotefilepath = remotepath
+	uploadReq := a.newUploadRequest(remotepath, fileInfo.Size(), status, isUpdate, encryption, attrs)
+	for _, opt := range opts {
+		opt(uploadReq)
+	}
 	uploadReq.thumbnailpath = thumbnailpath
 	uploadReq.filepath = localpath
-	uploadReq.filemeta = &UploadFileMeta{}
-	uploadReq.filemeta.Name = fileName
-	uploadReq.filemeta.Size = fileInfo.Size()
-	uploadReq.filemeta.Path = remotepath
 	uploadReq.filemeta.ThumbnailSize = thumbnailSize
-	uploadReq.filemeta.Attributes = attrs
-	uploadReq.remaining = uploadReq.filemeta.Size
 	uploadReq.thumbRemaining = uploadReq.filemeta.ThumbnailSize
-	uploadReq.isUpdate = isUpdate
 	uploadReq.isRepair = isRepair
-	uploadReq.connectionID = zboxutil.NewConnectionId()
-	uploadReq.statusCallback = status
-	uploadReq.datashards = a.DataShards
-	uploadReq.parityshards = a.ParityShards
-	uploadReq.setUploadMask(len(a.Blobbers))
-	uploadReq.consensusThresh = (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards)
-	uploadReq.fullconsensus = float32(a.DataShards + a.ParityShards)
-	uploadReq.isEncrypted = encryption
 	uploadReq.completedCallback = func(filepath string) {
 		a.mutex.Lock()
 		defer a.mutex.Unlock()
@@ -408,7 +475,7 @@ func (a *Allocation) uploadOrUpdateFile(localpath string,
 	}
 
 	if uploadReq.isRepair {
-		found, repairRequired, fileRef, err := a.RepairRequired(remotepath)
+		found, repairRequired, fileRef, err := a.repairRequired(remotepath)
 		if err != nil {
 			return err
 		}
@@ -426,6 +493,9 @@ func (a *Allocation) uploadOrUpdateFile(localpath string,
 		}
 
 		uploadReq.filemeta.Hash = fileRef.ActualFileHash
+		// the repaired shards keep the meta of the file on the other blobbers
+		uploadReq.filemeta.Attributes = fileRef.Attributes
+		withCustomMeta(fileRef.CustomMeta)(uploadReq)
 		uploadReq.uploadMask = found.Not().And(uploadReq.uploadMask)
 		uploadReq.fullconsensus = float32(uploadReq.uploadMask.Add64(1).TrailingZeros())
 	}
@@ -434,6 +504,11 @@ func (a *Allocation) uploadOrUpdateFile(localpath string,
 		return fmt.Errorf("allocation requires [%v] blobbers, which is greater than the maximum permitted number of [%v]. reduce number of data or parity shards and try again", uploadReq.fullconsensus, uploadReq.GetMaxBlobbersSupported())
 	}
 
+	// encrypted uploads can't be resumed, the key changes with every attempt
+	if len(uploadJournalDir) > 0 && !isRepair && !encryption {
+		uploadReq.journal = newUploadJournal(a.ID, uploadReq, fileInfo)
+	}
+
 	go func() {
 		a.uploadChan <- uploadReq
 		a.mutex.Lock()
@@ -443,11 +518,157 @@ func (a *Allocation) uploadOrUpdateFile(localpath string,
 	return nil
 }
 
+// UploadFromReader uploads the content of the reader to the remotepath.
+// The size is the number of bytes the reader will return, or a negative
+// value if it isn't known in advance. In that case the content is read
+// chunk by chunk till EOF and the Started callback gets -1 as total bytes.
+// The upload can be canceled by CancelUpload with the remotepath.
+func (a *Allocation) UploadFromReader(reader io.Reader, size int64,
+	remotepath string, attrs fileref.Attributes, status StatusCallback,
+	opts ...UploadOption) error {
+
+	return a.uploadOrUpdateFromReader(reader, size, remotepath, status, false,
+		false, attrs, opts...)
+}
+
+// UpdateFromReader replaces the content of the remotepath with the content
+// of the reader. See UploadFromReader for the meaning of the size.
+func (a *Allocation) UpdateFromReader(reader io.Reader, size int64,
+	remotepath string, attrs fileref.Attributes, status StatusCallback,
+	opts ...UploadOption) error {
+
+	return a.uploadOrUpdateFromReader(reader, size, remotepath, status, true,
+		false, attrs, opts...)
+}
+
+// EncryptAndUploadFromReader is the encrypted variant of UploadFromReader.
+func (a *Allocation) EncryptAndUploadFromReader(reader io.Reader, size int64,
+	remotepath string, attrs fileref.Attributes, status StatusCallback,
+	opts ...UploadOption) error {
+
+	return a.uploadOrUpdateFromReader(reader, size, remotepath, status, false,
+		true, attrs, opts...)
+}
+
+// EncryptAndUpdateFromReader is the encrypted variant of UpdateFromReader.
+func (a *Allocation) EncryptAndUpdateFromReader(reader io.Reader, size int64,
+	remotepath string, attrs fileref.Attributes, status StatusCallback,
+	opts ...UploadOption) error {
+
+	return a.uploadOrUpdateFromReader(reader, size, remotepath, status, true,
+		true, attrs, opts...)
+}
+
+func (a *Allocation) uploadOrUpdateFromReader(reader io.Reader,
+	size int64,
+	remotepath string,
+	status StatusCallback,
+	isUpdate bool,
+	encryption bool,
+	attrs fileref.Attributes,
+	opts ...UploadOption,
+) error {
+
+	if !a.isInitialized() {
+		return notInitialized
+	}
+
+	if reader == nil {
+		return errors.New("invalid_reader", "Reader to upload from is nil")
+	}
+
+	if err := attrs.Validate(); err != nil {
+		return errors.Wrap(err, "invalid attributes")
+	}
+
+	remotepath = zboxutil.RemoteClean(remotepath)
+	if !zboxutil.IsRemoteAbs(remotepath) || strings.HasSuffix(remotepath, "/") {
+		return errors.New("invalid_path", "Path should be valid and absolute")
+	}
+
+	uploadReq := a.newUploadRequest(remotepath, size, status, isUpdate, encryption, attrs)
+	for _, opt := range opts {
+		opt(uploadReq)
+	}
+	uploadReq.reader = reader
+	// reader uploads are tracked by the remote path, there is no local one
+	uploadReq.filepath = remotepath
+	if size < 0 {
+		uploadReq.sizeUnknown = true
+		uploadReq.filemeta.Size = 0
+		uploadReq.remaining = 0
+	}
+	uploadReq.completedCallback = func(filepath string) {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		delete(a.uploadProgressMap, filepath)
+	}
+
+	if !uploadReq.IsFullConsensusSupported() {
+		return fmt.Errorf("allocation requires [%v] blobbers, which is greater than the maximum permitted number of [%v]. reduce number of data or parity shards and try again", uploadReq.fullconsensus, uploadReq.GetMaxBlobbersSupported())
+	}
+
+	go func() {
+		a.uploadChan <- uploadReq
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		a.uploadProgressMap[remotepath] = uploadReq
+	}()
+	return nil
+}
+
+func (a *Allocation) newUploadRequest(remotepath string, size int64,
+	status StatusCallback, isUpdate bool, encryption bool,
+	attrs fileref.Attributes) *UploadRequest {
+
+	var fileName string
+	_, fileName = filepath.Split(remotepath)
+	uploadReq := &UploadRequest{}
+	uploadReq.remotefilepath = remotepath
+	uploadReq.filemeta = &UploadFileMeta{}
+	uploadReq.filemeta.Name = fileName
+	uploadReq.filemeta.Size = size
+	uploadReq.filemeta.Path = remotepath
+	uploadReq.filemeta.Attributes = attrs
+	uploadReq.remaining = uploadReq.filemeta.Size
+	uploadReq.isUpdate = isUpdate
+	uploadReq.connectionID = zboxutil.NewConnectionId()
+	uploadReq.statusCallback = status
+	uploadReq.datashards = a.DataShards
+	uploadReq.parityshards = a.ParityShards
+	uploadReq.setUploadMask(len(a.Blobbers))
+	uploadReq.consensusThresh = (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards)
+	uploadReq.fullconsensus = float32(a.DataShards + a.ParityShards)
+	uploadReq.isEncrypted = encryption
+	return uploadReq
+}
+
+// RepairRequired returns the blobbers which have the file at the remote path
+// in consensus, whether the others need a repair and the file ref.
 func (a *Allocation) RepairRequired(remotepath string) (zboxutil.Uint128, bool, *fileref.FileRef, error) {
 	if !a.isInitialized() {
 		return zboxutil.Uint128{}, false, nil, notInitialized
 	}
+	c := a.metaCache
+	if c == nil {
+		return a.repairRequired(remotepath)
+	}
+	key := zboxutil.RemoteClean(remotepath)
+	c.check(a)
+	if state, ok := c.getRepair(key); ok {
+		return state.found, state.required, &state.ref, nil
+	}
+	gen := c.generation()
+	found, required, fileRef, err := a.repairRequired(remotepath)
+	if err == nil {
+		c.putRepair(key, gen, &repairState{found: found, required: required, ref: *fileRef})
+	}
+	return found, required, fileRef, err
+}
 
+// repairRequired is RepairRequired asking the blobbers, the repairs don't
+// rely on the metadata cache.
+func (a *Allocation) repairRequired(remotepath string) (zboxutil.Uint128, bool, *fileref.FileRef, error) {
 	listReq := &ListRequest{}
 	listReq.allocationID = a.ID
 	listReq.allocationTx = a.Tx
@@ -466,8 +687,10 @@ func (a *Allocation) RepairRequired(remotepath string) (zboxutil.Uint128, bool,
 	return found, !found.Equals(uploadMask), fileRef, nil
 }
 
-func (a *Allocation) DownloadFile(localPath string, remotePath string, status StatusCallback) error {
-	return a.downloadFile(localPath, remotePath, DOWNLOAD_CONTENT_FULL, 1, 0, numBlockDownloads, status)
+func (a *Allocation) DownloadFile(localPath string, remotePath string, status StatusCallback,
+	opts ...DownloadOption) error {
+
+	return a.downloadFile(localPath, remotePath, DOWNLOAD_CONTENT_FULL, 1, 0, numBlockDownloads, status, opts...)
 }
 
 func (a *Allocation) DownloadFileByBlock(localPath string, remotePath string, startBlock int64, endBlock int64, numBlocks int, status StatusCallback) error {
@@ -480,19 +703,29 @@ func (a *Allocation) DownloadThumbnail(localPath string, remotePath string, stat
 
 func (a *Allocation) downloadFile(localPath string, remotePath string, contentMode string,
 	startBlock int64, endBlock int64, numBlocks int,
-	status StatusCallback) error {
+	status StatusCallback, opts ...DownloadOption) error {
 	if !a.isInitialized() {
 		return notInitialized
 	}
+	downloadReq := &DownloadRequest{}
+	for _, opt := range opts {
+		opt(downloadReq)
+	}
+	// a partial file of a resumable download, which has its progress
+	// record, is continued
 	if stat, err := os.Stat(localPath); err == nil {
 		if !stat.IsDir() {
-			return fmt.Errorf("Local path is not a directory '%s'", localPath)
-		}
-		localPath = strings.TrimRight(localPath, "/")
-		_, rFile := filepath.Split(remotePath)
-		localPath = fmt.Sprintf("%s/%s", localPath, rFile)
-		if _, err := os.Stat(localPath); err == nil {
-			return fmt.Errorf("Local file already exists '%s'", localPath)
+			if !downloadReq.resume || !hasDownloadProgress(localPath) {
+				return fmt.Errorf("Local path is not a directory '%s'", localPath)
+			}
+		} else {
+			localPath = strings.TrimRight(localPath, "/")
+			_, rFile := filepath.Split(remotePath)
+			localPath = fmt.Sprintf("%s/%s", localPath, rFile)
+			if _, err := os.Stat(localPath); err == nil &&
+				(!downloadReq.resume || !hasDownloadProgress(localPath)) {
+				return fmt.Errorf("Local file already exists '%s'", localPath)
+			}
 		}
 	}
 	lPath, _ := filepath.Split(localPath)
@@ -502,7 +735,6 @@ func (a *Allocation) downloadFile(localPath string, remotePath string, contentMo
 		return noBLOBBERS
 	}
 
-	downloadReq := &DownloadRequest{}
 	downloadReq.allocationID = a.ID
 	downloadReq.allocationTx = a.Tx
 	downloadReq.ctx, _ = context.WithCancel(a.ctx)
@@ -569,7 +801,22 @@ func (a *Allocation) ListDirFromAuthTicket(authTicket string, lookupHash string)
 func (a *Allocation) ListDir(path string) (*ListResult, error) {
 	consensusThresh := (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards)
 	fullconsensus := float32(a.DataShards + a.ParityShards)
-	return a.listDir(path, consensusThresh, fullconsensus)
+	c := a.metaCache
+	if c == nil || len(path) == 0 {
+		return a.listDir(path, consensusThresh, fullconsensus)
+	}
+	path = zboxutil.RemoteClean(path)
+	c.check(a)
+	if ref, ok := c.getList(path); ok {
+		return ref, nil
+	}
+	gen := c.generation()
+	ref, err := a.listDir(path, consensusThresh, fullconsensus)
+	// the paths not found aren't cached
+	if err == nil && len(ref.Type) > 0 {
+		c.putList(path, gen, ref)
+	}
+	return ref, err
 }
 
 func (a *Allocation) listDir(path string, consensusThresh, fullconsensus float32) (*ListResult, error) {
@@ -603,7 +850,24 @@ func (a *Allocation) GetFileMeta(path string) (*ConsolidatedFileMeta, error) {
 	if !a.isInitialized() {
 		return nil, notInitialized
 	}
+	c := a.metaCache
+	if c == nil {
+		return a.getFileMeta(path)
+	}
+	key := zboxutil.RemoteClean(path)
+	c.check(a)
+	if meta, ok := c.getFile(key); ok {
+		return meta, nil
+	}
+	gen := c.generation()
+	meta, err := a.getFileMeta(path)
+	if err == nil {
+		c.putFile(key, gen, meta)
+	}
+	return meta, err
+}
 
+func (a *Allocation) getFileMeta(path string) (*ConsolidatedFileMeta, error) {
 	result := &ConsolidatedFileMeta{}
 	listReq := &ListRequest{}
 	listReq.allocationID = a.ID
@@ -626,6 +890,7 @@ func (a *Allocation) GetFileMeta(path string) (*ConsolidatedFileMeta, error) {
 		result.CommitMetaTxns = ref.CommitMetaTxns
 		result.Collaborators = ref.Collaborators
 		result.Attributes = ref.Attributes
+		result.CustomMeta = ref.CustomMeta
 		result.ActualFileSize = ref.Size
 		result.ActualNumBlocks = ref.NumBlocks
 		return result, nil
@@ -671,6 +936,7 @@ func (a *Allocation) GetFileMetaFromAuthTicket(authTicket string, lookupHash str
 		result.Path = ref.Path
 		result.Size = ref.ActualFileSize
 		result.CommitMetaTxns = ref.CommitMetaTxns
+		result.CustomMeta = ref.CustomMeta
 		result.ActualFileSize = ref.Size
 		result.ActualNumBlocks = ref.NumBlocks
 		return result, nil
@@ -769,6 +1035,9 @@ func (a *Allocation) RenameObject(path string, destName string) error {
 	return err
 }
 
+// UpdateObjectAttributes sets the attributes of the file or the directory at
+// the path. The attributes of a directory are inherited by the files uploaded
+// to it afterwards without attributes of their own.
 func (a *Allocation) UpdateObjectAttributes(path string,
 	attrs fileref.Attributes) (err error) {
 
@@ -787,6 +1056,10 @@ func (a *Allocation) UpdateObjectAttributes(path string,
 			"Path should be valid and absolute")
 	}
 
+	if err = attrs.Validate(); err != nil {
+		return errors.Wrap(err, "invalid attributes")
+	}
+
 	var attrsb []byte
 	if attrsb, err = json.Marshal(attrs); err != nil {
 		panic(err)
@@ -809,15 +1082,74 @@ func (a *Allocation) UpdateObjectAttributes(path string,
 	return ar.ProcessAttributes()
 }
 
+// UpdateCustomMeta replaces the key/value pairs attached to the file at the
+// path, the content of the file is left as it is. A nil or empty meta drops
+// all the pairs, but the mtime and the mode kept by Sync unless the meta sets
+// them. It needs blobbers serving the custom meta endpoint and committing the
+// update_custom_meta operation, which the released blobbers don't do yet: a
+// custom_meta_unsupported error tells so, upload the file again with
+// WithCustomMeta then.
+func (a *Allocation) UpdateCustomMeta(path string,
+	meta map[string]string) error {
+
+	if !a.isInitialized() {
+		return notInitialized
+	}
+
+	if len(path) == 0 {
+		return errors.New("update_custom_meta", "Invalid path for the custom meta")
+	}
+
+	path = zboxutil.RemoteClean(path)
+	if !zboxutil.IsRemoteAbs(path) {
+		return errors.New("update_custom_meta",
+			"Path should be valid and absolute")
+	}
+
+	fileMeta, err := a.getFileMeta(path)
+	if err != nil {
+		return err
+	}
+
+	var mr CustomMetaRequest
+
+	mr.blobbers = a.Blobbers
+	mr.allocationID = a.ID
+	mr.allocationTx = a.Tx
+	mr.customMeta = mergeCustomMeta("", keepSyncFileMeta(fileMeta.CustomMeta, meta))
+	mr.consensusThresh = (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards)
+	mr.fullconsensus = float32(a.DataShards + a.ParityShards)
+	mr.ctx = a.ctx
+	mr.remotefilepath = path
+	mr.connectionID = zboxutil.NewConnectionId()
+
+	return mr.ProcessCustomMeta()
+}
+
+// MoveObject moves the file or the directory at the path into the
+// destination directory. A directory with children is moved by MoveDir, file
+// by file with the copies deleted again when the move fails.
 func (a *Allocation) MoveObject(path string, destPath string) error {
-	err := a.CopyObject(path, destPath)
+	err := a.copyObject(path, destPath, true)
 	if err != nil {
+		if errors.Is(err, errMoveDir) {
+			return a.MoveDir(path, destPath)
+		}
 		return err
 	}
 	return a.DeleteFile(path)
 }
 
+// CopyObject copies the object at the path into the destination directory
+// in one request to the blobbers. CopyDir copies the directories file by
+// file, with the conflicts at the destination handled.
 func (a *Allocation) CopyObject(path string, destPath string) error {
+	return a.copyObject(path, destPath, false)
+}
+
+func (a *Allocation) copyObject(path string, destPath string,
+	unlockedOnly bool) error {
+
 	if !a.isInitialized() {
 		return notInitialized
 	}
@@ -841,6 +1173,7 @@ func (a *Allocation) CopyObject(path string, destPath string) error {
 	req.ctx = a.ctx
 	req.remotefilepath = path
 	req.copyMask = 0
+	req.unlockedOnly = unlockedOnly
 	req.connectionID = zboxutil.NewConnectionId()
 	err := req.ProcessCopy()
 	return err
@@ -1092,14 +1425,9 @@ func (a *Allocation) downloadFromAuthTicket(localPath string, authTicket string,
 	if !a.isInitialized() {
 		return notInitialized
 	}
-	sEnc, err := base64.StdEncoding.DecodeString(authTicket)
+	at, err := decodeAuthTicket(authTicket)
 	if err != nil {
-		return errors.New("auth_ticket_decode_error", "Error decoding the auth ticket."+err.Error())
-	}
-	at := &marker.AuthTicket{}
-	err = json.Unmarshal(sEnc, at)
-	if err != nil {
-		return errors.New("auth_ticket_decode_error", "Error unmarshaling the auth ticket."+err.Error())
+		return err
 	}
 	if stat, err := os.Stat(localPath); err == nil {
 		if !stat.IsDir() {
@@ -1149,6 +1477,64 @@ func (a *Allocation) downloadFromAuthTicket(localPath string, authTicket string,
 	return nil
 }
 
+func decodeAuthTicket(authTicket string) (*marker.AuthTicket, error) {
+	sEnc, err := base64.StdEncoding.DecodeString(authTicket)
+	if err != nil {
+		return nil, errors.New("auth_ticket_decode_error", "Error decoding the auth ticket."+err.Error())
+	}
+	at := &marker.AuthTicket{}
+	err = json.Unmarshal(sEnc, at)
+	if err != nil {
+		return nil, errors.New("auth_ticket_decode_error", "Error unmarshaling the auth ticket."+err.Error())
+	}
+	return at, nil
+}
+
+// DownloadToWriter downloads the remote file into the writer. The content is
+// verified once it's written, a mismatch fails the call.
+func (a *Allocation) DownloadToWriter(remotePath string, w io.Writer) error {
+	r, err := a.OpenReader(remotePath)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return r.writeTo(w)
+}
+
+// DownloadBytes downloads the remote file into memory.
+func (a *Allocation) DownloadBytes(remotePath string) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	if err := a.DownloadToWriter(remotePath, buf); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// DownloadToWriterFromAuthTicket downloads the shared file into the writer.
+// The content is verified once it's written, a mismatch fails the call.
+func (a *Allocation) DownloadToWriterFromAuthTicket(authTicket string,
+	remoteLookupHash string, rxPay bool, w io.Writer) error {
+
+	r, err := a.OpenReaderFromAuthTicket(authTicket, remoteLookupHash, rxPay)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return r.writeTo(w)
+}
+
+// DownloadBytesFromAuthTicket downloads the shared file into memory.
+func (a *Allocation) DownloadBytesFromAuthTicket(authTicket string,
+	remoteLookupHash string, rxPay bool) ([]byte, error) {
+
+	buf := &bytes.Buffer{}
+	err := a.DownloadToWriterFromAuthTicket(authTicket, remoteLookupHash, rxPay, buf)
+	if err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
 func (a *Allocation) CommitMetaTransaction(path, crudOperation, authTicket, lookupHash string, fileMeta *ConsolidatedFileMeta, status StatusCallback) (err error) {
 	if !a.isInitialized() {
 		return notInitialized
@@ -1182,6 +1568,23 @@ func (a *Allocation) CommitMetaTransaction(path, crudOperation, authTicket, look
 }
 
 func (a *Allocation) StartRepair(localRootPath, pathToRepair string, statusCB StatusCallback) error {
+	return a.StartRepairWithOptions(localRootPath, pathToRepair, &RepairOptions{}, statusCB)
+}
+
+// StartRepairFromBlobbers repairs the files under the path without local
+// copies, see RepairFileFromBlobbers.
+func (a *Allocation) StartRepairFromBlobbers(pathToRepair string, statusCB StatusCallback) error {
+	return a.StartRepairWithOptions("", pathToRepair, &RepairOptions{FromBlobbers: true}, statusCB)
+}
+
+// StartRepairWithOptions repairs the files under the path with the options,
+// the files are repaired by a pool of workers and a checkpoint lets a
+// canceled repair resume. The progress is reported after every file to the
+// status callbacks implementing RepairProgressCallback, and is returned by
+// GetRepairProgress.
+func (a *Allocation) StartRepairWithOptions(localRootPath, pathToRepair string,
+	opts *RepairOptions, statusCB StatusCallback) error {
+
 	if !a.isInitialized() {
 		return notInitialized
 	}
@@ -1193,11 +1596,22 @@ func (a *Allocation) StartRepair(localRootPath, pathToRepair string, statusCB St
 		return err
 	}
 
+	if opts == nil {
+		opts = &RepairOptions{}
+	}
 	repairReq := &RepairRequest{
 		listDir:       listDir,
 		localRootPath: localRootPath,
+		fromBlobbers:  opts.FromBlobbers,
+		workers:       opts.Workers,
 		statusCB:      statusCB,
 	}
+	if len(opts.CheckpointPath) > 0 {
+		repairReq.checkpoint, err = openRepairCheckpoint(opts.CheckpointPath)
+		if err != nil {
+			return err
+		}
+	}
 
 	repairReq.completedCallback = func() {
 		a.mutex.Lock()
@@ -1214,9 +1628,21 @@ func (a *Allocation) StartRepair(localRootPath, pathToRepair string, statusCB St
 	return nil
 }
 
+// GetRepairProgress returns the progress of the repair in progress.
+func (a *Allocation) GetRepairProgress() (*RepairProgress, error) {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+	if a.repairRequestInProgress == nil {
+		return nil, errors.New("invalid_repair_progress_request", "No repair in progress for the allocation")
+	}
+	return a.repairRequestInProgress.getProgress(), nil
+}
+
 func (a *Allocation) CancelRepair() error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
 	if a.repairRequestInProgress != nil {
-		a.repairRequestInProgress.isRepairCanceled = true
+		a.repairRequestInProgress.cancel()
 		return nil
 	}
 	return errors.New("invalid_cancel_repair_request", "No repair in progress for the allocation")
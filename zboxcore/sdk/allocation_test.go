@@ -546,6 +546,109 @@ func TestAllocation_UploadFile(t *testing.T) {
 	require.NoErrorf(err, "Unexpected error %v", err)
 }
 
+func TestAllocation_UploadFromReader(t *testing.T) {
+	type parameters struct {
+		reader     io.Reader
+		size       int64
+		remotePath string
+	}
+	tests := []struct {
+		name       string
+		parameters parameters
+		setup      func(*testing.T, *Allocation) (teardown func(*testing.T))
+		wantErr    bool
+		errMsg     string
+	}{
+		{
+			name: "Test_Not_Initialize_Failed",
+			parameters: parameters{
+				reader:     strings.NewReader("mock content"),
+				size:       12,
+				remotePath: "/1.txt",
+			},
+			setup: func(t *testing.T, a *Allocation) (teardown func(t *testing.T)) {
+				a.initialized = false
+				return func(t *testing.T) { a.initialized = true }
+			},
+			wantErr: true,
+			errMsg:  "sdk_not_initialized: Please call InitStorageSDK Init and use GetAllocation to get the allocation object",
+		},
+		{
+			name: "Test_Nil_Reader_Failed",
+			parameters: parameters{
+				size:       12,
+				remotePath: "/1.txt",
+			},
+			wantErr: true,
+			errMsg:  "invalid_reader: Reader to upload from is nil",
+		},
+		{
+			name: "Test_Invalid_Remote_Path_Failed",
+			parameters: parameters{
+				reader:     strings.NewReader("mock content"),
+				size:       12,
+				remotePath: "1.txt",
+			},
+			wantErr: true,
+			errMsg:  "invalid_path: Path should be valid and absolute",
+		},
+		{
+			name: "Test_Remote_Dir_Path_Failed",
+			parameters: parameters{
+				reader:     strings.NewReader("mock content"),
+				size:       12,
+				remotePath: "/",
+			},
+			wantErr: true,
+			errMsg:  "invalid_path: Path should be valid and absolute",
+		},
+		{
+			name: "Test_Known_Size_Success",
+			parameters: parameters{
+				reader:     strings.NewReader("mock content"),
+				size:       12,
+				remotePath: "/1.txt",
+			},
+		},
+		{
+			name: "Test_Unknown_Size_Success",
+			parameters: parameters{
+				reader:     strings.NewReader("mock content"),
+				size:       -1,
+				remotePath: "/1.txt",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			a := &Allocation{
+				ParityShards: 2,
+				DataShards:   2,
+			}
+			setupMockAllocation(t, a)
+			for i := 0; i < numBlobbers; i++ {
+				a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+					ID:      mockBlobberId + strconv.Itoa(i),
+					Baseurl: "TestAllocation_UploadFromReader" + mockBlobberUrl + strconv.Itoa(i),
+				})
+			}
+			if tt.setup != nil {
+				if teardown := tt.setup(t, a); teardown != nil {
+					defer teardown(t)
+				}
+			}
+			err := a.UploadFromReader(tt.parameters.reader, tt.parameters.size, tt.parameters.remotePath, fileref.Attributes{}, nil)
+			require.EqualValues(tt.wantErr, err != nil)
+			if err != nil {
+				require.EqualValues(tt.errMsg, errors.Top(err))
+				return
+			}
+			require.NoErrorf(err, "Unexpected error %v", err)
+		})
+	}
+}
+
 func TestAllocation_RepairFile(t *testing.T) {
 	const (
 		mockFileRefName = "mock file ref name"
@@ -664,6 +767,132 @@ func TestAllocation_RepairFile(t *testing.T) {
 	}
 }
 
+func TestAllocation_RepairFileFromBlobbers(t *testing.T) {
+	const mockActualHash = "4041e3eeb170751544a47af4e4f9d374e76cee1d"
+
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	setupHttpResponses := func(t *testing.T, testName string, numCorrect int, encryptedKey string) {
+		for i := 0; i < numBlobbers; i++ {
+			statusCode := http.StatusBadRequest
+			if i < numCorrect {
+				statusCode = http.StatusOK
+			}
+			url := "TestAllocation_RepairFileFromBlobbers" + testName + mockBlobberUrl + strconv.Itoa(i)
+			mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+				return strings.HasPrefix(req.URL.Path, url)
+			})).Return(func(statusCode int) func(*http.Request) *http.Response {
+				return func(*http.Request) *http.Response {
+					fileRef := &fileref.FileRef{
+						ActualFileHash: mockActualHash,
+						ActualFileSize: 10,
+						EncryptedKey:   encryptedKey,
+						CustomMeta:     `{"k":"v"}`,
+					}
+					fileRef.Type = fileref.FILE
+					jsonFR, err := json.Marshal(fileRef)
+					require.NoError(t, err)
+					return &http.Response{
+						StatusCode: statusCode,
+						Body:       ioutil.NopCloser(bytes.NewReader(jsonFR)),
+					}
+				}
+			}(statusCode), nil)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		remotePath   string
+		numCorrect   int
+		dataShards   int
+		encryptedKey string
+		wantErr      bool
+		errMsg       string
+	}{
+		{
+			name:       "Test_Invalid_Path_Failed",
+			remotePath: "x.txt",
+			wantErr:    true,
+			errMsg:     "invalid_path: Path should be valid and absolute",
+		},
+		{
+			name:       "Test_Repair_Not_Required_Failed",
+			remotePath: "/x.txt",
+			numCorrect: 4,
+			wantErr:    true,
+			errMsg:     "Repair not required",
+		},
+		{
+			name:       "Test_Not_Enough_Blobbers_Failed",
+			remotePath: "/x.txt",
+			numCorrect: 2,
+			dataShards: 3,
+			wantErr:    true,
+			errMsg:     "repair_not_possible: Not enough blobbers have the file to repair it",
+		},
+		{
+			name:         "Test_Encrypted_Failed",
+			remotePath:   "/x.txt",
+			numCorrect:   3,
+			encryptedKey: "mock encrypted key",
+			wantErr:      true,
+			errMsg:       "repair_not_supported: Encrypted files can't be repaired from the blobbers",
+		},
+		{
+			name:       "Test_Repair_Required_Success",
+			remotePath: "/x.txt",
+			numCorrect: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			a := &Allocation{
+				ParityShards: 2,
+				DataShards:   2,
+			}
+			if tt.dataShards > 0 {
+				a.DataShards = tt.dataShards
+				a.ParityShards = numBlobbers - tt.dataShards
+			}
+			a.uploadChan = make(chan *UploadRequest, 10)
+			a.ctx, a.ctxCancelF = context.WithCancel(context.Background())
+			defer a.ctxCancelF()
+			a.uploadProgressMap = make(map[string]*UploadRequest)
+			a.mutex = &sync.Mutex{}
+			a.initialized = true
+			sdkInitialized = true
+			for i := 0; i < numBlobbers; i++ {
+				a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+					Baseurl: "TestAllocation_RepairFileFromBlobbers" + tt.name + mockBlobberUrl + strconv.Itoa(i),
+				})
+			}
+			setupHttpResponses(t, tt.name, tt.numCorrect, tt.encryptedKey)
+			err := a.RepairFileFromBlobbers(tt.remotePath, nil)
+			require.EqualValues(tt.wantErr, err != nil)
+			if err != nil {
+				require.EqualValues(tt.errMsg, errors.Top(err))
+				return
+			}
+			uploadReq := <-a.uploadChan
+			require.True(uploadReq.isRepair)
+			require.EqualValues(zboxutil.NewUint128(8), uploadReq.uploadMask)
+			require.EqualValues(mockActualHash, uploadReq.filemeta.Hash)
+			require.EqualValues(`{"k":"v"}`, uploadReq.filemeta.CustomMeta)
+			require.NotNil(uploadReq.reader)
+		})
+	}
+}
+
 func TestAllocation_UpdateFileWithThumbnail(t *testing.T) {
 	const (
 		mockLocalPath     = "1.txt"
@@ -1790,6 +2019,34 @@ func TestAllocation_MoveObject(t *testing.T) {
 				return nil
 			},
 		},
+		{
+			name: "Test_Dir_With_Children_Moved_By_MoveDir",
+			parameters: parameters{
+				path:     "/d",
+				destPath: "/d/s",
+			},
+			setup: func(t *testing.T, testCaseName string, a *Allocation) (teardown func(t *testing.T)) {
+				body, err := json.Marshal(&fileref.ReferencePath{
+					Meta: map[string]interface{}{
+						"type": fileref.DIRECTORY,
+						"path": "/d",
+						"name": "d",
+					},
+					List: []*fileref.ReferencePath{{
+						Meta: map[string]interface{}{
+							"type": mockType,
+							"path": "/d/1.txt",
+							"name": "1.txt",
+						},
+					}},
+				})
+				require.NoError(t, err)
+				setupMockHttpResponse(t, &mockClient, "TestAllocation_MoveObject", testCaseName, a, http.MethodGet, http.StatusOK, body)
+				return nil
+			},
+			wantErr: true,
+			errMsg:  "invalid_path: Destination can't be the source or in it",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,395 @@
+package sdk
+
+import (
+	"sync"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/allocationchange"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// BatchResult is the outcome of an operation of a batch.
+type BatchResult struct {
+	Operation    string `json:"operation"`
+	RemotePath   string `json:"remote_path"`
+	Success      bool   `json:"success"`
+	ErrorMessage string `json:"error_msg,omitempty"`
+}
+
+type batchItem struct {
+	operation  string
+	remotePath string
+	// prepare sends the operation to the blobbers in the batch connection and
+	// returns the changes indexed by the blobber position
+	prepare func(connectionID string) ([]allocationchange.AllocationChange, error)
+	// completed and failed report the outcome of the operation, may be nil
+	completed func(consensus float32)
+	failed    func(err error)
+	// isInsert tells a failed item has to be deleted from the blobbers which
+	// have committed it
+	isInsert bool
+	changes  []allocationchange.AllocationChange
+	err      error
+}
+
+// Batch queues file operations and commits them together under one
+// connection, so every blobber gets a single write marker for all of them.
+// The operations are sent to the blobbers in the order they've been added,
+// but they are applied on the state before the batch: an operation can't
+// depend on another one of the same batch, e.g. rename a file uploaded in it.
+type Batch struct {
+	allocation   *Allocation
+	connectionID string
+	status       StatusCallback
+	items        []*batchItem
+	dirAttrs     *dirAttributes
+	committed    bool
+	mutex        sync.Mutex
+}
+
+// NewBatch creates an empty batch of operations on the allocation. The status
+// callback gets the progress of the uploads in the batch, it may be nil.
+func (a *Allocation) NewBatch(status StatusCallback) *Batch {
+	return &Batch{
+		allocation:   a,
+		connectionID: zboxutil.NewConnectionId(),
+		status:       status,
+		dirAttrs:     newDirAttributes(),
+	}
+}
+
+// Len returns the number of operations in the batch.
+func (b *Batch) Len() int {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return len(b.items)
+}
+
+func (b *Batch) add(item *batchItem) error {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.committed {
+		return errors.New("batch_committed", "Batch has been committed already")
+	}
+	b.items = append(b.items, item)
+	return nil
+}
+
+func batchRemotePath(remotepath string) (string, error) {
+	if len(remotepath) == 0 {
+		return "", errors.New("invalid_path", "Invalid path for the batch")
+	}
+	remotepath = zboxutil.RemoteClean(remotepath)
+	if !zboxutil.IsRemoteAbs(remotepath) {
+		return "", errors.New("invalid_path", "Path should be valid and absolute")
+	}
+	return remotepath, nil
+}
+
+// Upload adds the upload of the local file to the batch.
+func (b *Batch) Upload(localpath, remotepath string, attrs fileref.Attributes) error {
+	return b.addUpload(localpath, remotepath, false, attrs)
+}
+
+// Update adds the update of the remote file with the local one to the batch.
+func (b *Batch) Update(localpath, remotepath string, attrs fileref.Attributes) error {
+	return b.addUpload(localpath, remotepath, true, attrs)
+}
+
+func (b *Batch) addUpload(localpath, remotepath string, isUpdate bool,
+	attrs fileref.Attributes) error {
+
+	a := b.allocation
+	fileInfo, err := GetFileInfo(localpath)
+	if err != nil {
+		return errors.Wrap(err, "Local file error")
+	}
+	remotepath, err = batchRemotePath(remotepath)
+	if err != nil {
+		return err
+	}
+	remotepath = zboxutil.GetFullRemotePath(localpath, remotepath)
+
+	newUploadReq := func(status StatusCallback) *UploadRequest {
+		uploadReq := a.newUploadRequest(remotepath, fileInfo.Size(), status, isUpdate, false, attrs)
+		uploadReq.filepath = localpath
+		uploadReq.dirAttrs = b.dirAttrs
+		return uploadReq
+	}
+	uploadReq := newUploadReq(nil)
+	if !uploadReq.IsFullConsensusSupported() {
+		return errors.New("too_many_blobbers", "Allocation requires more blobbers than the upload supports")
+	}
+
+	item := &batchItem{
+		operation:  allocationchange.INSERT_OPERATION,
+		remotePath: remotepath,
+		isInsert:   !isUpdate,
+	}
+	op := OpUpload
+	if isUpdate {
+		item.operation = allocationchange.UPDATE_OPERATION
+		op = OpUpdate
+	}
+	item.prepare = func(connectionID string) ([]allocationchange.AllocationChange, error) {
+		// the file is uploaded again for every connection the item is sent in,
+		// the batch reports the failed item when it's done
+		status := newWaitStatusCB(b.status)
+		uploadReq = newUploadReq(status)
+		uploadReq.connectionID = connectionID
+		if err := uploadReq.applyRemoteAttributes(a); err != nil {
+			return nil, err
+		}
+		_, ok := uploadReq.uploadToBlobbers(a)
+
+		changes := make([]allocationchange.AllocationChange, len(a.Blobbers))
+		var c, pos uint64 = 0, 0
+		for i := uploadReq.uploadMask; !i.Equals64(0); i = i.And(zboxutil.NewUint128(1).Lsh(pos).Not()) {
+			pos = uint64(i.TrailingZeros())
+			// the merkle root is set only when the blobber accepted the file
+			if file := uploadReq.file[c]; file != nil && len(file.MerkleRoot) > 0 {
+				changes[pos] = uploadReq.fileChange(file)
+			}
+			c++
+		}
+		if status.err != nil {
+			return changes, status.err
+		}
+		if !ok {
+			return changes, errors.New("upload_failed", "Upload has been stopped")
+		}
+		if !uploadReq.isConsensusOk() {
+			return changes, errors.New("upload_failed", "Upload failed as there was no consensus")
+		}
+		return changes, nil
+	}
+	item.completed = func(consensus float32) {
+		if b.status == nil {
+			return
+		}
+		perShard := (uploadReq.filemeta.Size + int64(a.DataShards) - 1) / int64(a.DataShards)
+		b.status.Completed(a.ID, remotepath, uploadReq.filemeta.Name,
+			uploadReq.filemeta.MimeType, int(float32(perShard)*consensus), op)
+	}
+	item.failed = func(err error) {
+		if b.status != nil {
+			b.status.Error(a.ID, remotepath, op, err)
+		}
+	}
+	return b.add(item)
+}
+
+// Delete adds the delete of the remote object to the batch.
+func (b *Batch) Delete(remotepath string) error {
+	remotepath, err := batchRemotePath(remotepath)
+	if err != nil {
+		return err
+	}
+	a := b.allocation
+	return b.add(&batchItem{
+		operation:  allocationchange.DELETE_OPERATION,
+		remotePath: remotepath,
+		prepare: func(connectionID string) ([]allocationchange.AllocationChange, error) {
+			req := &DeleteRequest{}
+			req.blobbers = a.Blobbers
+			req.allocationID = a.ID
+			req.allocationTx = a.Tx
+			req.consensusThresh = (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards)
+			req.fullconsensus = float32(a.DataShards + a.ParityShards)
+			req.ctx = a.ctx
+			req.remotefilepath = remotepath
+			req.connectionID = connectionID
+			return req.deleteObject()
+		},
+	})
+}
+
+// Rename adds the rename of the remote object to the batch.
+func (b *Batch) Rename(remotepath, newName string) error {
+	remotepath, err := batchRemotePath(remotepath)
+	if err != nil {
+		return err
+	}
+	if len(newName) == 0 {
+		return errors.New("invalid_name", "Invalid name for the rename")
+	}
+	a := b.allocation
+	return b.add(&batchItem{
+		operation:  allocationchange.RENAME_OPERATION,
+		remotePath: remotepath,
+		prepare: func(connectionID string) ([]allocationchange.AllocationChange, error) {
+			req := &RenameRequest{}
+			req.blobbers = a.Blobbers
+			req.allocationID = a.ID
+			req.allocationTx = a.Tx
+			req.newName = newName
+			req.consensusThresh = (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards)
+			req.fullconsensus = float32(a.DataShards + a.ParityShards)
+			req.ctx = a.ctx
+			req.remotefilepath = remotepath
+			req.connectionID = connectionID
+			return req.renameObject()
+		},
+	})
+}
+
+// Copy adds the copy of the remote object to the destPath to the batch.
+func (b *Batch) Copy(remotepath, destPath string) error {
+	remotepath, err := batchRemotePath(remotepath)
+	if err != nil {
+		return err
+	}
+	if len(destPath) == 0 {
+		return errors.New("invalid_path", "Invalid path for copy")
+	}
+	a := b.allocation
+	return b.add(&batchItem{
+		operation:  allocationchange.COPY_OPERATION,
+		remotePath: remotepath,
+		prepare: func(connectionID string) ([]allocationchange.AllocationChange, error) {
+			req := &CopyRequest{}
+			req.blobbers = a.Blobbers
+			req.allocationID = a.ID
+			req.allocationTx = a.Tx
+			req.destPath = destPath
+			req.consensusThresh = (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards)
+			req.fullconsensus = float32(a.DataShards + a.ParityShards)
+			req.ctx = a.ctx
+			req.remotefilepath = remotepath
+			req.connectionID = connectionID
+			return req.copyObject()
+		},
+	})
+}
+
+// Commit sends the operations to the blobbers and commits them with one
+// write marker per blobber. It returns the result of every operation in the
+// order they've been added. A failed operation isn't committed: when some
+// blobbers have accepted it, the other operations are sent again in a new
+// connection without it. An upload without commit consensus is deleted
+// afterwards. The error is set when the commit itself has failed.
+func (b *Batch) Commit() ([]*BatchResult, error) {
+	a := b.allocation
+	if !a.isInitialized() {
+		return nil, notInitialized
+	}
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if b.committed {
+		return nil, errors.New("batch_committed", "Batch has been committed already")
+	}
+	if len(b.items) == 0 {
+		return nil, errors.New("empty_batch", "No operations in the batch")
+	}
+	b.committed = true
+
+	pending := b.items
+	for len(pending) > 0 {
+		var prepared []*batchItem
+		dropped := false
+		for _, item := range pending {
+			item.changes, item.err = item.prepare(b.connectionID)
+			if item.err == nil {
+				prepared = append(prepared, item)
+				continue
+			}
+			Logger.Error("Batch ", item.operation, " ", item.remotePath, " failed: ", item.err)
+			for _, change := range item.changes {
+				dropped = dropped || change != nil
+			}
+			item.changes = nil
+		}
+		if !dropped {
+			break
+		}
+		// the blobbers which accepted a failed operation have it in the
+		// connection, which is left uncommitted
+		pending = prepared
+		b.connectionID = zboxutil.NewConnectionId()
+	}
+
+	commitReqs := make([]*CommitRequest, len(a.Blobbers))
+	wg := &sync.WaitGroup{}
+	for pos, blobber := range a.Blobbers {
+		commitReq := &CommitRequest{}
+		for _, item := range b.items {
+			if item.changes != nil && item.changes[pos] != nil {
+				commitReq.changes = append(commitReq.changes, item.changes[pos])
+			}
+		}
+		if len(commitReq.changes) == 0 {
+			continue
+		}
+		commitReq.allocationID = a.ID
+		commitReq.allocationTx = a.Tx
+		commitReq.blobber = blobber
+		commitReq.connectionID = b.connectionID
+		commitReq.wg = wg
+		commitReqs[pos] = commitReq
+		wg.Add(1)
+		go AddCommitRequest(commitReq)
+	}
+	wg.Wait()
+
+	committed := make([]bool, len(a.Blobbers))
+	batchConsensus := Consensus{
+		consensusThresh: (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards),
+		fullconsensus:   float32(a.DataShards + a.ParityShards),
+	}
+	for pos, commitReq := range commitReqs {
+		if commitReq == nil {
+			continue
+		}
+		if commitReq.result != nil && commitReq.result.Success {
+			Logger.Info("Commit success", commitReq.blobber.Baseurl)
+			committed[pos] = true
+			batchConsensus.consensus++
+		} else if commitReq.result != nil {
+			Logger.Info("Commit failed", commitReq.blobber.Baseurl, commitReq.result.ErrorMessage)
+		} else {
+			Logger.Info("Commit result not set", commitReq.blobber.Baseurl)
+		}
+	}
+
+	results := make([]*BatchResult, len(b.items))
+	for i, item := range b.items {
+		itemConsensus := batchConsensus
+		itemConsensus.consensus = 0
+		for pos := range a.Blobbers {
+			if committed[pos] && item.changes != nil && item.changes[pos] != nil {
+				itemConsensus.consensus++
+			}
+		}
+		result := &BatchResult{Operation: item.operation, RemotePath: item.remotePath}
+		switch {
+		case item.err != nil:
+			result.ErrorMessage = item.err.Error()
+		case !itemConsensus.isConsensusOk():
+			result.ErrorMessage = "Commit consensus failed"
+		default:
+			result.Success = true
+		}
+		results[i] = result
+
+		if result.Success {
+			if item.completed != nil {
+				item.completed(itemConsensus.consensus)
+			}
+			continue
+		}
+		if item.isInsert && itemConsensus.consensus != 0 {
+			Logger.Info("Batch upload failed, Deleting remote file ", item.remotePath)
+			a.deleteFile(item.remotePath, itemConsensus.consensus, itemConsensus.consensus)
+		}
+		if item.failed != nil {
+			item.failed(errors.New("batch_failed", result.ErrorMessage))
+		}
+	}
+
+	if !batchConsensus.isConsensusOk() {
+		return results, errors.New("commit_consensus_failed", "Batch failed as there was no commit consensus")
+	}
+	return results, nil
+}
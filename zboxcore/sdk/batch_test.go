@@ -0,0 +1,260 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/allocationchange"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch_Commit(t *testing.T) {
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	tests := []struct {
+		name    string
+		setup   func(*testing.T, string, *Allocation, *Batch)
+		wantErr bool
+		errMsg  string
+		results []*BatchResult
+	}{
+		{
+			name:    "Test_Empty_Batch_Failed",
+			wantErr: true,
+			errMsg:  "empty_batch: No operations in the batch",
+		},
+		{
+			name: "Test_Invalid_Path_Failed",
+			setup: func(t *testing.T, testCaseName string, a *Allocation, b *Batch) {
+				require.Error(t, b.Delete("abc"))
+				require.Error(t, b.Copy("/1.txt", ""))
+				require.Error(t, b.Rename("/1.txt", ""))
+				require.EqualValues(t, 0, b.Len())
+			},
+			wantErr: true,
+			errMsg:  "empty_batch: No operations in the batch",
+		},
+		{
+			name: "Test_Success",
+			setup: func(t *testing.T, testCaseName string, a *Allocation, b *Batch) {
+				body, err := json.Marshal(&fileref.ReferencePath{
+					Meta: map[string]interface{}{
+						"type": fileref.FILE,
+					},
+				})
+				require.NoError(t, err)
+				for i := 0; i < 2; i++ {
+					setupMockHttpResponse(t, &mockClient, "TestBatch_Commit", testCaseName, a, http.MethodGet, http.StatusOK, body)
+					setupMockHttpResponse(t, &mockClient, "TestBatch_Commit", testCaseName, a, http.MethodPost, http.StatusOK, []byte(""))
+				}
+				setupMockCommitRequest(a)
+				require.NoError(t, b.Copy("/1.txt", "/d"))
+				require.NoError(t, b.Rename("/2.txt", "3.txt"))
+			},
+			results: []*BatchResult{
+				{Operation: allocationchange.COPY_OPERATION, RemotePath: "/1.txt", Success: true},
+				{Operation: allocationchange.RENAME_OPERATION, RemotePath: "/2.txt", Success: true},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			a := &Allocation{
+				DataShards:   2,
+				ParityShards: 2,
+			}
+			a.InitAllocation()
+			sdkInitialized = true
+			for i := 0; i < numBlobbers; i++ {
+				a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+					ID:      tt.name + mockBlobberId + strconv.Itoa(i),
+					Baseurl: "TestBatch_Commit" + tt.name + mockBlobberUrl + strconv.Itoa(i),
+				})
+			}
+			b := a.NewBatch(nil)
+			if tt.setup != nil {
+				tt.setup(t, tt.name, a, b)
+			}
+			results, err := b.Commit()
+			require.EqualValues(tt.wantErr, err != nil)
+			if err != nil {
+				require.EqualValues(tt.errMsg, errors.Top(err))
+				return
+			}
+			require.EqualValues(tt.results, results)
+
+			_, err = b.Commit()
+			require.Error(err)
+			require.Error(b.Delete("/1.txt"))
+		})
+	}
+}
+
+func TestBatch_Commit_Failed_Item(t *testing.T) {
+	require := require.New(t)
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	body, err := json.Marshal(&fileref.ReferencePath{
+		Meta: map[string]interface{}{
+			"type": fileref.FILE,
+		},
+	})
+	require.NoError(err)
+	// only the first blobber accepts the rename
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name())
+	})).Return(func(req *http.Request) *http.Response {
+		if req.Method == http.MethodGet {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader(body)),
+			}
+		}
+		statusCode := http.StatusOK
+		if err := req.ParseMultipartForm(1024); err == nil && req.FormValue("path") == "/2.txt" &&
+			!strings.HasPrefix(req.URL.Path, t.Name()+mockBlobberUrl+"0") {
+			statusCode = http.StatusBadRequest
+		}
+		return &http.Response{
+			StatusCode: statusCode,
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}
+	}, nil)
+
+	a := &Allocation{
+		DataShards:   2,
+		ParityShards: 2,
+	}
+	a.InitAllocation()
+	sdkInitialized = true
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      t.Name() + mockBlobberId + strconv.Itoa(i),
+			Baseurl: t.Name() + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+
+	var mutex sync.Mutex
+	var commits []*CommitRequest
+	commitChan = make(map[string]chan *CommitRequest)
+	for _, blobber := range a.Blobbers {
+		blobberChan := make(chan *CommitRequest, 1)
+		commitChan[blobber.ID] = blobberChan
+		go func() {
+			for commitReq := range blobberChan {
+				mutex.Lock()
+				commits = append(commits, commitReq)
+				mutex.Unlock()
+				commitReq.result = &CommitResult{Success: true}
+				commitReq.wg.Done()
+			}
+		}()
+	}
+	defer func() {
+		for _, blobberChan := range commitChan {
+			close(blobberChan)
+		}
+	}()
+
+	b := a.NewBatch(nil)
+	connectionID := b.connectionID
+	require.NoError(b.Copy("/1.txt", "/d"))
+	require.NoError(b.Rename("/2.txt", "3.txt"))
+	results, err := b.Commit()
+	require.NoError(err)
+	require.True(results[0].Success)
+	require.False(results[1].Success)
+
+	// the rename accepted by the first blobber is left in the first connection
+	require.Len(commits, numBlobbers)
+	for _, commitReq := range commits {
+		require.NotEqual(connectionID, commitReq.connectionID)
+		require.Len(commitReq.changes, 1)
+		require.IsType(&allocationchange.CopyFileChange{}, commitReq.changes[0])
+	}
+}
+
+func TestBatch_Commit_Locked_Update(t *testing.T) {
+	require := require.New(t)
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+	getFileInfo := GetFileInfo
+	GetFileInfo = os.Stat
+	defer func() { GetFileInfo = getFileInfo }()
+
+	// the blobbers list the file locked, nothing is uploaded
+	body, err := json.Marshal(&fileref.FileRef{
+		Ref:        fileref.Ref{Type: fileref.FILE, Path: "/1.txt"},
+		Attributes: fileref.Attributes{Locked: true},
+	})
+	require.NoError(err)
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.Contains(req.URL.Path, zboxutil.FILE_META_ENDPOINT)
+	})).Return(func(*http.Request) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+
+	a := &Allocation{
+		DataShards:   2,
+		ParityShards: 2,
+	}
+	a.InitAllocation()
+	sdkInitialized = true
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      t.Name() + mockBlobberId + strconv.Itoa(i),
+			Baseurl: t.Name() + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+	localPath := filepath.Join(t.TempDir(), "1.txt")
+	require.NoError(ioutil.WriteFile(localPath, []byte("new"), 0644))
+
+	b := a.NewBatch(nil)
+	require.NoError(b.Update(localPath, "/1.txt", fileref.Attributes{}))
+	results, err := b.Commit()
+	require.Error(err)
+	require.Len(results, 1)
+	require.False(results[0].Success)
+	require.EqualValues("file_locked: /1.txt is locked by its attributes", results[0].ErrorMessage)
+}
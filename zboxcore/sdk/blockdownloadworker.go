@@ -72,6 +72,28 @@ func setBlobberReadCtr(blobber *blockchain.StorageNode, ctr int64) {
 	blobberReadCounter.Store(blobber.ID, ctr)
 }
 
+// blobberLatency keeps the moving average of the block download time of the
+// blobbers, it ranks the blobbers for the downloads.
+var blobberLatency sync.Map
+
+// blobberFailureLatency is the latency recorded for a failed block download.
+const blobberFailureLatency = 30 * time.Second
+
+func getBlobberLatency(blobber *blockchain.StorageNode) (time.Duration, bool) {
+	latency, ok := blobberLatency.Load(blobber.ID)
+	if !ok {
+		return 0, false
+	}
+	return latency.(time.Duration), true
+}
+
+func observeBlobberLatency(blobber *blockchain.StorageNode, latency time.Duration) {
+	if prev, ok := getBlobberLatency(blobber); ok {
+		latency = (prev*7 + latency*3) / 10
+	}
+	blobberLatency.Store(blobber.ID, latency)
+}
+
 var downloadBlockChan map[string]chan *BlockDownloadRequest
 var initDownloadMutex sync.Mutex
 
@@ -183,6 +205,7 @@ func (req *BlockDownloadRequest) downloadBlobberBlock() {
 		// TODO: Fix the timeout
 		ctx, cncl := context.WithTimeout(req.ctx, (time.Second * 30))
 		shouldRetry := false
+		start := time.Now()
 		err = zboxutil.HttpDo(ctx, cncl, httpreq, func(resp *http.Response, err error) error {
 			if err != nil {
 				return err
@@ -218,6 +241,7 @@ func (req *BlockDownloadRequest) downloadBlobberBlock() {
 					}
 					rspData.RawData = []byte{}
 					incBlobberReadCtr(req.blobber, req.numBlocks)
+					observeBlobberLatency(req.blobber, time.Since(start)/time.Duration(req.numBlocks))
 					req.result <- &rspData
 					return nil
 					// return errors.Wrap(err, fmt.Sprintf("[%d] Json decode error:\n", req.blobberIdx))
@@ -254,6 +278,11 @@ func (req *BlockDownloadRequest) downloadBlobberBlock() {
 			return nil
 		})
 		if err != nil && (!shouldRetry || retry >= 3) {
+			// the download scores the requests cancelled once the block was
+			// complete
+			if req.ctx.Err() == nil {
+				observeBlobberLatency(req.blobber, blobberFailureLatency)
+			}
 			req.result <- &downloadBlock{Success: false, idx: req.blobberIdx, err: err}
 		}
 		if shouldRetry {
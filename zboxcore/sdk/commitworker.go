@@ -264,7 +264,11 @@ func (req *CommitRequest) commitBlobber(rootRef *fileref.Ref, latestWM *marker.W
 		}
 		return nil
 	})
-	return err
+	if err != nil {
+		return err
+	}
+	updateMetaCache(req, latestWM, wm.AllocationRoot)
+	return nil
 }
 
 func AddCommitRequest(req *CommitRequest) {
@@ -99,3 +99,105 @@ func getAllocationDataFromBlobber(blobber *blockchain.StorageNode, allocationTx
 	respCh <- &result
 	return
 }
+
+var errFileLocked = errors.New("file_locked", "")
+
+// checkUnlocked returns an error for the object locked by its attributes.
+func checkUnlocked(ref fileref.RefEntity) error {
+	if attrs := ref.GetAttributes(); attrs.Locked {
+		return errors.New(errFileLocked.Code, ref.GetPath()+" is locked by its attributes")
+	}
+	return nil
+}
+
+// lockedError returns the first of the errors for a locked object, if any.
+func lockedError(errs []error) error {
+	return firstErrorOf(errs, errFileLocked)
+}
+
+var errMoveDir = errors.New("move_dir", "")
+
+// checkMovable returns an error for the object MoveObject can't move in one
+// request, a locked one or a directory with children which MoveDir moves.
+func checkMovable(ref fileref.RefEntity) error {
+	if err := checkUnlocked(ref); err != nil {
+		return err
+	}
+	if dir, ok := ref.(*fileref.Ref); ok && len(dir.Children) > 0 {
+		return errors.New(errMoveDir.Code, ref.GetPath()+" isn't empty, it's moved by MoveDir")
+	}
+	return nil
+}
+
+// firstErrorOf returns the first of the errors which is the target, if any.
+func firstErrorOf(errs []error, target error) error {
+	for _, err := range errs {
+		if err != nil && errors.Is(err, target) {
+			return err
+		}
+	}
+	return nil
+}
+
+// waitStatusCB is the status callback of a single file operation run on
+// behalf of another one, like the files of a directory transfer. It forwards
+// the progress to the status of the caller and keeps the outcome, which the
+// caller waits for. The errors aren't forwarded, the caller reports them in
+// its own terms.
+type waitStatusCB struct {
+	status StatusCallback
+	// progress gets the progress of the operation, when set
+	progress func(completed, total int)
+	wg       sync.WaitGroup
+	once     sync.Once
+	total    int
+	err      error
+}
+
+func newWaitStatusCB(status StatusCallback) *waitStatusCB {
+	cb := &waitStatusCB{status: status}
+	cb.wg.Add(1)
+	return cb
+}
+
+func (cb *waitStatusCB) CommitMetaCompleted(request, response string, err error) {
+}
+
+func (cb *waitStatusCB) Started(allocationId, filePath string, op int, totalBytes int) {
+	cb.total = totalBytes
+	if cb.status != nil {
+		cb.status.Started(allocationId, filePath, op, totalBytes)
+	}
+}
+
+func (cb *waitStatusCB) InProgress(allocationId, filePath string, op int, completedBytes int, data []byte) {
+	if cb.progress != nil {
+		cb.progress(completedBytes, cb.total)
+	}
+	if cb.status != nil {
+		cb.status.InProgress(allocationId, filePath, op, completedBytes, data)
+	}
+}
+
+func (cb *waitStatusCB) RepairCompleted(filesRepaired int) {
+}
+
+func (cb *waitStatusCB) Completed(allocationId, filePath string, filename string, mimetype string, size int, op int) {
+	if cb.status != nil {
+		cb.status.Completed(allocationId, filePath, filename, mimetype, size, op)
+	}
+	cb.once.Do(cb.wg.Done)
+}
+
+func (cb *waitStatusCB) Error(allocationID string, filePath string, op int, err error) {
+	cb.once.Do(func() {
+		cb.err = err
+		cb.wg.Done()
+	})
+}
+
+// wait returns the outcome of the operation.
+func (cb *waitStatusCB) wait() error {
+	cb.wg.Wait()
+	return cb.err
+}
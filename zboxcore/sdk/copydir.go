@@ -0,0 +1,390 @@
+package sdk
+
+import (
+	"path"
+	"strings"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// CopyConflict is what CopyDir and MoveDir do with the objects already at
+// the destination.
+type CopyConflict int
+
+const (
+	// CopyConflictFail fails before changing anything when the destination
+	// exists.
+	CopyConflictFail CopyConflict = iota
+	// CopyConflictOverwrite merges the directories and replaces the objects
+	// at the destination by the source ones.
+	CopyConflictOverwrite
+	// CopyConflictMerge merges the directories and keeps the files at the
+	// destination, the source ones are skipped. A move keeps the skipped
+	// files at the source.
+	CopyConflictMerge
+)
+
+// dirCopy is a recursive copy or move of CopyDir and MoveDir.
+type dirCopy struct {
+	conflict CopyConflict
+	status   StatusCallback
+	move     bool
+}
+
+// CopyOption configures CopyDir and MoveDir.
+type CopyOption func(dc *dirCopy)
+
+// WithCopyConflict sets what to do with the objects already at the
+// destination, CopyConflictFail by default.
+func WithCopyConflict(conflict CopyConflict) CopyOption {
+	return func(dc *dirCopy) {
+		dc.conflict = conflict
+	}
+}
+
+// WithCopyStatus reports the progress to the status callback, in bytes of
+// the files copied.
+func WithCopyStatus(status StatusCallback) CopyOption {
+	return func(dc *dirCopy) {
+		dc.status = status
+	}
+}
+
+// copyStep copies a source file, or creates a directory, at the dest.
+type copyStep struct {
+	src  *ListResult
+	dest string
+	// replace deletes the object at the dest first
+	replace bool
+}
+
+// copyPlan is the steps of a recursive copy, in the order of the walk of
+// the source so the directories are created before their content.
+type copyPlan struct {
+	steps []*copyStep
+	// skipped is the source files kept by a merge
+	skipped map[string]bool
+	size    int64
+}
+
+// planCopy plans the copy of the source entries, the source root first, to
+// the target given the entries existing there by path.
+func planCopy(src, target string, entries []*ListResult, existing map[string]*ListResult,
+	conflict CopyConflict) (*copyPlan, error) {
+
+	if conflict == CopyConflictFail && len(existing) > 0 {
+		return nil, errors.New("copy_conflict", target+" already exists")
+	}
+	plan := &copyPlan{skipped: make(map[string]bool)}
+	for _, entry := range entries {
+		dest := target + strings.TrimPrefix(entry.Path, src)
+		found, ok := existing[dest]
+		step := &copyStep{src: entry, dest: dest}
+		switch {
+		case !ok:
+		case entry.Type == fileref.DIRECTORY && found.Type == fileref.DIRECTORY:
+			continue
+		case conflict == CopyConflictOverwrite:
+			step.replace = true
+		case entry.Type == fileref.FILE && found.Type == fileref.FILE:
+			plan.skipped[entry.Path] = true
+			continue
+		default:
+			return nil, errors.New("copy_conflict", dest+" can't be merged, it's not a "+typeName(entry.Type))
+		}
+		plan.steps = append(plan.steps, step)
+		if entry.Type == fileref.FILE {
+			plan.size += entry.ActualSize
+		}
+	}
+	return plan, nil
+}
+
+func typeName(refType string) string {
+	if refType == fileref.DIRECTORY {
+		return "directory"
+	}
+	return "file"
+}
+
+// movedSources returns the source paths a move deletes once copied, the
+// source root first. The directories are deleted as a whole, but the ones
+// holding skipped files, of which only the moved files are deleted.
+func movedSources(entries []*ListResult, skipped map[string]bool) []string {
+	kept := make(map[string]bool)
+	for p := range skipped {
+		for dir := p; dir != "/"; {
+			dir = path.Dir(dir)
+			kept[dir] = true
+		}
+	}
+	var deletes []string
+	deleted := make(map[string]bool)
+	for _, entry := range entries {
+		if deleted[path.Dir(entry.Path)] {
+			deleted[entry.Path] = true
+			continue
+		}
+		if kept[entry.Path] || skipped[entry.Path] {
+			continue
+		}
+		deletes = append(deletes, entry.Path)
+		deleted[entry.Path] = true
+	}
+	return deletes
+}
+
+// listTree lists the tree at the root, the root first. It's empty when the
+// root doesn't exist.
+func (a *Allocation) listTree(root string) ([]*ListResult, error) {
+	ref, err := a.listDirAll(root)
+	if err != nil {
+		return nil, err
+	}
+	switch ref.Type {
+	case "":
+		return nil, nil
+	case fileref.FILE:
+		ref.Path = root
+		return []*ListResult{ref}, nil
+	}
+	var entries []*ListResult
+	err = a.walkRoot(root, ref, func(remotePath string, entry *ListResult, err error) error {
+		if err != nil {
+			return err
+		}
+		entry.Path = remotePath
+		entries = append(entries, entry)
+		return nil
+	})
+	return entries, err
+}
+
+// CopyDir copies the file or the directory at the path, with all its
+// content, into the destination directory. The files are copied one by one,
+// with the conflicts at the destination handled as set by the options. A
+// failed copy deletes the objects it copied and leaves the destination as it
+// was: the objects replacing others are copied in the .copydir staging dirs
+// next to them, and moved over them once everything is copied.
+func (a *Allocation) CopyDir(path string, destPath string, opts ...CopyOption) error {
+	dc := &dirCopy{}
+	for _, opt := range opts {
+		opt(dc)
+	}
+	return a.copyDir(path, destPath, dc)
+}
+
+// MoveDir moves the file or the directory at the path, with all its content,
+// into the destination directory. The source is deleted once all of it is
+// copied, a move failing before deletes the objects it copied and leaves the
+// source as it was. A move failing while deleting the source leaves the
+// objects in both places.
+func (a *Allocation) MoveDir(path string, destPath string, opts ...CopyOption) error {
+	dc := &dirCopy{move: true}
+	for _, opt := range opts {
+		opt(dc)
+	}
+	return a.copyDir(path, destPath, dc)
+}
+
+func (a *Allocation) copyDir(src string, destPath string, dc *dirCopy) error {
+	if !a.isInitialized() {
+		return notInitialized
+	}
+	if len(src) == 0 || len(destPath) == 0 {
+		return errors.New("invalid_path", "Invalid path for copy")
+	}
+	src = zboxutil.RemoteClean(src)
+	destPath = zboxutil.RemoteClean(destPath)
+	if !zboxutil.IsRemoteAbs(src) || !zboxutil.IsRemoteAbs(destPath) || src == "/" {
+		return errors.New("invalid_path", "Path should be valid and absolute")
+	}
+	target := zboxutil.Join(destPath, path.Base(src))
+	if target == src || strings.HasPrefix(target, src+"/") {
+		return errors.New("invalid_path", "Destination can't be the source or in it")
+	}
+
+	entries, err := a.listTree(src)
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return errors.New("file_not_found", src+" not found")
+	}
+	if dc.move {
+		for _, entry := range entries {
+			if entry.Attributes.Locked {
+				return errors.New("file_locked", entry.Path+" is locked by its attributes")
+			}
+		}
+	}
+	dest, err := a.listDirAll(destPath)
+	if err != nil {
+		return err
+	}
+	if dest.Type != fileref.DIRECTORY {
+		return errors.New("invalid_path", "Destination should be an existing directory")
+	}
+	found, err := a.listTree(target)
+	if err != nil {
+		return err
+	}
+	existing := make(map[string]*ListResult, len(found))
+	for _, entry := range found {
+		existing[entry.Path] = entry
+	}
+	plan, err := planCopy(src, target, entries, existing, dc.conflict)
+	if err != nil {
+		return err
+	}
+
+	op := OpCopy
+	if dc.move {
+		op = OpMove
+	}
+	if dc.status != nil {
+		dc.status.Started(a.ID, src, op, int(plan.size))
+	}
+	if err = a.runCopyPlan(plan, dc, op); err != nil {
+		if dc.status != nil {
+			dc.status.Error(a.ID, src, op, err)
+		}
+		return err
+	}
+	if dc.move {
+		for _, p := range movedSources(entries, plan.skipped) {
+			if err = a.DeleteFile(p); err != nil {
+				err = errors.Wrap(err, "the source is copied but not fully deleted")
+				if dc.status != nil {
+					dc.status.Error(a.ID, src, op, err)
+				}
+				return err
+			}
+		}
+	}
+	if dc.status != nil {
+		dc.status.Completed(a.ID, src, path.Base(src), "", int(plan.size), op)
+	}
+	return nil
+}
+
+// copyStaging stages the objects of a copy replacing others. They're copied
+// in a staging dir next to their destination, and moved over it once all the
+// steps succeed, so a failed copy leaves the destination as it was.
+type copyStaging struct {
+	name string
+	// dirs are the staging dirs by the dir of the destinations in them
+	dirs map[string]string
+	// staged are the staged objects, in the order of the plan
+	staged []*stagedObject
+}
+
+type stagedObject struct {
+	dest   string
+	staged string
+}
+
+func newCopyStaging() *copyStaging {
+	return &copyStaging{
+		name: ".copydir-" + zboxutil.NewConnectionId(),
+		dirs: make(map[string]string),
+	}
+}
+
+// destOf returns where the step copies to: the staging dir for the objects
+// replacing others and the content of the staged directories, the dest of
+// the step otherwise. The staging dirs are created with mkdir.
+func (s *copyStaging) destOf(step *copyStep, mkdir func(dir string) error) (string, error) {
+	if !step.replace {
+		for _, obj := range s.staged {
+			if strings.HasPrefix(step.dest, obj.dest+"/") {
+				return obj.staged + strings.TrimPrefix(step.dest, obj.dest), nil
+			}
+		}
+		return step.dest, nil
+	}
+	parent := path.Dir(step.dest)
+	dir, ok := s.dirs[parent]
+	if !ok {
+		dir = zboxutil.Join(parent, s.name)
+		if err := mkdir(dir); err != nil {
+			return "", err
+		}
+		s.dirs[parent] = dir
+	}
+	obj := &stagedObject{dest: step.dest, staged: zboxutil.Join(dir, path.Base(step.dest))}
+	s.staged = append(s.staged, obj)
+	return obj.staged, nil
+}
+
+// runCopyPlan runs the steps of the plan, deleting what it copied when a
+// step fails. The staged objects are then moved over their destinations.
+func (a *Allocation) runCopyPlan(plan *copyPlan, dc *dirCopy, op int) error {
+	var copied []string
+	var completed int64
+	staging := newCopyStaging()
+	for _, step := range plan.steps {
+		dest, err := staging.destOf(step, a.CreateDir)
+		if err == nil {
+			err = a.runCopyStep(step, dest, dc.move)
+		}
+		if err != nil {
+			a.rollbackCopy(copied, staging)
+			return errors.Wrap(err, "copy of "+step.src.Path+" failed")
+		}
+		// the staged objects go with the staging dirs
+		if dest == step.dest {
+			copied = append(copied, dest)
+		}
+		if step.src.Type == fileref.FILE && dc.status != nil {
+			completed += step.src.ActualSize
+			dc.status.InProgress(a.ID, step.src.Path, op, int(completed), nil)
+		}
+	}
+	return a.commitStaging(staging)
+}
+
+func (a *Allocation) runCopyStep(step *copyStep, dest string, move bool) error {
+	if step.src.Type == fileref.DIRECTORY {
+		return a.CreateDir(dest)
+	}
+	return a.copyObject(step.src.Path, path.Dir(dest), move)
+}
+
+// commitStaging replaces the destinations by their staged objects and
+// deletes the staging dirs. A staged object which can't be moved over its
+// destination is kept in the staging dir.
+func (a *Allocation) commitStaging(staging *copyStaging) error {
+	for _, obj := range staging.staged {
+		if err := a.DeleteFile(obj.dest); err != nil {
+			return errors.Wrap(err, "the copy is staged at "+obj.staged)
+		}
+		if err := a.copyObject(obj.staged, path.Dir(obj.dest), false); err != nil {
+			return errors.Wrap(err, obj.dest+" is deleted, its copy is staged at "+obj.staged)
+		}
+	}
+	a.deleteStaging(staging)
+	return nil
+}
+
+// rollbackCopy deletes the copied paths, the last first so the content of
+// the directories goes before them, then the staging dirs.
+func (a *Allocation) rollbackCopy(copied []string, staging *copyStaging) {
+	for i := len(copied) - 1; i >= 0; i-- {
+		if err := a.DeleteFile(copied[i]); err != nil {
+			Logger.Error("Copy rollback of ", copied[i], " failed: ", err)
+		}
+	}
+	a.deleteStaging(staging)
+}
+
+func (a *Allocation) deleteStaging(staging *copyStaging) {
+	for _, dir := range staging.dirs {
+		if err := a.DeleteFile(dir); err != nil {
+			Logger.Error("Copy staging dir ", dir, " delete failed: ", err)
+		}
+	}
+}
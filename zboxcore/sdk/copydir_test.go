@@ -0,0 +1,169 @@
+package sdk
+
+import (
+	"testing"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPlanCopy(t *testing.T) {
+	entries := []*ListResult{
+		{Path: "/s", Type: fileref.DIRECTORY},
+		{Path: "/s/1.txt", Type: fileref.FILE, ActualSize: 10},
+		{Path: "/s/d", Type: fileref.DIRECTORY},
+		{Path: "/s/d/2.txt", Type: fileref.FILE, ActualSize: 20},
+	}
+	existing := map[string]*ListResult{
+		"/t/s":       {Type: fileref.DIRECTORY},
+		"/t/s/1.txt": {Type: fileref.FILE},
+		"/t/s/d":     {Type: fileref.FILE},
+	}
+
+	type step struct {
+		dest    string
+		replace bool
+	}
+	tests := []struct {
+		name        string
+		existing    map[string]*ListResult
+		conflict    CopyConflict
+		wantSteps   []step
+		wantSkipped []string
+		wantSize    int64
+		wantErr     bool
+	}{
+		{
+			name:     "Test_New_Destination",
+			conflict: CopyConflictFail,
+			wantSteps: []step{
+				{dest: "/t/s"}, {dest: "/t/s/1.txt"}, {dest: "/t/s/d"}, {dest: "/t/s/d/2.txt"},
+			},
+			wantSize: 30,
+		},
+		{
+			name:     "Test_Existing_Destination_Failed",
+			existing: existing,
+			conflict: CopyConflictFail,
+			wantErr:  true,
+		},
+		{
+			name:     "Test_Overwrite",
+			existing: existing,
+			conflict: CopyConflictOverwrite,
+			wantSteps: []step{
+				{dest: "/t/s/1.txt", replace: true}, {dest: "/t/s/d", replace: true}, {dest: "/t/s/d/2.txt"},
+			},
+			wantSize: 30,
+		},
+		{
+			name: "Test_Merge",
+			existing: map[string]*ListResult{
+				"/t/s":       {Type: fileref.DIRECTORY},
+				"/t/s/1.txt": {Type: fileref.FILE},
+			},
+			conflict: CopyConflictMerge,
+			wantSteps: []step{
+				{dest: "/t/s/d"}, {dest: "/t/s/d/2.txt"},
+			},
+			wantSkipped: []string{"/s/1.txt"},
+			wantSize:    20,
+		},
+		{
+			name:     "Test_Merge_File_With_Directory_Failed",
+			existing: existing,
+			conflict: CopyConflictMerge,
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			plan, err := planCopy("/s", "/t/s", entries, tt.existing, tt.conflict)
+			require.EqualValues(tt.wantErr, err != nil, "%v", err)
+			if err != nil {
+				return
+			}
+			var steps []step
+			for _, s := range plan.steps {
+				steps = append(steps, step{dest: s.dest, replace: s.replace})
+			}
+			require.EqualValues(tt.wantSteps, steps)
+			var skipped []string
+			for p := range plan.skipped {
+				skipped = append(skipped, p)
+			}
+			require.EqualValues(tt.wantSkipped, skipped)
+			require.EqualValues(tt.wantSize, plan.size)
+		})
+	}
+}
+
+func TestCopyStaging_destOf(t *testing.T) {
+	var created []string
+	mkdir := func(dir string) error {
+		created = append(created, dir)
+		return nil
+	}
+	staging := newCopyStaging()
+	steps := []*copyStep{
+		{dest: "/t/s/1.txt", replace: true},
+		{dest: "/t/s/d", replace: true},
+		{dest: "/t/s/d/2.txt"},
+		{dest: "/t/s/e"},
+		{dest: "/t/s/e/3.txt", replace: true},
+	}
+	var dests []string
+	for _, step := range steps {
+		dest, err := staging.destOf(step, mkdir)
+		require.NoError(t, err)
+		dests = append(dests, dest)
+	}
+	stage := func(dir string) string { return dir + "/" + staging.name }
+	require.EqualValues(t, []string{
+		stage("/t/s") + "/1.txt",
+		stage("/t/s") + "/d",
+		stage("/t/s") + "/d/2.txt",
+		"/t/s/e",
+		stage("/t/s/e") + "/3.txt",
+	}, dests)
+	require.EqualValues(t, []string{stage("/t/s"), stage("/t/s/e")}, created)
+	require.Len(t, staging.staged, 3)
+	require.EqualValues(t, "/t/s/d", staging.staged[1].dest)
+
+	_, err := newCopyStaging().destOf(steps[0], func(string) error {
+		return errors.New("create_dir_failed", "failed")
+	})
+	require.Error(t, err)
+}
+
+func TestMovedSources(t *testing.T) {
+	entries := []*ListResult{
+		{Path: "/s", Type: fileref.DIRECTORY},
+		{Path: "/s/1.txt", Type: fileref.FILE},
+		{Path: "/s/d", Type: fileref.DIRECTORY},
+		{Path: "/s/e", Type: fileref.DIRECTORY},
+		{Path: "/s/d/2.txt", Type: fileref.FILE},
+		{Path: "/s/d/3.txt", Type: fileref.FILE},
+		{Path: "/s/e/4.txt", Type: fileref.FILE},
+	}
+	require.EqualValues(t, []string{"/s"}, movedSources(entries, nil))
+	require.EqualValues(t, []string{"/s/1.txt", "/s/e", "/s/d/3.txt"},
+		movedSources(entries, map[string]bool{"/s/d/2.txt": true}))
+}
+
+func TestAllocation_CopyDir(t *testing.T) {
+	a := &Allocation{DataShards: 2, ParityShards: 2}
+	setupMockAllocation(t, a)
+
+	for _, paths := range [][2]string{
+		{"/", "/t"},
+		{"/s", "/s"},
+		{"/s", "/s/d"},
+		{"s", "/t"},
+	} {
+		require.Error(t, a.CopyDir(paths[0], paths[1]), "%v", paths)
+		require.Error(t, a.MoveDir(paths[0], paths[1]), "%v", paths)
+	}
+}
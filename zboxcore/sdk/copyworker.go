@@ -30,6 +30,9 @@ type CopyRequest struct {
 	wg             *sync.WaitGroup
 	copyMask       uint32
 	connectionID   string
+	// unlockedOnly fails the copy of a locked object or of a directory with
+	// children, the moves set it as they delete the object after the copy
+	unlockedOnly bool
 	Consensus
 }
 
@@ -42,6 +45,11 @@ func (req *CopyRequest) copyBlobberObject(blobber *blockchain.StorageNode, blobb
 	if err != nil {
 		return nil, err
 	}
+	if req.unlockedOnly {
+		if err := checkMovable(refEntity); err != nil {
+			return nil, err
+		}
+	}
 
 	body := new(bytes.Buffer)
 	formWriter := multipart.NewWriter(body)
@@ -85,9 +93,14 @@ func (req *CopyRequest) copyBlobberObject(blobber *blockchain.StorageNode, blobb
 	return refEntity, nil
 }
 
-func (req *CopyRequest) ProcessCopy() error {
+// copyObject copys the object on the blobbers in the request connection
+// without committing it. The returned changes are indexed by the blobber
+// position, nil for the blobbers which haven't copied the object; they're
+// returned on a consensus failure too.
+func (req *CopyRequest) copyObject() ([]allocationchange.AllocationChange, error) {
 	numList := len(req.blobbers)
 	objectTreeRefs := make([]fileref.RefEntity, numList)
+	errs := make([]error, numList)
 	req.wg = &sync.WaitGroup{}
 	req.wg.Add(numList)
 	for i := 0; i < numList; i++ {
@@ -96,6 +109,7 @@ func (req *CopyRequest) ProcessCopy() error {
 			refEntity, err := req.copyBlobberObject(req.blobbers[blobberIdx], blobberIdx)
 			if err != nil {
 				Logger.Error(err.Error())
+				errs[blobberIdx] = err
 				return
 			}
 			objectTreeRefs[blobberIdx] = refEntity
@@ -103,8 +117,35 @@ func (req *CopyRequest) ProcessCopy() error {
 	}
 	req.wg.Wait()
 
+	changes := make([]allocationchange.AllocationChange, numList)
+	pos := 0
+	for i := req.copyMask; i != 0; i &= ^(1 << uint32(pos)) {
+		pos = bits.TrailingZeros32(i)
+		newChange := &allocationchange.CopyFileChange{}
+		newChange.DestPath = req.destPath
+		newChange.ObjectTree = objectTreeRefs[pos]
+		newChange.NumBlocks = 0
+		newChange.Operation = allocationchange.COPY_OPERATION
+		newChange.Size = 0
+		changes[pos] = newChange
+	}
+
 	if !req.isConsensusOk() {
-		return errors.New("Copy failed: Copy request failed. Operation failed.")
+		if err := lockedError(errs); err != nil {
+			return changes, err
+		}
+		if err := firstErrorOf(errs, errMoveDir); err != nil {
+			return changes, err
+		}
+		return changes, errors.New("Copy failed: Copy request failed. Operation failed.")
+	}
+	return changes, nil
+}
+
+func (req *CopyRequest) ProcessCopy() error {
+	changes, err := req.copyObject()
+	if err != nil {
+		return err
 	}
 
 	req.consensus = 0
@@ -119,13 +160,7 @@ func (req *CopyRequest) ProcessCopy() error {
 		commitReq.allocationID = req.allocationID
 		commitReq.allocationTx = req.allocationTx
 		commitReq.blobber = req.blobbers[pos]
-		newChange := &allocationchange.CopyFileChange{}
-		newChange.DestPath = req.destPath
-		newChange.ObjectTree = objectTreeRefs[pos]
-		newChange.NumBlocks = 0
-		newChange.Operation = allocationchange.COPY_OPERATION
-		newChange.Size = 0
-		commitReq.changes = append(commitReq.changes, newChange)
+		commitReq.changes = append(commitReq.changes, changes[pos])
 		commitReq.connectionID = req.connectionID
 		commitReq.wg = wg
 		commitReqs[c] = commitReq
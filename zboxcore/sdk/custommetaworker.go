@@ -0,0 +1,225 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"math/bits"
+	"mime/multipart"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/allocationchange"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+
+	. "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// parseCustomMeta returns the key/value pairs of a custom meta, an empty
+// custom meta has no pairs.
+func parseCustomMeta(customMeta string) (map[string]string, error) {
+	meta := make(map[string]string)
+	if len(customMeta) == 0 {
+		return meta, nil
+	}
+	if err := json.Unmarshal([]byte(customMeta), &meta); err != nil {
+		return nil, errors.Wrap(err, "invalid custom meta")
+	}
+	return meta, nil
+}
+
+// mergeCustomMeta sets the pairs of the meta to the custom meta, a custom
+// meta which isn't a JSON object is replaced.
+func mergeCustomMeta(customMeta string, meta map[string]string) string {
+	merged, err := parseCustomMeta(customMeta)
+	if err != nil {
+		merged = make(map[string]string)
+	}
+	for key, value := range meta {
+		merged[key] = value
+	}
+	if len(merged) == 0 {
+		return ""
+	}
+	content, _ := json.Marshal(merged)
+	return string(content)
+}
+
+// errCustomMetaUnsupported is the error of the blobbers which don't have the
+// custom meta endpoint yet. The released blobbers serve neither the endpoint
+// nor the update_custom_meta commit operation.
+var errCustomMetaUnsupported = errors.New("custom_meta_unsupported",
+	"The blobbers don't support updating the custom meta, upload the file with WithCustomMeta instead")
+
+type CustomMetaRequest struct {
+	allocationID   string                    //
+	allocationTx   string                    //
+	blobbers       []*blockchain.StorageNode //
+	remotefilepath string                    // path (not hash)
+	customMeta     string                    // new custom meta (JSON)
+	customMetaMask uint32                    //
+	maskMu         sync.Mutex                // guards the consensus and the mask
+	unsupported    int32                     // blobbers without the endpoint
+	connectionID   string                    //
+	Consensus                                //
+	ctx            context.Context           //
+	wg             *sync.WaitGroup           //
+}
+
+func (mr *CustomMetaRequest) getObjectTreeFromBlobber(
+	blobber *blockchain.StorageNode) (fileref.RefEntity, error) {
+
+	return getObjectTreeFromBlobber(mr.ctx, mr.allocationID, mr.allocationTx,
+		mr.remotefilepath, blobber)
+}
+
+func (mr *CustomMetaRequest) updateBlobberCustomMeta(
+	blobber *blockchain.StorageNode, blobberIdx int) (
+	re fileref.RefEntity, err error) {
+
+	re, err = mr.getObjectTreeFromBlobber(blobber)
+	if err != nil {
+		return
+	}
+
+	var (
+		body bytes.Buffer
+		form = multipart.NewWriter(&body)
+	)
+
+	form.WriteField("connection_id", mr.connectionID)
+	form.WriteField("path", mr.remotefilepath)
+	form.WriteField("custom_meta", mr.customMeta)
+
+	form.Close()
+
+	var httpreq *http.Request
+	httpreq, err = zboxutil.NewCustomMetaRequest(blobber.Baseurl,
+		mr.allocationTx, &body)
+	if err != nil {
+		Logger.Error(blobber.Baseurl,
+			"Error creating update custom meta request", err)
+		return
+	}
+
+	httpreq.Header.Add("Content-Type", form.FormDataContentType())
+
+	var ctx, cncl = context.WithTimeout(mr.ctx, (time.Second * 30))
+	defer cncl()
+
+	err = zboxutil.HttpDo(ctx, cncl, httpreq,
+		func(resp *http.Response, err error) error {
+			if err != nil {
+				Logger.Error("Request error: ", err)
+				return err
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode == http.StatusOK {
+				mr.maskMu.Lock()
+				mr.consensus++
+				mr.customMetaMask |= (1 << uint32(blobberIdx))
+				mr.maskMu.Unlock()
+				Logger.Info(blobber.Baseurl, " "+mr.remotefilepath,
+					" custom meta updated.")
+				return nil
+			}
+			if resp.StatusCode == http.StatusNotFound {
+				atomic.AddInt32(&mr.unsupported, 1)
+			}
+
+			var respBody []byte
+			if respBody, err = ioutil.ReadAll(resp.Body); err != nil {
+				Logger.Error(blobber.Baseurl, "Reading response: ", err)
+				return nil
+			}
+
+			Logger.Error(blobber.Baseurl, "Response error: ",
+				string(respBody))
+			return nil
+		})
+
+	return
+}
+
+func (mr *CustomMetaRequest) ProcessCustomMeta() error {
+	numList := len(mr.blobbers)
+	mr.wg = &sync.WaitGroup{}
+	mr.wg.Add(numList)
+
+	for i := 0; i < numList; i++ {
+		go func(bidx int) {
+			defer mr.wg.Done()
+			if _, err := mr.updateBlobberCustomMeta(mr.blobbers[bidx], bidx); err != nil {
+				Logger.Error(err.Error())
+			}
+		}(i)
+	}
+	mr.wg.Wait()
+
+	if !mr.isConsensusOk() {
+		if atomic.LoadInt32(&mr.unsupported) > 0 {
+			return errCustomMetaUnsupported
+		}
+		return errors.New("update_custom_meta", "Update custom meta failed: request failed, operation failed")
+	}
+
+	mr.consensus = 0
+
+	var wg sync.WaitGroup
+	wg.Add(bits.OnesCount32(mr.customMetaMask))
+
+	var (
+		commitReqs = make([]*CommitRequest, bits.OnesCount32(mr.customMetaMask))
+		c, pos     = 0, 0
+	)
+
+	for i := mr.customMetaMask; i != 0; i &= ^(1 << uint32(pos)) {
+		pos = bits.TrailingZeros32(i)
+		var commitReq CommitRequest
+		commitReq.allocationID = mr.allocationID
+		commitReq.allocationTx = mr.allocationTx
+		commitReq.blobber = mr.blobbers[pos]
+		var change = new(allocationchange.CustomMetaChange)
+		change.AllocationID = mr.allocationID
+		change.ConnectionID = mr.connectionID
+		change.Path = mr.remotefilepath
+		change.CustomMeta = mr.customMeta
+		change.NumBlocks = 0
+		change.Size = 0
+		change.Operation = allocationchange.UPDATE_META_OPERATION
+		commitReq.changes = append(commitReq.changes, change)
+		commitReq.connectionID = mr.connectionID
+		commitReq.wg = &wg
+		commitReqs[c] = &commitReq
+		go AddCommitRequest(&commitReq)
+		c++
+	}
+	wg.Wait()
+
+	for _, commitReq := range commitReqs {
+		if commitReq.result != nil {
+			if commitReq.result.Success {
+				Logger.Info("Commit success", commitReq.blobber.Baseurl)
+				mr.consensus++
+			} else {
+				Logger.Info("Commit failed", commitReq.blobber.Baseurl,
+					commitReq.result.ErrorMessage)
+			}
+		} else {
+			Logger.Info("Commit result not set", commitReq.blobber.Baseurl)
+		}
+	}
+
+	if !mr.isConsensusOk() {
+		return errors.New("update_custom_meta", "Update custom meta failed: Commit consensus failed")
+	}
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCustomMetaRequest_updateBlobberCustomMeta(t *testing.T) {
+	const (
+		mockRemoteFilePath = "/1.txt"
+		mockConnectionId   = "1234567890"
+		mockCustomMeta     = `{"tag":"x"}`
+	)
+
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	tests := []struct {
+		name            string
+		statusCode      int
+		wantMask        uint32
+		wantUnsupported int32
+	}{
+		{
+			name:       "Test_Update_Custom_Meta_Failed",
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:            "Test_Update_Custom_Meta_Unsupported",
+			statusCode:      http.StatusNotFound,
+			wantUnsupported: 1,
+		},
+		{
+			name:       "Test_Update_Custom_Meta_Success",
+			statusCode: http.StatusOK,
+			wantMask:   1,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+				return strings.HasPrefix(req.URL.Path, tt.name) &&
+					strings.Contains(req.URL.Path, zboxutil.OBJECT_TREE_ENDPOINT)
+			})).Return(func(*http.Request) *http.Response {
+				body, err := json.Marshal(&fileref.ReferencePath{
+					Meta: map[string]interface{}{"type": fileref.FILE},
+				})
+				require.NoError(err)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				}
+			}, nil)
+
+			fields := make(map[string]string)
+			mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+				if !strings.HasPrefix(req.URL.Path, tt.name) ||
+					!strings.Contains(req.URL.Path, zboxutil.CUSTOM_META_ENDPOINT) {
+					return false
+				}
+				_, params, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+				require.NoError(err)
+				reader := multipart.NewReader(req.Body, params["boundary"])
+				for {
+					part, err := reader.NextPart()
+					if err != nil {
+						break
+					}
+					value, err := ioutil.ReadAll(part)
+					require.NoError(err)
+					fields[part.FormName()] = string(value)
+				}
+				return req.Method == http.MethodPost
+			})).Return(func(*http.Request) *http.Response {
+				return &http.Response{
+					StatusCode: tt.statusCode,
+					Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+				}
+			}, nil)
+
+			req := &CustomMetaRequest{
+				remotefilepath: mockRemoteFilePath,
+				customMeta:     mockCustomMeta,
+				connectionID:   mockConnectionId,
+				ctx:            context.TODO(),
+				blobbers: []*blockchain.StorageNode{
+					{Baseurl: tt.name},
+				},
+			}
+			_, err := req.updateBlobberCustomMeta(req.blobbers[0], 0)
+			require.NoError(err)
+			require.EqualValues(tt.wantMask, req.customMetaMask)
+			require.EqualValues(tt.wantUnsupported, req.unsupported)
+			require.EqualValues(map[string]string{
+				"connection_id": mockConnectionId,
+				"path":          mockRemoteFilePath,
+				"custom_meta":   mockCustomMeta,
+			}, fields)
+		})
+	}
+}
+
+func TestCustomMeta(t *testing.T) {
+	require := require.New(t)
+
+	req := &UploadRequest{filemeta: &UploadFileMeta{}}
+	WithCustomMeta(map[string]string{"a": "1", "b": "2"})(req)
+	WithCustomMeta(map[string]string{"b": "3"})(req)
+	meta, err := (&ListResult{CustomMeta: req.filemeta.CustomMeta}).GetCustomMeta()
+	require.NoError(err)
+	require.EqualValues(map[string]string{"a": "1", "b": "3"}, meta)
+
+	// a custom meta which isn't a JSON object is replaced
+	require.EqualValues(`{"a":"1"}`, mergeCustomMeta("not json", map[string]string{"a": "1"}))
+	require.EqualValues("", mergeCustomMeta("", nil))
+
+	meta, err = (&ConsolidatedFileMeta{}).GetCustomMeta()
+	require.NoError(err)
+	require.Empty(meta)
+	_, err = (&ConsolidatedFileMeta{CustomMeta: "not json"}).GetCustomMeta()
+	require.Error(err)
+
+	// the meta kept by sync isn't dropped by an update
+	require.EqualValues(map[string]string{"mtime": "t", "mode": "0644", "a": "2"},
+		keepSyncFileMeta(`{"mtime":"t","mode":"0600","a":"1","b":"1"}`, map[string]string{"a": "2", "mode": "0644"}))
+	require.Empty(keepSyncFileMeta("not json", nil))
+}
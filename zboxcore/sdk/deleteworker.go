@@ -85,17 +85,26 @@ func (req *DeleteRequest) getObjectTreeFromBlobber(blobber *blockchain.StorageNo
 	return getObjectTreeFromBlobber(req.ctx, req.allocationID, req.allocationTx, req.remotefilepath, blobber)
 }
 
-func (req *DeleteRequest) ProcessDelete() error {
+// deleteObject deletes the object on the blobbers in the request connection
+// without committing it. The returned changes are indexed by the blobber
+// position, nil for the blobbers which haven't deleted the object; they're
+// returned on a consensus failure too.
+func (req *DeleteRequest) deleteObject() ([]allocationchange.AllocationChange, error) {
 	numList := len(req.blobbers)
 	objectTreeRefs := make([]fileref.RefEntity, numList)
+	errs := make([]error, numList)
 	req.wg = &sync.WaitGroup{}
 	req.wg.Add(numList)
 	for i := 0; i < numList; i++ {
 		go func(blobberIdx int) {
 			defer req.wg.Done()
 			refEntity, err := req.getObjectTreeFromBlobber(req.blobbers[blobberIdx])
+			if err == nil {
+				err = checkUnlocked(refEntity)
+			}
 			if err != nil {
 				Logger.Error(err.Error())
+				errs[blobberIdx] = err
 				return
 			}
 			req.consensus++
@@ -104,6 +113,9 @@ func (req *DeleteRequest) ProcessDelete() error {
 		}(i)
 	}
 	req.wg.Wait()
+	if err := lockedError(errs); err != nil {
+		return make([]allocationchange.AllocationChange, numList), err
+	}
 
 	req.deleteMask = uint32(0)
 	req.consensus = 0
@@ -120,15 +132,34 @@ func (req *DeleteRequest) ProcessDelete() error {
 	}
 	req.wg.Wait()
 
+	changes := make([]allocationchange.AllocationChange, numList)
+	for i := req.deleteMask; i != 0; i &= ^(1 << uint32(pos)) {
+		pos = bits.TrailingZeros32(i)
+		newChange := &allocationchange.DeleteFileChange{}
+		newChange.ObjectTree = objectTreeRefs[pos]
+		newChange.NumBlocks = newChange.ObjectTree.GetNumBlocks()
+		newChange.Operation = allocationchange.DELETE_OPERATION
+		newChange.Size = newChange.ObjectTree.GetSize()
+		changes[pos] = newChange
+	}
+
 	if !req.isConsensusOk() {
-		return fmt.Errorf("Delete failed: Success_rate:%2f, expected:%2f", req.getConsensusRate(), req.getConsensusRequiredForOk())
+		return changes, fmt.Errorf("Delete failed: Success_rate:%2f, expected:%2f", req.getConsensusRate(), req.getConsensusRequiredForOk())
+	}
+	return changes, nil
+}
+
+func (req *DeleteRequest) ProcessDelete() error {
+	changes, err := req.deleteObject()
+	if err != nil {
+		return err
 	}
 
 	req.consensus = 0
 	wg := &sync.WaitGroup{}
 	wg.Add(bits.OnesCount32(req.deleteMask))
 	commitReqs := make([]*CommitRequest, bits.OnesCount32(req.deleteMask))
-	c, pos = 0, 0
+	c, pos := 0, 0
 	for i := req.deleteMask; i != 0; i &= ^(1 << uint32(pos)) {
 		pos = bits.TrailingZeros32(i)
 		//go req.prepareUpload(a, a.Blobbers[pos], req.file[c], req.uploadDataCh[c], req.wg)
@@ -136,12 +167,7 @@ func (req *DeleteRequest) ProcessDelete() error {
 		commitReq.allocationID = req.allocationID
 		commitReq.allocationTx = req.allocationTx
 		commitReq.blobber = req.blobbers[pos]
-		newChange := &allocationchange.DeleteFileChange{}
-		newChange.ObjectTree = objectTreeRefs[pos]
-		newChange.NumBlocks = newChange.ObjectTree.GetNumBlocks()
-		newChange.Operation = allocationchange.DELETE_OPERATION
-		newChange.Size = newChange.ObjectTree.GetSize()
-		commitReq.changes = append(commitReq.changes, newChange)
+		commitReq.changes = append(commitReq.changes, changes[pos])
 		commitReq.connectionID = req.connectionID
 		commitReq.wg = wg
 		commitReqs[c] = commitReq
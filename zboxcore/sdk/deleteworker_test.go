@@ -359,6 +359,32 @@ func TestDeleteRequest_ProcessDelete(t *testing.T) {
 			wantErr:     true,
 			errMsg:      "Delete failed",
 		},
+		{
+			name:        "Test_Locked_File_Failure",
+			numBlobbers: 4,
+			setup: func(t *testing.T, testName string, numBlobbers int, numCorrect int, req DeleteRequest) {
+				// nothing is deleted, there is no mock for the delete requests
+				mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+					return req.Method == "GET" &&
+						strings.HasPrefix(req.URL.Path, testName)
+				})).Return(func(*http.Request) *http.Response {
+					jsonFR, err := json.Marshal(&fileref.ReferencePath{
+						Meta: map[string]interface{}{
+							"type":       mockType,
+							"path":       "/" + mockRemoteFilePath,
+							"attributes": map[string]interface{}{"locked": true},
+						},
+					})
+					require.NoError(t, err)
+					return &http.Response{
+						StatusCode: http.StatusOK,
+						Body:       ioutil.NopCloser(bytes.NewReader(jsonFR)),
+					}
+				}, nil)
+			},
+			wantErr: true,
+			errMsg:  "file_locked",
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -0,0 +1,489 @@
+package sdk
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// OverwritePolicy tells what a directory transfer does with the files which
+// exist at the destination already.
+type OverwritePolicy int
+
+const (
+	// OverwriteSkip keeps the existing files.
+	OverwriteSkip OverwritePolicy = iota
+	// OverwriteAlways replaces the existing files.
+	OverwriteAlways
+	// OverwriteIfChanged replaces the existing files with a different content.
+	OverwriteIfChanged
+	// OverwriteFail fails the transfer of the existing files.
+	OverwriteFail
+)
+
+// DirTransferOptions are the options of UploadDir and DownloadDir.
+type DirTransferOptions struct {
+	// Workers is the number of files transferred in parallel, 1 if not set.
+	Workers int
+	// Include and Exclude are glob patterns matched against the path relative
+	// to the root dir and against the name. A file is transferred if it
+	// matches one of Include, or Include is empty, and none of Exclude. A
+	// dir matching Exclude is skipped with its content.
+	Include []string
+	Exclude []string
+	// Overwrite is the policy for the files existing at the destination.
+	Overwrite OverwritePolicy
+	// Attributes of the uploaded files.
+	Attributes fileref.Attributes
+	// Status gets the aggregated progress of the transfer for the root dir,
+	// and an Error for every file which failed. It may be nil.
+	Status StatusCallback
+}
+
+// DirTransferResult is the summary of a directory transfer, the paths are
+// relative to the root dir.
+type DirTransferResult struct {
+	Transferred []string          `json:"transferred"`
+	Skipped     []string          `json:"skipped"`
+	Failed      map[string]string `json:"failed"`
+	CreatedDirs []string          `json:"created_dirs"`
+	TotalBytes  int64             `json:"total_bytes"`
+}
+
+type dirTransferFile struct {
+	relPath    string
+	localPath  string
+	remotePath string
+	size       int64
+	isUpdate   bool
+}
+
+type dirTransfer struct {
+	a      *Allocation
+	op     int
+	root   string
+	opts   *DirTransferOptions
+	result *DirTransferResult
+	// done is the transferred bytes of the finished files, progress is the
+	// transferred bytes of the files in progress
+	done     int64
+	progress map[string]int64
+	mutex    sync.Mutex
+}
+
+func newDirTransfer(a *Allocation, op int, root string, opts *DirTransferOptions) (*dirTransfer, error) {
+	if opts == nil {
+		opts = &DirTransferOptions{}
+	}
+	for _, pattern := range append(append([]string{}, opts.Include...), opts.Exclude...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, errors.New("invalid_pattern", "Invalid glob pattern "+pattern)
+		}
+	}
+	return &dirTransfer{
+		a:    a,
+		op:   op,
+		root: root,
+		opts: opts,
+		result: &DirTransferResult{
+			Transferred: []string{},
+			Skipped:     []string{},
+			Failed:      make(map[string]string),
+			CreatedDirs: []string{},
+		},
+		progress: make(map[string]int64),
+	}, nil
+}
+
+func matchAnyGlob(patterns []string, relPath string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, relPath); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(relPath)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *dirTransfer) isExcluded(relPath string) bool {
+	return matchAnyGlob(t.opts.Exclude, relPath)
+}
+
+func (t *dirTransfer) isIncluded(relPath string) bool {
+	if t.isExcluded(relPath) {
+		return false
+	}
+	return len(t.opts.Include) == 0 || matchAnyGlob(t.opts.Include, relPath)
+}
+
+// checkExisting applies the overwrite policy to an existing file, it tells
+// whether the file is transferred.
+func (t *dirTransfer) checkExisting(changed func() bool) (bool, error) {
+	switch t.opts.Overwrite {
+	case OverwriteAlways:
+		return true, nil
+	case OverwriteIfChanged:
+		return changed(), nil
+	case OverwriteFail:
+		return false, errors.New("file_exists", "File exists at the destination")
+	default:
+		return false, nil
+	}
+}
+
+func (t *dirTransfer) fail(file *dirTransferFile, err error) {
+	t.mutex.Lock()
+	t.result.Failed[file.relPath] = err.Error()
+	delete(t.progress, file.relPath)
+	t.mutex.Unlock()
+	if t.opts.Status != nil {
+		filePath := file.remotePath
+		if t.op == OpDownload {
+			filePath = file.localPath
+		}
+		t.opts.Status.Error(t.a.ID, filePath, t.op, err)
+	}
+	t.reportProgress()
+}
+
+func (t *dirTransfer) complete(file *dirTransferFile) {
+	t.mutex.Lock()
+	t.result.Transferred = append(t.result.Transferred, file.relPath)
+	delete(t.progress, file.relPath)
+	t.done += file.size
+	t.mutex.Unlock()
+	t.reportProgress()
+}
+
+func (t *dirTransfer) setProgress(file *dirTransferFile, completed, total int) {
+	if total <= 0 {
+		return
+	}
+	t.mutex.Lock()
+	t.progress[file.relPath] = file.size * int64(completed) / int64(total)
+	t.mutex.Unlock()
+	t.reportProgress()
+}
+
+func (t *dirTransfer) reportProgress() {
+	if t.opts.Status == nil {
+		return
+	}
+	t.mutex.Lock()
+	completed := t.done
+	for _, p := range t.progress {
+		completed += p
+	}
+	t.mutex.Unlock()
+	t.opts.Status.InProgress(t.a.ID, t.root, t.op, int(completed), nil)
+}
+
+// run transfers the files with the bounded number of workers, transfer has to
+// return once the file is done.
+func (t *dirTransfer) run(files []*dirTransferFile, transfer func(*dirTransferFile) error) {
+	for _, file := range files {
+		t.result.TotalBytes += file.size
+	}
+	if t.opts.Status != nil {
+		t.opts.Status.Started(t.a.ID, t.root, t.op, int(t.result.TotalBytes))
+	}
+
+	workers := t.opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	fileCh := make(chan *dirTransferFile)
+	wg := &sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for file := range fileCh {
+				if err := transfer(file); err != nil {
+					Logger.Error("Transfer of ", file.relPath, " failed: ", err)
+					t.fail(file, err)
+					continue
+				}
+				t.complete(file)
+			}
+		}()
+	}
+	for _, file := range files {
+		fileCh <- file
+	}
+	close(fileCh)
+	wg.Wait()
+
+	if t.opts.Status != nil {
+		_, name := filepath.Split(t.root)
+		t.opts.Status.Completed(t.a.ID, t.root, name, "", int(t.result.TotalBytes), t.op)
+	}
+}
+
+// newDirTransferStatusCB waits for the transfer of a file and forwards its
+// progress to the directory transfer.
+func newDirTransferStatusCB(t *dirTransfer, file *dirTransferFile) *waitStatusCB {
+	cb := newWaitStatusCB(nil)
+	cb.progress = func(completed, total int) {
+		t.setProgress(file, completed, total)
+	}
+	return cb
+}
+
+// listRemoteTree lists the remote dir recursively. It returns the refs keyed
+// by the path, empty if the dir doesn't exist.
+func (a *Allocation) listRemoteTree(remoteDir string) (map[string]*ListResult, error) {
+	refs := make(map[string]*ListResult)
+	dirs := []string{remoteDir}
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+		listResult, err := a.ListDir(dir)
+		if err != nil {
+			return nil, err
+		}
+		if listResult.Type != fileref.DIRECTORY {
+			continue
+		}
+		refs[dir] = listResult
+		for _, child := range listResult.Children {
+			if child.Type == fileref.DIRECTORY {
+				dirs = append(dirs, child.Path)
+				continue
+			}
+			refs[child.Path] = child
+		}
+	}
+	return refs, nil
+}
+
+// UploadDir uploads the local dir recursively to the remote dir. The files
+// are uploaded in parallel with the options, empty dirs are created. It
+// blocks till the transfer is done and returns its summary; the failures of
+// single files are in the summary and don't fail the call.
+func (a *Allocation) UploadDir(localDir, remoteDir string, opts *DirTransferOptions) (*DirTransferResult, error) {
+	if !a.isInitialized() {
+		return nil, notInitialized
+	}
+	remoteDir = zboxutil.RemoteClean(remoteDir)
+	if !zboxutil.IsRemoteAbs(remoteDir) {
+		return nil, errors.New("invalid_path", "Path should be valid and absolute")
+	}
+	stat, err := os.Stat(localDir)
+	if err != nil {
+		return nil, errors.Wrap(err, "Local dir error")
+	}
+	if !stat.IsDir() {
+		return nil, errors.New("invalid_path", "Local path is not a directory")
+	}
+
+	t, err := newDirTransfer(a, OpUpload, remoteDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	remoteRefs, err := a.listRemoteTree(remoteDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*dirTransferFile
+	var emptyDirs []string
+	err = filepath.Walk(localDir, func(localPath string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(localDir, localPath)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+		rel = filepath.ToSlash(rel)
+		if info.IsDir() {
+			if t.isExcluded(rel) {
+				return filepath.SkipDir
+			}
+			entries, err := ioutil.ReadDir(localPath)
+			if err == nil && len(entries) == 0 {
+				emptyDirs = append(emptyDirs, rel)
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || !t.isIncluded(rel) {
+			return nil
+		}
+		file := &dirTransferFile{
+			relPath:    rel,
+			localPath:  localPath,
+			remotePath: path.Join(remoteDir, rel),
+			size:       info.Size(),
+		}
+		if ref, ok := remoteRefs[file.remotePath]; ok {
+			if ref.Type == fileref.DIRECTORY {
+				t.result.Failed[rel] = "Remote path is a directory"
+				return nil
+			}
+			transfer, err := t.checkExisting(func() bool {
+				hash, err := calcFileHash(localPath)
+				return err != nil || hash != ref.Hash
+			})
+			if err != nil {
+				t.result.Failed[rel] = err.Error()
+				return nil
+			}
+			if !transfer {
+				t.result.Skipped = append(t.result.Skipped, rel)
+				return nil
+			}
+			file.isUpdate = true
+		}
+		files = append(files, file)
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "Local dir walk failed")
+	}
+
+	for _, dir := range emptyDirs {
+		remotePath := path.Join(remoteDir, dir)
+		if _, ok := remoteRefs[remotePath]; ok {
+			continue
+		}
+		if err := a.CreateDir(remotePath); err != nil {
+			t.result.Failed[dir] = err.Error()
+			continue
+		}
+		t.result.CreatedDirs = append(t.result.CreatedDirs, dir)
+	}
+
+	dirAttrs := newDirAttributes()
+	t.run(files, func(file *dirTransferFile) error {
+		cb := newDirTransferStatusCB(t, file)
+		err := a.uploadOrUpdateFile(file.localPath, file.remotePath, cb,
+			file.isUpdate, "", false, false, t.opts.Attributes, withDirAttributes(dirAttrs))
+		if err != nil {
+			return err
+		}
+		return cb.wait()
+	})
+	return t.result, nil
+}
+
+// DownloadDir downloads the remote dir recursively to the local dir. The files
+// are downloaded in parallel with the options, empty dirs are created. It
+// blocks till the transfer is done and returns its summary; the failures of
+// single files are in the summary and don't fail the call.
+func (a *Allocation) DownloadDir(remoteDir, localDir string, opts *DirTransferOptions) (*DirTransferResult, error) {
+	if !a.isInitialized() {
+		return nil, notInitialized
+	}
+	remoteDir = zboxutil.RemoteClean(remoteDir)
+	if !zboxutil.IsRemoteAbs(remoteDir) {
+		return nil, errors.New("invalid_path", "Path should be valid and absolute")
+	}
+	if stat, err := os.Stat(localDir); err == nil && !stat.IsDir() {
+		return nil, errors.New("invalid_path", "Local path is not a directory")
+	}
+
+	t, err := newDirTransfer(a, OpDownload, remoteDir, opts)
+	if err != nil {
+		return nil, err
+	}
+	remoteRefs, err := a.listRemoteTree(remoteDir)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := remoteRefs[remoteDir]; !ok {
+		return nil, errors.New("invalid_path", "Remote path is not a directory")
+	}
+
+	var files []*dirTransferFile
+	for remotePath, ref := range remoteRefs {
+		if remotePath == remoteDir {
+			continue
+		}
+		rel := strings.TrimPrefix(strings.TrimPrefix(remotePath, remoteDir), "/")
+		if t.isExcluded(rel) || t.isExcludedDir(rel) {
+			continue
+		}
+		localPath := filepath.Join(localDir, filepath.FromSlash(rel))
+		if ref.Type == fileref.DIRECTORY {
+			if len(ref.Children) > 0 {
+				continue
+			}
+			if err := os.MkdirAll(localPath, os.ModePerm); err != nil {
+				t.result.Failed[rel] = err.Error()
+				continue
+			}
+			t.result.CreatedDirs = append(t.result.CreatedDirs, rel)
+			continue
+		}
+		if !t.isIncluded(rel) {
+			continue
+		}
+		if stat, err := os.Stat(localPath); err == nil {
+			if stat.IsDir() {
+				t.result.Failed[rel] = "Local path is a directory"
+				continue
+			}
+			transfer, err := t.checkExisting(func() bool {
+				hash, err := calcFileHash(localPath)
+				return err != nil || hash != ref.Hash
+			})
+			if err != nil {
+				t.result.Failed[rel] = err.Error()
+				continue
+			}
+			if !transfer {
+				t.result.Skipped = append(t.result.Skipped, rel)
+				continue
+			}
+		}
+		files = append(files, &dirTransferFile{
+			relPath:    rel,
+			localPath:  localPath,
+			remotePath: remotePath,
+			size:       ref.ActualSize,
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].relPath < files[j].relPath })
+	t.run(files, func(file *dirTransferFile) error {
+		// download next to the file and replace it once it's complete
+		tmpPath := file.localPath + ".download"
+		os.Remove(tmpPath)
+		cb := newDirTransferStatusCB(t, file)
+		err := a.downloadFile(tmpPath, file.remotePath, DOWNLOAD_CONTENT_FULL, 1, 0, numBlockDownloads, cb)
+		if err != nil {
+			return err
+		}
+		if err = cb.wait(); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		return os.Rename(tmpPath, file.localPath)
+	})
+	return t.result, nil
+}
+
+// isExcludedDir tells whether one of the parent dirs of the path is excluded.
+func (t *dirTransfer) isExcludedDir(relPath string) bool {
+	for dir := path.Dir(relPath); dir != "." && dir != "/"; dir = path.Dir(dir) {
+		if t.isExcluded(dir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,354 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirTransfer_isIncluded(t *testing.T) {
+	tests := []struct {
+		name    string
+		include []string
+		exclude []string
+		relPath string
+		want    bool
+	}{
+		{"No_Patterns", nil, nil, "a/b.txt", true},
+		{"Include_By_Name", []string{"*.txt"}, nil, "a/b.txt", true},
+		{"Include_By_Path", []string{"a/*"}, nil, "a/b.txt", true},
+		{"Not_Included", []string{"*.jpg"}, nil, "a/b.txt", false},
+		{"Excluded_By_Name", nil, []string{"*.txt"}, "a/b.txt", false},
+		{"Exclude_Wins", []string{"*.txt"}, []string{"b.*"}, "a/b.txt", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tr, err := newDirTransfer(&Allocation{}, OpUpload, "/", &DirTransferOptions{
+				Include: tt.include,
+				Exclude: tt.exclude,
+			})
+			require.NoError(t, err)
+			require.EqualValues(t, tt.want, tr.isIncluded(tt.relPath))
+		})
+	}
+}
+
+func TestDirTransfer_isExcludedDir(t *testing.T) {
+	tr, err := newDirTransfer(&Allocation{}, OpDownload, "/", &DirTransferOptions{
+		Exclude: []string{".git"},
+	})
+	require.NoError(t, err)
+	require.True(t, tr.isExcludedDir("a/.git/config"))
+	require.False(t, tr.isExcludedDir("a/git/config"))
+}
+
+func TestDirTransfer_invalidPattern(t *testing.T) {
+	_, err := newDirTransfer(&Allocation{}, OpUpload, "/", &DirTransferOptions{
+		Include: []string{"[a"},
+	})
+	require.Error(t, err)
+}
+
+func contentHash(content string) string {
+	h := sha1.Sum([]byte(content))
+	return hex.EncodeToString(h[:])
+}
+
+// setupMockDirTransfer sets up the allocation with the remote tree listed by
+// the blobbers. The uploads and the downloads are done by the test workers,
+// the ones of the failing files fail. It returns the remote paths updated.
+func setupMockDirTransfer(t *testing.T, a *Allocation, tree map[string]map[string]string,
+	failing string) *sync.Map {
+
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	// the tree has the content hash by name for the files, "" for the dirs
+	listings := make(map[string][]byte)
+	for dir, entries := range tree {
+		var entities []map[string]interface{}
+		for name, hash := range entries {
+			entity := map[string]interface{}{
+				"name":        name,
+				"path":        zboxutil.Join(dir, name),
+				"lookup_hash": fileref.GetReferenceLookup("", zboxutil.Join(dir, name)),
+				"type":        fileref.DIRECTORY,
+			}
+			if len(hash) > 0 {
+				entity["type"] = fileref.FILE
+				entity["actual_file_hash"] = hash
+			}
+			entities = append(entities, entity)
+		}
+		body, err := json.Marshal(&fileref.ListResult{
+			Meta:     map[string]interface{}{"type": fileref.DIRECTORY, "path": dir, "name": dir},
+			Entities: entities,
+		})
+		require.NoError(t, err)
+		listings[fileref.GetReferenceLookup("", dir)] = body
+	}
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.Contains(req.URL.Path, zboxutil.LIST_ENDPOINT)
+	})).Return(func(req *http.Request) *http.Response {
+		body, ok := listings[req.URL.Query().Get("path_hash")]
+		if !ok {
+			return &http.Response{
+				StatusCode: http.StatusBadRequest,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      mockBlobberId + strconv.Itoa(i),
+			Baseurl: t.Name() + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+	a.uploadChan = make(chan *UploadRequest, 10)
+	a.downloadChan = make(chan *DownloadRequest, 10)
+	a.ctx, a.ctxCancelF = context.WithCancel(context.Background())
+	a.uploadProgressMap = make(map[string]*UploadRequest)
+	a.downloadProgressMap = make(map[string]*DownloadRequest)
+	a.mutex = &sync.Mutex{}
+	a.initialized = true
+	sdkInitialized = true
+
+	failed := errors.New("transfer_failed", "Mock transfer failure")
+	updated := &sync.Map{}
+	go func() {
+		for {
+			select {
+			case <-a.ctx.Done():
+				return
+			case req := <-a.uploadChan:
+				if req.isUpdate {
+					updated.Store(req.remotefilepath, true)
+				}
+				if strings.HasSuffix(req.remotefilepath, failing) {
+					req.statusCallback.Error(a.ID, req.remotefilepath, OpUpload, failed)
+					continue
+				}
+				req.statusCallback.Completed(a.ID, req.remotefilepath, req.filemeta.Name, "", int(req.filemeta.Size), OpUpload)
+			case req := <-a.downloadChan:
+				if strings.HasSuffix(req.remotefilepath, failing) {
+					req.statusCallback.Error(a.ID, req.localpath, OpDownload, failed)
+					continue
+				}
+				err := ioutil.WriteFile(req.localpath, []byte("remote"), 0644)
+				require.NoError(t, err)
+				req.statusCallback.Completed(a.ID, req.localpath, "", "", 6, OpDownload)
+			}
+		}
+	}()
+	t.Cleanup(a.ctxCancelF)
+	return updated
+}
+
+func TestAllocation_UploadDir(t *testing.T) {
+	tests := []struct {
+		name        string
+		overwrite   OverwritePolicy
+		transferred []string
+		skipped     []string
+		failed      []string
+	}{
+		{
+			name:        "Test_Overwrite_Skip",
+			overwrite:   OverwriteSkip,
+			transferred: []string{"local.txt"},
+			skipped:     []string{"changed.txt", "same.txt"},
+			failed:      []string{"broken.txt"},
+		},
+		{
+			name:        "Test_Overwrite_Always",
+			overwrite:   OverwriteAlways,
+			transferred: []string{"changed.txt", "local.txt", "same.txt"},
+			skipped:     []string{},
+			failed:      []string{"broken.txt"},
+		},
+		{
+			name:        "Test_Overwrite_If_Changed",
+			overwrite:   OverwriteIfChanged,
+			transferred: []string{"changed.txt", "local.txt"},
+			skipped:     []string{"same.txt"},
+			failed:      []string{"broken.txt"},
+		},
+		{
+			name:        "Test_Overwrite_Fail",
+			overwrite:   OverwriteFail,
+			transferred: []string{"local.txt"},
+			skipped:     []string{},
+			failed:      []string{"broken.txt", "changed.txt", "same.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			a := &Allocation{DataShards: 2, ParityShards: 2}
+			updated := setupMockDirTransfer(t, a, map[string]map[string]string{
+				"/d": {
+					"same.txt":    contentHash("same"),
+					"changed.txt": contentHash("old"),
+				},
+			}, "broken.txt")
+
+			localDir := t.TempDir()
+			for name, content := range map[string]string{
+				"same.txt":    "same",
+				"changed.txt": "new",
+				"local.txt":   "local",
+				"broken.txt":  "broken",
+			} {
+				err := ioutil.WriteFile(filepath.Join(localDir, name), []byte(content), 0644)
+				require.NoError(err)
+			}
+
+			result, err := a.UploadDir(localDir, "/d", &DirTransferOptions{Overwrite: tt.overwrite})
+			require.NoError(err)
+			require.ElementsMatch(tt.transferred, result.Transferred)
+			require.ElementsMatch(tt.skipped, result.Skipped)
+			var failed []string
+			for rel := range result.Failed {
+				failed = append(failed, rel)
+			}
+			require.ElementsMatch(tt.failed, failed)
+			if tt.overwrite == OverwriteFail {
+				require.Contains(result.Failed["same.txt"], "file_exists")
+			}
+
+			// the existing files are updated, the others uploaded
+			for _, rel := range tt.transferred {
+				_, ok := updated.Load("/d/" + rel)
+				require.EqualValues(rel != "local.txt", ok)
+			}
+		})
+	}
+}
+
+func TestAllocation_DownloadDir(t *testing.T) {
+	tests := []struct {
+		name        string
+		overwrite   OverwritePolicy
+		transferred []string
+		skipped     []string
+		failed      []string
+	}{
+		{
+			name:        "Test_Overwrite_Skip",
+			overwrite:   OverwriteSkip,
+			transferred: []string{"remote.txt"},
+			skipped:     []string{"changed.txt", "same.txt"},
+			failed:      []string{"broken.txt"},
+		},
+		{
+			name:        "Test_Overwrite_Always",
+			overwrite:   OverwriteAlways,
+			transferred: []string{"changed.txt", "remote.txt", "same.txt"},
+			skipped:     []string{},
+			failed:      []string{"broken.txt"},
+		},
+		{
+			name:        "Test_Overwrite_If_Changed",
+			overwrite:   OverwriteIfChanged,
+			transferred: []string{"changed.txt", "remote.txt"},
+			skipped:     []string{"same.txt"},
+			failed:      []string{"broken.txt"},
+		},
+		{
+			name:        "Test_Overwrite_Fail",
+			overwrite:   OverwriteFail,
+			transferred: []string{"remote.txt"},
+			skipped:     []string{},
+			failed:      []string{"broken.txt", "changed.txt", "same.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			a := &Allocation{DataShards: 2, ParityShards: 2}
+			setupMockDirTransfer(t, a, map[string]map[string]string{
+				"/d": {
+					"same.txt":    contentHash("same"),
+					"changed.txt": contentHash("old"),
+					"remote.txt":  contentHash("remote"),
+					"broken.txt":  contentHash("broken"),
+					"empty":       "",
+				},
+				"/d/empty": {},
+			}, "broken.txt")
+
+			localDir := t.TempDir()
+			local := map[string]string{
+				"same.txt":    "same",
+				"changed.txt": "new",
+			}
+			for name, content := range local {
+				err := ioutil.WriteFile(filepath.Join(localDir, name), []byte(content), 0644)
+				require.NoError(err)
+			}
+
+			result, err := a.DownloadDir("/d", localDir, &DirTransferOptions{Overwrite: tt.overwrite})
+			require.NoError(err)
+			require.ElementsMatch(tt.transferred, result.Transferred)
+			require.ElementsMatch(tt.skipped, result.Skipped)
+			require.EqualValues([]string{"empty"}, result.CreatedDirs)
+			var failed []string
+			for rel := range result.Failed {
+				failed = append(failed, rel)
+			}
+			require.ElementsMatch(tt.failed, failed)
+
+			// the downloaded files replace the local ones, the failed download
+			// leaves nothing behind
+			for _, rel := range tt.transferred {
+				content, err := ioutil.ReadFile(filepath.Join(localDir, rel))
+				require.NoError(err)
+				require.EqualValues("remote", string(content))
+			}
+			for _, rel := range append(tt.skipped, tt.failed...) {
+				content, ok := local[rel]
+				if !ok {
+					_, err := os.Stat(filepath.Join(localDir, rel))
+					require.True(os.IsNotExist(err))
+					continue
+				}
+				got, err := ioutil.ReadFile(filepath.Join(localDir, rel))
+				require.NoError(err)
+				require.EqualValues(content, string(got))
+			}
+			_, err = os.Stat(filepath.Join(localDir, "broken.txt.download"))
+			require.True(os.IsNotExist(err))
+		})
+	}
+}
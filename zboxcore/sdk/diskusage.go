@@ -0,0 +1,198 @@
+package sdk
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// DiskUsage is the usage of the allocation by a file or a directory. The
+// sizes and counts of a directory cover its whole subtree.
+type DiskUsage struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Type string `json:"type"`
+	// ActualSize is the size of the files as uploaded.
+	ActualSize int64 `json:"actual_size"`
+	// StoredSize is the size of the files stored by all the blobbers, the
+	// data and the parity shards.
+	StoredSize int64 `json:"stored_size"`
+	NumFiles   int64 `json:"num_files"`
+	// NumDirs is the number of directories in the subtree.
+	NumDirs int64 `json:"num_dirs"`
+	// CapacityShare is the share of the capacity of the blobbers used by the
+	// StoredSize, from 0 to 1.
+	CapacityShare float64 `json:"capacity_share"`
+	// Children is the usage of the entries of the directory, down to the
+	// depth given to DiskUsage, sorted by name.
+	Children []*DiskUsage `json:"children,omitempty"`
+}
+
+// duNode is a path of the object trees of the blobbers.
+type duNode struct {
+	name    string
+	path    string
+	refType string
+	// found is the number of blobbers having the path
+	found int
+	// versions are the versions of a file by its actual hash
+	versions map[string]*duVersion
+	children map[string]*duNode
+}
+
+// duVersion is a version of a file, as stored by the blobbers having it.
+type duVersion struct {
+	found      int
+	actualSize int64
+	storedSize int64
+}
+
+// add adds the ref of the object tree of a blobber to the node. The stored
+// sizes of the blobbers having the same version of a file add up.
+func (n *duNode) add(ref fileref.RefEntity) {
+	n.name = ref.GetName()
+	n.path = ref.GetPath()
+	n.refType = ref.GetType()
+	n.found++
+	switch ref := ref.(type) {
+	case *fileref.FileRef:
+		if n.versions == nil {
+			n.versions = make(map[string]*duVersion)
+		}
+		version, ok := n.versions[ref.ActualFileHash]
+		if !ok {
+			version = &duVersion{actualSize: ref.ActualFileSize}
+			n.versions[ref.ActualFileHash] = version
+		}
+		version.found++
+		version.storedSize += ref.Size
+	case *fileref.Ref:
+		for _, child := range ref.Children {
+			if n.children == nil {
+				n.children = make(map[string]*duNode)
+			}
+			// a path can be a file on some blobbers and a dir on others
+			key := child.GetType() + ":" + child.GetPath()
+			node, ok := n.children[key]
+			if !ok {
+				node = &duNode{}
+				n.children[key] = node
+			}
+			node.add(child)
+		}
+	}
+}
+
+// usage returns the usage of the node, nil if less than the required number
+// of blobbers agree on it. A file is counted in the version the most
+// blobbers have.
+func (n *duNode) usage(depth int, capacity int64, required int) *DiskUsage {
+	if n.found < required {
+		return nil
+	}
+	du := &DiskUsage{Name: n.name, Path: n.path, Type: n.refType}
+	if n.refType == fileref.FILE {
+		var agreed *duVersion
+		for _, version := range n.versions {
+			if agreed == nil || version.found > agreed.found {
+				agreed = version
+			}
+		}
+		if agreed == nil || agreed.found < required {
+			return nil
+		}
+		du.ActualSize = agreed.actualSize
+		du.StoredSize = agreed.storedSize
+		du.NumFiles = 1
+	}
+	for _, child := range n.children {
+		cu := child.usage(depth-1, capacity, required)
+		if cu == nil {
+			continue
+		}
+		du.ActualSize += cu.ActualSize
+		du.StoredSize += cu.StoredSize
+		du.NumFiles += cu.NumFiles
+		du.NumDirs += cu.NumDirs
+		if cu.Type == fileref.DIRECTORY {
+			du.NumDirs++
+		}
+		if depth != 0 {
+			du.Children = append(du.Children, cu)
+		}
+	}
+	sort.Slice(du.Children, func(i, j int) bool {
+		return du.Children[i].Name < du.Children[j].Name
+	})
+	if capacity > 0 {
+		du.CapacityShare = float64(du.StoredSize) / float64(capacity)
+	}
+	return du
+}
+
+// DiskUsage returns the usage of the allocation by the file or the directory
+// at the path, from the object trees of the blobbers. Like the file meta, an
+// entry is counted only when the data shards of its blobbers agree on it, the
+// entries left on a few stale blobbers aren't. The usage of the
+// entries of a directory is reported down to the depth, a depth of zero
+// reports the directory alone and a negative depth reports all the levels.
+//
+// The capacity share is relative to the capacity of all the blobbers, which
+// hold the allocation size over the data shards each.
+func (a *Allocation) DiskUsage(path string, depth int) (*DiskUsage, error) {
+	if !a.isInitialized() {
+		return nil, notInitialized
+	}
+	if len(path) == 0 {
+		return nil, errors.New("invalid_path", "Invalid path for the disk usage")
+	}
+	path = zboxutil.RemoteClean(path)
+	if !zboxutil.IsRemoteAbs(path) {
+		return nil, errors.New("invalid_path", "Path should be valid and absolute")
+	}
+
+	trees := make([]fileref.RefEntity, len(a.Blobbers))
+	wg := &sync.WaitGroup{}
+	wg.Add(len(a.Blobbers))
+	for i, blobber := range a.Blobbers {
+		go func(i int, blobber *blockchain.StorageNode) {
+			defer wg.Done()
+			tree, err := getObjectTreeFromBlobber(a.ctx, a.ID, a.Tx, path, blobber)
+			if err != nil {
+				Logger.Error(blobber.Baseurl, " disk usage: ", err)
+				return
+			}
+			trees[i] = tree
+		}(i, blobber)
+	}
+	wg.Wait()
+
+	root := &duNode{}
+	var found int
+	for _, tree := range trees {
+		if tree == nil {
+			continue
+		}
+		found++
+		root.add(tree)
+	}
+	// the data shards are needed for the files, so are their object trees
+	if found == 0 || found < a.DataShards {
+		return nil, errors.New("disk_usage_failed", "Failed to get the object tree from the blobbers")
+	}
+
+	var capacity int64
+	if a.DataShards > 0 {
+		capacity = a.Size / int64(a.DataShards) * int64(a.DataShards+a.ParityShards)
+	}
+	du := root.usage(depth, capacity, a.DataShards)
+	if du == nil {
+		return nil, errors.New("disk_usage_failed", "No consensus on the object tree of "+path)
+	}
+	return du, nil
+}
@@ -0,0 +1,141 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocation_DiskUsage(t *testing.T) {
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	tree := func(stale bool) []byte {
+		list := []*fileref.ReferencePath{
+			{
+				Meta: map[string]interface{}{"type": fileref.FILE, "name": "a.txt", "path": "/a.txt",
+					"size": 50, "actual_file_size": 100, "actual_file_hash": "a"},
+			},
+			{
+				Meta: map[string]interface{}{"type": fileref.DIRECTORY, "name": "d", "path": "/d"},
+				List: []*fileref.ReferencePath{
+					{
+						Meta: map[string]interface{}{"type": fileref.FILE, "name": "b.txt", "path": "/d/b.txt",
+							"size": 25, "actual_file_size": 50, "actual_file_hash": "b"},
+					},
+				},
+			},
+		}
+		if stale {
+			list = append(list, &fileref.ReferencePath{
+				Meta: map[string]interface{}{"type": fileref.FILE, "name": "c.txt", "path": "/c.txt",
+					"size": 500, "actual_file_size": 1000, "actual_file_hash": "c"},
+			}, &fileref.ReferencePath{
+				Meta: map[string]interface{}{"type": fileref.DIRECTORY, "name": "e", "path": "/e"},
+			})
+		}
+		body, err := json.Marshal(&fileref.ReferencePath{
+			Meta: map[string]interface{}{"type": fileref.DIRECTORY, "name": "/", "path": "/"},
+			List: list,
+		})
+		require.NoError(t, err)
+		return body
+	}
+	body, staleBody := tree(false), tree(true)
+
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.Contains(req.URL.Path, zboxutil.OBJECT_TREE_ENDPOINT)
+	})).Return(func(req *http.Request) *http.Response {
+		// the last blobber fails
+		if strings.HasSuffix(req.URL.Path[:strings.Index(req.URL.Path, zboxutil.OBJECT_TREE_ENDPOINT)], "3") {
+			return &http.Response{
+				StatusCode: http.StatusBadRequest,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			}
+		}
+		// the third blobber has files and dirs left by a failed commit
+		if strings.HasSuffix(req.URL.Path[:strings.Index(req.URL.Path, zboxutil.OBJECT_TREE_ENDPOINT)], "2") {
+			return &http.Response{
+				StatusCode: http.StatusOK,
+				Body:       ioutil.NopCloser(bytes.NewReader(staleBody)),
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+
+	a := &Allocation{DataShards: 2, ParityShards: 2, Size: 1000}
+	setupMockAllocation(t, a)
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      mockBlobberId + strconv.Itoa(i),
+			Baseurl: t.Name() + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+
+	tests := []struct {
+		name         string
+		depth        int
+		wantChildren []string
+	}{
+		{
+			name:  "Test_Depth_Zero",
+			depth: 0,
+		},
+		{
+			name:         "Test_Depth_One",
+			depth:        1,
+			wantChildren: []string{"/a.txt", "/d"},
+		},
+		{
+			name:         "Test_All_Levels",
+			depth:        -1,
+			wantChildren: []string{"/a.txt", "/d", "/d/b.txt"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			du, err := a.DiskUsage("/", tt.depth)
+			require.NoError(err)
+			require.EqualValues(150, du.ActualSize)
+			require.EqualValues(3*75, du.StoredSize)
+			require.EqualValues(2, du.NumFiles)
+			require.EqualValues(1, du.NumDirs)
+			require.InDelta(225.0/2000, du.CapacityShare, 1e-9)
+
+			var children []string
+			var walk func(du *DiskUsage)
+			walk = func(du *DiskUsage) {
+				for _, child := range du.Children {
+					children = append(children, child.Path)
+					walk(child)
+				}
+			}
+			walk(du)
+			require.EqualValues(tt.wantChildren, children)
+		})
+	}
+}
@@ -0,0 +1,172 @@
+package sdk
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// DownloadOption changes the way a file is downloaded.
+type DownloadOption func(req *DownloadRequest)
+
+// WithResume makes the download resumable. The progress is recorded next to
+// the local file, and a download of an existing partial file continues from
+// the first block which is missing or doesn't match the record. The partial
+// file is kept when the download fails. An existing local file without a
+// progress record isn't a partial download, it's never overwritten.
+func WithResume() DownloadOption {
+	return func(req *DownloadRequest) {
+		req.resume = true
+	}
+}
+
+// downloadProgress is the sidecar record of a resumable download. The
+// record is a JSON line of the file followed by the hashes of the blocks
+// written, a line each, so the blocks are recorded by appending them.
+type downloadProgress struct {
+	ActualFileHash string `json:"actual_file_hash"`
+	Size           int64  `json:"size"`
+	BlockSize      int64  `json:"block_size"`
+	// BlockHashes are the hashes of the blocks written to the local file
+	BlockHashes []string `json:"-"`
+
+	path string
+}
+
+func downloadProgressPath(localPath string) string {
+	return localPath + ".progress"
+}
+
+// hasDownloadProgress tells whether the local file is a partial download
+// with a progress record.
+func hasDownloadProgress(localPath string) bool {
+	_, err := os.Stat(downloadProgressPath(localPath))
+	return err == nil
+}
+
+// load reads the record at the path of the progress.
+func (p *downloadProgress) load() error {
+	content, err := ioutil.ReadFile(p.path)
+	if err != nil {
+		return err
+	}
+	lines := strings.Split(strings.TrimSuffix(string(content), "\n"), "\n")
+	if err = json.Unmarshal([]byte(lines[0]), p); err != nil {
+		return err
+	}
+	p.BlockHashes = lines[1:]
+	return nil
+}
+
+func (p *downloadProgress) matches(fileRef *fileref.FileRef, blockSize int64) bool {
+	return p.ActualFileHash == fileRef.ActualFileHash &&
+		p.Size == fileRef.ActualFileSize && p.BlockSize == blockSize
+}
+
+// save writes the whole record.
+func (p *downloadProgress) save() {
+	header, err := json.Marshal(p)
+	if err != nil {
+		Logger.Error("Download progress marshal error: ", err)
+		return
+	}
+	content := bytes.NewBuffer(header)
+	content.WriteString("\n")
+	for _, blockHash := range p.BlockHashes {
+		content.WriteString(blockHash + "\n")
+	}
+	tmpPath := p.path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, content.Bytes(), 0600); err != nil {
+		Logger.Error("Download progress write error: ", err)
+		return
+	}
+	if err = os.Rename(tmpPath, p.path); err != nil {
+		Logger.Error("Download progress write error: ", err)
+	}
+}
+
+func (p *downloadProgress) remove() {
+	os.Remove(p.path)
+}
+
+// addBlocks records the blocks written to the local file, their hashes are
+// appended to the record. A missing record is written whole.
+func (p *downloadProgress) addBlocks(data []byte) {
+	var lines bytes.Buffer
+	for len(data) > 0 {
+		n := minInt64(p.BlockSize, int64(len(data)))
+		h := sha1.Sum(data[:n])
+		blockHash := hex.EncodeToString(h[:])
+		p.BlockHashes = append(p.BlockHashes, blockHash)
+		lines.WriteString(blockHash + "\n")
+		data = data[n:]
+	}
+	f, err := os.OpenFile(p.path, os.O_APPEND|os.O_WRONLY, 0600)
+	if os.IsNotExist(err) {
+		p.save()
+		return
+	}
+	if err != nil {
+		Logger.Error("Download progress write error: ", err)
+		return
+	}
+	defer f.Close()
+	if _, err = f.Write(lines.Bytes()); err != nil {
+		Logger.Error("Download progress write error: ", err)
+	}
+}
+
+// resumeDownload checks the blocks in the partial local file against the
+// progress record, writes the valid ones to the file hash and truncates the
+// rest. It returns the progress and the number of valid blocks.
+func (req *DownloadRequest) resumeDownload(fileRef *fileref.FileRef, blockSize int64,
+	wrFile *os.File, fH hash.Hash) (*downloadProgress, int64, error) {
+
+	path := downloadProgressPath(req.localpath)
+	progress := &downloadProgress{path: path}
+	if err := progress.load(); err != nil && !os.IsNotExist(err) {
+		Logger.Error("Invalid download progress ", path, err)
+	}
+	if !progress.matches(fileRef, blockSize) {
+		progress.ActualFileHash = fileRef.ActualFileHash
+		progress.Size = fileRef.ActualFileSize
+		progress.BlockSize = blockSize
+		progress.BlockHashes = nil
+	}
+
+	var valid int64
+	buf := make([]byte, blockSize)
+	for _, blockHash := range progress.BlockHashes {
+		n, err := io.ReadFull(wrFile, buf)
+		if err != nil && err != io.ErrUnexpectedEOF {
+			break
+		}
+		h := sha1.Sum(buf[:n])
+		if hex.EncodeToString(h[:]) != blockHash {
+			break
+		}
+		fH.Write(buf[:n])
+		valid++
+	}
+	progress.BlockHashes = progress.BlockHashes[:valid]
+
+	offset := minInt64(valid*blockSize, fileRef.ActualFileSize)
+	if err := wrFile.Truncate(offset); err != nil {
+		return nil, 0, err
+	}
+	if _, err := wrFile.Seek(offset, io.SeekStart); err != nil {
+		return nil, 0, err
+	}
+	progress.save()
+	Logger.Info("Resuming download of ", req.remotefilepath, " from block ", valid+1)
+	return progress, valid, nil
+}
@@ -0,0 +1,122 @@
+package sdk
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadRequest_resumeDownload(t *testing.T) {
+	const blockSize = 4
+	content := []byte("0123456789")
+	fileHash := sha1.Sum(content)
+	fileRef := &fileref.FileRef{
+		ActualFileHash: hex.EncodeToString(fileHash[:]),
+		ActualFileSize: int64(len(content)),
+	}
+
+	tests := []struct {
+		name      string
+		partial   []byte
+		progress  func(p *downloadProgress)
+		wantValid int64
+	}{
+		{
+			name:      "No_Progress_Restart",
+			partial:   content[:8],
+			wantValid: 0,
+		},
+		{
+			name:    "Valid_Blocks_Resumed",
+			partial: content[:8],
+			progress: func(p *downloadProgress) {
+				p.addBlocks(content[:8])
+			},
+			wantValid: 2,
+		},
+		{
+			name:    "Corrupted_Block_Dropped",
+			partial: []byte("0123x567"),
+			progress: func(p *downloadProgress) {
+				p.addBlocks(content[:8])
+			},
+			wantValid: 1,
+		},
+		{
+			name:    "Other_File_Restart",
+			partial: content[:8],
+			progress: func(p *downloadProgress) {
+				p.addBlocks(content[:8])
+				p.ActualFileHash = "other"
+				p.save()
+			},
+			wantValid: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			localPath := filepath.Join(t.TempDir(), "1.txt")
+			require.NoError(ioutil.WriteFile(localPath, tt.partial, 0644))
+			if tt.progress != nil {
+				p := &downloadProgress{
+					ActualFileHash: fileRef.ActualFileHash,
+					Size:           fileRef.ActualFileSize,
+					BlockSize:      blockSize,
+					path:           downloadProgressPath(localPath),
+				}
+				tt.progress(p)
+			}
+
+			wrFile, err := os.OpenFile(localPath, os.O_RDWR, 0644)
+			require.NoError(err)
+			defer wrFile.Close()
+			req := &DownloadRequest{localpath: localPath}
+			fH := sha1.New()
+			progress, valid, err := req.resumeDownload(fileRef, blockSize, wrFile, fH)
+			require.NoError(err)
+			require.EqualValues(tt.wantValid, valid)
+			require.Len(progress.BlockHashes, int(valid))
+
+			// the rest of the content completes the file hash
+			progress.addBlocks(content[valid*blockSize:])
+			_, err = wrFile.Write(content[valid*blockSize:])
+			require.NoError(err)
+			fH.Write(content[valid*blockSize:])
+			require.EqualValues(fileRef.ActualFileHash, hex.EncodeToString(fH.Sum(nil)))
+
+			written, err := ioutil.ReadFile(localPath)
+			require.NoError(err)
+			require.EqualValues(content, written)
+		})
+	}
+}
+
+func TestAllocation_DownloadFile_Resume_Existing(t *testing.T) {
+	require := require.New(t)
+	dir := t.TempDir()
+	localPath := filepath.Join(dir, "1.txt")
+	require.NoError(ioutil.WriteFile(localPath, []byte("not a partial download"), 0644))
+
+	a := &Allocation{}
+	setupMockAllocation(t, a)
+
+	// a file without a progress record isn't overwritten
+	err := a.DownloadFile(localPath, "/1.txt", nil, WithResume())
+	require.EqualError(err, "Local path is not a directory '"+localPath+"'")
+	err = a.DownloadFile(dir, "/1.txt", nil, WithResume())
+	require.EqualError(err, "Local file already exists '"+localPath+"'")
+
+	// a partial download is resumed, the allocation fails it without blobbers
+	require.NoError(ioutil.WriteFile(downloadProgressPath(localPath), []byte("{}\n"), 0600))
+	err = a.DownloadFile(localPath, "/1.txt", nil, WithResume())
+	require.EqualError(err, noBLOBBERS.Error())
+	err = a.DownloadFile(dir, "/1.txt", nil, WithResume())
+	require.EqualError(err, noBLOBBERS.Error())
+}
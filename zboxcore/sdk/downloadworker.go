@@ -8,11 +8,14 @@ import (
 	"io"
 	"math"
 	"os"
+	"sort"
 	"sync"
+	"time"
 
 	"go.dedis.ch/kyber/v3/group/edwards25519"
 
 	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/common"
 	"github.com/0chain/gosdk/zboxcore/blockchain"
 	"github.com/0chain/gosdk/zboxcore/client"
 	"github.com/0chain/gosdk/zboxcore/encoder"
@@ -50,39 +53,118 @@ type DownloadRequest struct {
 	isDownloadCanceled bool
 	completedCallback  func(remotepath string, remotepathhash string)
 	contentMode        string
+	resume             bool
+	// shardVerifiers check the shards of the blobbers by the blobber index
+	shardVerifiers map[int]*shardVerifier
+	// corruptedMask has the blobbers which returned corrupted shards
+	corruptedMask zboxutil.Uint128
+	// extraShards is the number of shards fetched for a block besides the
+	// data shards
+	extraShards int
 	Consensus
 }
 
+// rankBlobbers returns the positions of the blobbers in the download mask,
+// the fastest first. The blobbers without a latency come first to get one.
+// The blobbers whose shard is being verified come before all of them, so the
+// same blobbers serve all the blocks of a verified download.
+func (req *DownloadRequest) rankBlobbers() []int {
+	var positions []int
+	var pos uint64
+	for i := req.downloadMask; !i.Equals64(0); i = i.And(zboxutil.NewUint128(1).Lsh(pos).Not()) {
+		pos = uint64(i.TrailingZeros())
+		positions = append(positions, int(pos))
+	}
+	sort.SliceStable(positions, func(i, j int) bool {
+		if vi, vj := req.isVerifying(positions[i]), req.isVerifying(positions[j]); vi != vj {
+			return vi
+		}
+		li, okI := getBlobberLatency(req.blobbers[positions[i]])
+		lj, okJ := getBlobberLatency(req.blobbers[positions[j]])
+		if okI != okJ {
+			return !okI
+		}
+		return li < lj
+	})
+	return positions
+}
+
+const (
+	defaultHedgeDelay = 5 * time.Second
+	minHedgeDelay     = 200 * time.Millisecond
+)
+
+// hedgeDelay returns how long to wait for the blobbers asked first before
+// asking the spare ones too.
+func (req *DownloadRequest) hedgeDelay(positions []int) time.Duration {
+	if downloadHedgeDelay > 0 {
+		return downloadHedgeDelay
+	}
+	positions = positions[:req.shardsToFetch(len(positions))]
+	var slowest time.Duration
+	for _, pos := range positions {
+		latency, ok := getBlobberLatency(req.blobbers[pos])
+		if !ok {
+			return defaultHedgeDelay
+		}
+		if latency > slowest {
+			slowest = latency
+		}
+	}
+	delay := 2 * slowest * time.Duration(req.numBlocks)
+	if delay < minHedgeDelay {
+		return minHedgeDelay
+	}
+	if delay > blobberFailureLatency {
+		return blobberFailureLatency
+	}
+	return delay
+}
+
+// downloadBlock downloads the blocks from the fastest data shards blobbers.
+// The spare blobbers are asked when a blobber fails or when the blobbers are
+// slower than the hedge delay, the rest of the requests are cancelled once
+// there are enough shards to decode.
 func (req *DownloadRequest) downloadBlock(blockNum int64, blockChunksMax int) ([]byte, error) {
 	req.consensus = 0
-	numDownloads := req.downloadMask.CountOnes()
+	ctx, cancel := context.WithCancel(req.ctx)
+	defer cancel()
+	positions := req.rankBlobbers()
+	numDownloads := len(positions)
 	req.wg = &sync.WaitGroup{}
-	req.wg.Add(numDownloads)
 	rspCh := make(chan *downloadBlock, numDownloads)
-	// Download from only specific blobbers
-	var c, pos int = 0, 0
-	for i := req.downloadMask; !i.Equals64(0); i = i.And(zboxutil.NewUint128(1).Lsh(uint64(pos)).Not()) {
-		pos = i.TrailingZeros()
-		blockDownloadReq := &BlockDownloadRequest{}
-		blockDownloadReq.allocationID = req.allocationID
-		blockDownloadReq.allocationTx = req.allocationTx
-		blockDownloadReq.authTicket = req.authTicket
-		blockDownloadReq.blobber = req.blobbers[pos]
-		blockDownloadReq.blobberIdx = pos
-		blockDownloadReq.blockNum = blockNum
-		blockDownloadReq.contentMode = req.contentMode
-		blockDownloadReq.result = rspCh
-		blockDownloadReq.wg = req.wg
-		blockDownloadReq.ctx = req.ctx
-		blockDownloadReq.remotefilepath = req.remotefilepath
-		blockDownloadReq.remotefilepathhash = req.remotefilepathhash
-		blockDownloadReq.numBlocks = req.numBlocks
-		blockDownloadReq.rxPay = req.rxPay
-		blockDownloadReq.encryptedKey = req.encryptedKey
-		go AddBlockDownloadReq(blockDownloadReq)
-		//go obj.downloadBlobberBlock(&obj.blobbers[pos], pos, path, blockNum, rspCh, isPathHash, authTicket)
-		c++
+	sent := 0
+	send := func(n int) {
+		for ; n > 0 && sent < numDownloads; n-- {
+			pos := positions[sent]
+			sent++
+			blockDownloadReq := &BlockDownloadRequest{}
+			blockDownloadReq.allocationID = req.allocationID
+			blockDownloadReq.allocationTx = req.allocationTx
+			blockDownloadReq.authTicket = req.authTicket
+			blockDownloadReq.blobber = req.blobbers[pos]
+			blockDownloadReq.blobberIdx = pos
+			blockDownloadReq.blockNum = blockNum
+			blockDownloadReq.contentMode = req.contentMode
+			blockDownloadReq.result = rspCh
+			blockDownloadReq.wg = req.wg
+			blockDownloadReq.ctx = ctx
+			blockDownloadReq.remotefilepath = req.remotefilepath
+			blockDownloadReq.remotefilepathhash = req.remotefilepathhash
+			blockDownloadReq.numBlocks = req.numBlocks
+			blockDownloadReq.rxPay = req.rxPay
+			blockDownloadReq.encryptedKey = req.encryptedKey
+			req.wg.Add(1)
+			go AddBlockDownloadReq(blockDownloadReq)
+		}
 	}
+	start := time.Now()
+	fetch := req.shardsToFetch(numDownloads)
+	send(fetch)
+	delay := req.hedgeDelay(positions)
+	hedge := time.NewTimer(delay)
+	defer hedge.Stop()
+
 	//req.wg.Wait()
 	shards := make([][][]byte, req.numBlocks)
 	for i := int64(0); i < req.numBlocks; i++ {
@@ -101,19 +183,36 @@ func (req *DownloadRequest) downloadBlock(blockNum int64, blockChunksMax int) ([
 
 	retData := make([]byte, 0)
 	success := 0
+	lastChunks := 0
 	Logger.Info("downloadBlock ", blockNum, " numDownloads ", numDownloads)
 
-	for i := 0; i < numDownloads; i++ {
-		result := <-rspCh
+	received := 0
+	returned := make(map[int]bool)
+	for received < sent {
+		var result *downloadBlock
+		select {
+		case result = <-rspCh:
+			received++
+			returned[result.idx] = true
+		case <-hedge.C:
+			// the blobbers are slow, ask the spare ones too
+			send(fetch - success)
+			hedge.Reset(delay)
+			continue
+		}
 
 		downloadChunks := len(result.BlockChunks)
 		if !result.Success {
 			Logger.Error("Download block : ", req.blobbers[result.idx].Baseurl, " ", result.err)
+			send(1)
 		} else {
 			blockSuccess := false
 			if blockChunksMax < len(result.BlockChunks) {
 				downloadChunks = blockChunksMax
 			}
+			if v, ok := req.shardVerifiers[result.idx]; ok {
+				v.write(blockNum, result.BlockChunks[:downloadChunks])
+			}
 
 			for blockNum := 0; blockNum < downloadChunks; blockNum++ {
 				if len(req.encryptedKey) > 0 {
@@ -145,27 +244,58 @@ func (req *DownloadRequest) downloadBlock(blockNum int64, blockChunksMax int) ([
 			}
 
 			if !blockSuccess {
+				send(1)
 				continue
 			}
 			//fmt.Printf("[%d]:%s Size:%d\n", i, req.blobbers[result.idx].Baseurl, len(shards[result.idx]))
 			success++
-			if success >= req.datashards {
-				decodeNumBlocks = downloadChunks
+			lastChunks = downloadChunks
+			if success >= fetch {
 				break
 			}
 		}
 	}
+	// the blobbers which didn't return the block when the others did are
+	// cancelled, they're scored slower than the block took
+	if received < sent {
+		latency := 2 * time.Since(start) / time.Duration(req.numBlocks)
+		for _, pos := range positions[:sent] {
+			if !returned[pos] {
+				observeBlobberLatency(req.blobbers[pos], latency)
+			}
+		}
+	}
+	// without the shards to check them the blocks are decoded from the data
+	// shards as they are
+	if success >= req.datashards {
+		decodeNumBlocks = lastChunks
+	}
 	erasureencoder, err := encoder.NewEncoder(req.datashards, req.parityshards)
 	if err != nil {
 		return []byte{}, errors.Wrap(err, "encoder init error")
 	}
 	for blockNum := 0; blockNum < decodeNumBlocks; blockNum++ {
-		data, err := erasureencoder.Decode(shards[blockNum], decodeLen[blockNum])
+		// decode a copy, the shards are needed to find a corrupted one
+		in := make([][]byte, len(shards[blockNum]))
+		copy(in, shards[blockNum])
+		data, err := erasureencoder.Decode(in, decodeLen[blockNum])
 		if err != nil {
-			return []byte{}, errors.Wrap(err, "Block decode error")
+			corrupted := req.findCorruptedShard(erasureencoder, shards[blockNum], decodeLen[blockNum])
+			if corrupted < 0 {
+				return []byte{}, errors.Wrap(err, "Block decode error")
+			}
+			req.reportCorruptedShard(corrupted, err)
+			for i := range shards {
+				shards[i][corrupted] = nil
+			}
+			data, err = erasureencoder.Decode(shards[blockNum], decodeLen[blockNum])
+			if err != nil {
+				return []byte{}, errors.Wrap(err, "Block decode error")
+			}
 		}
 		retData = append(retData, data...)
 	}
+	req.skipIncompleteShards(blockNum + int64(decodeNumBlocks))
 	return retData, nil
 }
 
@@ -191,13 +321,24 @@ func (req *DownloadRequest) processDownload(ctx context.Context) {
 	listReq.authToken = req.authTicket
 	listReq.fullconsensus = req.fullconsensus
 	listReq.consensusThresh = req.consensusThresh
-	req.downloadMask, fileRef, _ = listReq.getFileConsensusFromBlobbers()
+	var refs []*fileMetaResponse
+	req.downloadMask, fileRef, refs = listReq.getFileConsensusFromBlobbers()
+	// leave out the blobbers which returned corrupted shards before
+	req.downloadMask = req.downloadMask.And(req.corruptedMask.Not())
+	corruptedCount := req.corruptedMask.CountOnes()
 	if req.downloadMask.Equals64(0) || fileRef == nil {
 		if req.statusCallback != nil {
 			req.statusCallback.Error(req.allocationID, remotePathCallback, OpDownload, errors.New("", "No minimum consensus for file meta data of file"))
 		}
 		return
 	}
+	// the expiry is enforced by the clients, the blobbers still serve the file
+	if fileRef.Attributes.IsExpired(common.Now()) {
+		if req.statusCallback != nil {
+			req.statusCallback.Error(req.allocationID, remotePathCallback, OpDownload, errors.New("file_expired", "The file expired at "+fileRef.Attributes.ExpiresAt.ToTime().String()))
+		}
+		return
+	}
 
 	size := fileRef.ActualFileSize
 	if req.contentMode == DOWNLOAD_CONTENT_THUMB {
@@ -217,7 +358,14 @@ func (req *DownloadRequest) processDownload(ctx context.Context) {
 		perShard += chunksPerShard * (16 + (2 * 1024))
 	}
 
-	wrFile, err := os.OpenFile(req.localpath, os.O_CREATE|os.O_WRONLY, 0644)
+	// resume only the downloads of the whole file
+	resume := req.resume && req.contentMode == DOWNLOAD_CONTENT_FULL &&
+		req.startBlock == 0 && (req.endBlock == 0 || req.endBlock == chunksPerShard)
+	flag := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if resume {
+		flag = os.O_CREATE | os.O_RDWR
+	}
+	wrFile, err := os.OpenFile(req.localpath, flag, 0644)
 	if err != nil {
 		if req.statusCallback != nil {
 			Logger.Error(err.Error())
@@ -234,6 +382,10 @@ func (req *DownloadRequest) processDownload(ctx context.Context) {
 	if req.endBlock == 0 {
 		req.endBlock = chunksPerShard
 	}
+	req.shardVerifiers = nil
+	if req.contentMode == DOWNLOAD_CONTENT_FULL && req.startBlock == 0 && req.endBlock == chunksPerShard {
+		req.setupShardVerifiers(refs, chunksPerShard)
+	}
 
 	Logger.Info("Download Size:", size, " Shard:", perShard, " chunks/shard:", chunksPerShard)
 	Logger.Info("Start block: ", req.startBlock+1, " End block: ", req.endBlock, " Num blocks: ", req.numBlocks)
@@ -246,6 +398,28 @@ func (req *DownloadRequest) processDownload(ctx context.Context) {
 	endBlock := req.endBlock
 	numBlocks := req.numBlocks
 
+	var progress *downloadProgress
+	if resume {
+		var validBlocks int64
+		progress, validBlocks, err = req.resumeDownload(fileRef, chunkSizeWithHeader*int64(req.datashards), wrFile, fH)
+		if err != nil {
+			if req.statusCallback != nil {
+				req.statusCallback.Error(req.allocationID, remotePathCallback, OpDownload, errors.Wrap(err, "Can't resume the download"))
+			}
+			return
+		}
+		startBlock += validBlocks
+		offset := int64(math.Min(float64(size), float64(validBlocks*chunkSizeWithHeader*int64(req.datashards))))
+		downloaded = int(offset)
+		size = size - offset
+	}
+	// removePartial drops the partial local file unless it can be resumed
+	removePartial := func() {
+		if progress == nil {
+			os.Remove(req.localpath)
+		}
+	}
+
 	for startBlock < endBlock {
 		cnt := startBlock
 		Logger.Info("Downloading block ", cnt+1)
@@ -255,7 +429,7 @@ func (req *DownloadRequest) processDownload(ctx context.Context) {
 
 		data, err := req.downloadBlock(cnt+1, int(numBlocks))
 		if err != nil {
-			os.Remove(req.localpath)
+			removePartial()
 			if req.statusCallback != nil {
 				req.statusCallback.Error(req.allocationID, remotePathCallback, OpDownload, errors.Wrap(err, fmt.Sprintf("Download failed for block %d. ", cnt+1)))
 			}
@@ -263,7 +437,7 @@ func (req *DownloadRequest) processDownload(ctx context.Context) {
 		}
 		if req.isDownloadCanceled {
 			req.isDownloadCanceled = false
-			os.Remove(req.localpath)
+			removePartial()
 			if req.statusCallback != nil {
 				req.statusCallback.Error(req.allocationID, remotePathCallback, OpDownload, errors.New("","Download aborted by user"))
 			}
@@ -273,7 +447,7 @@ func (req *DownloadRequest) processDownload(ctx context.Context) {
 		n := int64(math.Min(float64(size), float64(len(data))))
 		_, err = mW.Write(data[:n])
 		if err != nil {
-			os.Remove(req.localpath)
+			removePartial()
 			if req.statusCallback != nil {
 				req.statusCallback.Error(req.allocationID, remotePathCallback, OpDownload, errors.Wrap(err, "Write file failed"))
 			}
@@ -281,6 +455,9 @@ func (req *DownloadRequest) processDownload(ctx context.Context) {
 		}
 		downloaded = downloaded + int(n)
 		size = size - n
+		if progress != nil {
+			progress.addBlocks(data[:n])
+		}
 
 		if req.statusCallback != nil {
 			req.statusCallback.InProgress(req.allocationID, remotePathCallback, OpDownload, downloaded, data)
@@ -295,13 +472,35 @@ func (req *DownloadRequest) processDownload(ctx context.Context) {
 
 	// Only check hash when the download request is not by block/partial.
 	if req.endBlock == chunksPerShard && req.startBlock == 0 {
+		req.verifyShards()
 		calcHash := hex.EncodeToString(fH.Sum(nil))
 		expectedHash := fileRef.ActualFileHash
 		if req.contentMode == DOWNLOAD_CONTENT_THUMB {
 			expectedHash = fileRef.ActualThumbnailHash
 		}
 		if calcHash != expectedHash {
+			if progress != nil {
+				progress.remove()
+			}
 			os.Remove(req.localpath)
+			if req.corruptedMask.CountOnes() > corruptedCount && req.downloadMask.CountOnes() >= req.datashards {
+				// download again without the corrupted shards found
+				Logger.Info("Downloading ", remotePathCallback, " again without the corrupted shards")
+				wrFile.Close()
+				req.completedCallback = nil
+				req.processDownload(ctx)
+				return
+			}
+			if req.extraShards == 0 && req.downloadMask.CountOnes() > req.datashards {
+				// download again with the shards to find the corrupted ones by
+				// the block
+				Logger.Info("Downloading ", remotePathCallback, " again to find the corrupted shards")
+				wrFile.Close()
+				req.completedCallback = nil
+				req.extraShards = 2
+				req.processDownload(ctx)
+				return
+			}
 			if req.statusCallback != nil {
 				req.statusCallback.Error(req.allocationID, remotePathCallback, OpDownload, errors.New("","File content didn't match with uploaded file"))
 			}
@@ -309,6 +508,9 @@ func (req *DownloadRequest) processDownload(ctx context.Context) {
 		}
 	}
 
+	if progress != nil {
+		progress.remove()
+	}
 	wrFile.Sync()
 	wrFile.Close()
 	wrFile, _ = os.Open(req.localpath)
@@ -0,0 +1,161 @@
+package sdk
+
+import (
+	"context"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	"github.com/0chain/gosdk/zboxcore/encoder"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDownloadRequest_rankBlobbers(t *testing.T) {
+	tests := []struct {
+		name      string
+		latencies map[int]time.Duration
+		mask      zboxutil.Uint128
+		hedge     time.Duration
+		wantRank  []int
+		wantDelay time.Duration
+	}{
+		{
+			name:      "Test_Unknown_Latency_First",
+			latencies: map[int]time.Duration{0: time.Second, 2: 100 * time.Millisecond},
+			mask:      zboxutil.NewUint128(15),
+			wantRank:  []int{1, 3, 2, 0},
+			wantDelay: defaultHedgeDelay,
+		},
+		{
+			name:      "Test_Fastest_First",
+			latencies: map[int]time.Duration{0: time.Second, 1: 300 * time.Millisecond, 2: 100 * time.Millisecond, 3: 2 * time.Second},
+			mask:      zboxutil.NewUint128(15),
+			wantRank:  []int{2, 1, 0, 3},
+			wantDelay: 600 * time.Millisecond,
+		},
+		{
+			name:      "Test_Mask_And_Min_Delay",
+			latencies: map[int]time.Duration{0: time.Millisecond, 1: time.Millisecond, 2: 2 * time.Millisecond, 3: 3 * time.Millisecond},
+			mask:      zboxutil.NewUint128(13),
+			wantRank:  []int{0, 2, 3},
+			wantDelay: minHedgeDelay,
+		},
+		{
+			name:      "Test_Fixed_Delay",
+			latencies: map[int]time.Duration{0: time.Second, 1: time.Second, 2: time.Second, 3: time.Second},
+			mask:      zboxutil.NewUint128(15),
+			hedge:     time.Second,
+			wantRank:  []int{0, 1, 2, 3},
+			wantDelay: time.Second,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			req := &DownloadRequest{datashards: 2, parityshards: 2, numBlocks: 1, downloadMask: tt.mask}
+			for i := 0; i < numBlobbers; i++ {
+				blobber := &blockchain.StorageNode{ID: tt.name + mockBlobberId + strconv.Itoa(i)}
+				req.blobbers = append(req.blobbers, blobber)
+				if latency, ok := tt.latencies[i]; ok {
+					observeBlobberLatency(blobber, latency)
+				}
+			}
+			downloadHedgeDelay = tt.hedge
+			defer func() { downloadHedgeDelay = 0 }()
+
+			positions := req.rankBlobbers()
+			require.EqualValues(tt.wantRank, positions)
+			require.EqualValues(tt.wantDelay, req.hedgeDelay(positions))
+		})
+	}
+}
+
+func TestObserveBlobberLatency(t *testing.T) {
+	blobber := &blockchain.StorageNode{ID: "TestObserveBlobberLatency" + mockBlobberId}
+	_, ok := getBlobberLatency(blobber)
+	require.False(t, ok)
+
+	observeBlobberLatency(blobber, time.Second)
+	latency, _ := getBlobberLatency(blobber)
+	require.EqualValues(t, time.Second, latency)
+
+	observeBlobberLatency(blobber, 2*time.Second)
+	latency, _ = getBlobberLatency(blobber)
+	require.EqualValues(t, 1300*time.Millisecond, latency)
+}
+
+// setupMockBlockDownload serves the block downloads sent to the blobbers with
+// the serve function, called for every request on its own.
+func setupMockBlockDownload(t *testing.T, blobbers []*blockchain.StorageNode,
+	serve func(blockReq *BlockDownloadRequest) *downloadBlock) {
+
+	initDownloadMutex.Lock()
+	defer initDownloadMutex.Unlock()
+	if downloadBlockChan == nil {
+		downloadBlockChan = make(map[string]chan *BlockDownloadRequest)
+	}
+	for _, blobber := range blobbers {
+		blobberChan := make(chan *BlockDownloadRequest, 1)
+		downloadBlockChan[blobber.ID] = blobberChan
+		go func() {
+			for blockReq := range blobberChan {
+				go func(blockReq *BlockDownloadRequest) {
+					defer blockReq.wg.Done()
+					blockReq.result <- serve(blockReq)
+				}(blockReq)
+			}
+		}()
+	}
+	t.Cleanup(func() {
+		initDownloadMutex.Lock()
+		defer initDownloadMutex.Unlock()
+		for _, blobber := range blobbers {
+			close(downloadBlockChan[blobber.ID])
+			delete(downloadBlockChan, blobber.ID)
+		}
+	})
+}
+
+func TestDownloadRequest_downloadBlock_Cancelled_Latency(t *testing.T) {
+	require := require.New(t)
+	erasureencoder, err := encoder.NewEncoder(2, 4)
+	require.NoError(err)
+	data := make([]byte, 2*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	shards, err := erasureencoder.Encode(data)
+	require.NoError(err)
+
+	req := &DownloadRequest{
+		datashards:   2,
+		parityshards: 4,
+		numBlocks:    1,
+		ctx:          context.Background(),
+		downloadMask: zboxutil.NewUint128(63),
+	}
+	for i := range shards {
+		req.blobbers = append(req.blobbers, &blockchain.StorageNode{ID: t.Name() + mockBlobberId + strconv.Itoa(i)})
+	}
+	// the first blobber asked doesn't return the block till it's cancelled
+	setupMockBlockDownload(t, req.blobbers, func(blockReq *BlockDownloadRequest) *downloadBlock {
+		if blockReq.blobberIdx == 0 {
+			<-blockReq.ctx.Done()
+			return &downloadBlock{idx: blockReq.blobberIdx, err: blockReq.ctx.Err()}
+		}
+		return &downloadBlock{Success: true, idx: blockReq.blobberIdx, BlockChunks: [][]byte{shards[blockReq.blobberIdx]}}
+	})
+	downloadHedgeDelay = 50 * time.Millisecond
+	defer func() { downloadHedgeDelay = 0 }()
+
+	got, err := req.downloadBlock(1, 1)
+	require.NoError(err)
+	require.EqualValues(data, got)
+	// the cancelled blobber is scored slower than the block took
+	latency, ok := getBlobberLatency(req.blobbers[0])
+	require.True(ok)
+	require.True(latency >= 2*downloadHedgeDelay, latency)
+	require.EqualValues(0, req.rankBlobbers()[len(shards)-1])
+}
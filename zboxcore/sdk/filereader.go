@@ -0,0 +1,286 @@
+package sdk
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"io"
+	"sync"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/common"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// RemoteFileReader reads a remote file at random offsets, it implements
+// io.ReadSeeker, io.ReaderAt and io.Closer. The file is fetched by blocks
+// when read, the latest fetched blocks are kept in memory.
+type RemoteFileReader struct {
+	req     *DownloadRequest
+	fileRef *fileref.FileRef
+	cancel  context.CancelFunc
+	size    int64
+	// blockSize is the size of the file content in a block of all shards
+	blockSize int64
+	numBlocks int64
+	offset    int64
+	// cache keeps the latest fetched blocks by the block index
+	cache map[int64][]byte
+	mutex sync.Mutex
+}
+
+// OpenReader opens the remote file for reading. The reader has to be closed
+// when it isn't needed any more.
+func (a *Allocation) OpenReader(remotePath string) (*RemoteFileReader, error) {
+	if !a.isInitialized() {
+		return nil, notInitialized
+	}
+	if len(remotePath) == 0 {
+		return nil, errors.New("invalid_path", "Invalid path for the reader")
+	}
+	remotePath = zboxutil.RemoteClean(remotePath)
+	if !zboxutil.IsRemoteAbs(remotePath) {
+		return nil, errors.New("invalid_path", "Path should be valid and absolute")
+	}
+	if len(a.Blobbers) <= 1 {
+		return nil, noBLOBBERS
+	}
+
+	req := &DownloadRequest{}
+	req.allocationID = a.ID
+	req.allocationTx = a.Tx
+	req.remotefilepath = remotePath
+	return a.openReader(req)
+}
+
+// OpenReaderFromAuthTicket opens the file shared by the auth ticket for
+// reading. The reader has to be closed when it isn't needed any more.
+func (a *Allocation) OpenReaderFromAuthTicket(authTicket string,
+	remoteLookupHash string, rxPay bool) (*RemoteFileReader, error) {
+
+	if !a.isInitialized() {
+		return nil, notInitialized
+	}
+	at, err := decodeAuthTicket(authTicket)
+	if err != nil {
+		return nil, err
+	}
+	if len(a.Blobbers) <= 1 {
+		return nil, noBLOBBERS
+	}
+
+	req := &DownloadRequest{}
+	req.allocationID = a.ID
+	req.allocationTx = a.Tx
+	req.remotefilepathhash = remoteLookupHash
+	req.authTicket = at
+	req.rxPay = rxPay
+	return a.openReader(req)
+}
+
+// openReader completes the download request and gets the consensus on the
+// file, the request has to have the path or the auth ticket set.
+func (a *Allocation) openReader(req *DownloadRequest) (*RemoteFileReader, error) {
+	var cancel context.CancelFunc
+	req.ctx, cancel = context.WithCancel(a.ctx)
+	req.blobbers = a.Blobbers
+	req.datashards = a.DataShards
+	req.parityshards = a.ParityShards
+	req.contentMode = DOWNLOAD_CONTENT_FULL
+	req.consensusThresh = (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards)
+	req.fullconsensus = float32(a.DataShards + a.ParityShards)
+
+	listReq := &ListRequest{
+		remotefilepath:     req.remotefilepath,
+		remotefilepathhash: req.remotefilepathhash,
+		allocationID:       req.allocationID,
+		allocationTx:       req.allocationTx,
+		blobbers:           req.blobbers,
+		ctx:                req.ctx,
+	}
+	listReq.authToken = req.authTicket
+	listReq.fullconsensus = req.fullconsensus
+	listReq.consensusThresh = req.consensusThresh
+	var fileRef *fileref.FileRef
+	req.downloadMask, fileRef, _ = listReq.getFileConsensusFromBlobbers()
+	if req.downloadMask.Equals64(0) || fileRef == nil {
+		cancel()
+		return nil, errors.New("consensus_not_met", "No minimum consensus for file meta data of file")
+	}
+	if fileRef.Attributes.IsExpired(common.Now()) {
+		cancel()
+		return nil, errors.New("file_expired", "The file expired at "+fileRef.Attributes.ExpiresAt.ToTime().String())
+	}
+	req.encryptedKey = fileRef.EncryptedKey
+
+	chunkSize := int64(fileref.CHUNK_SIZE)
+	if len(fileRef.EncryptedKey) > 0 {
+		chunkSize -= 16
+		chunkSize -= 2 * 1024
+	}
+	r := &RemoteFileReader{
+		req:       req,
+		fileRef:   fileRef,
+		cancel:    cancel,
+		size:      fileRef.ActualFileSize,
+		blockSize: chunkSize * int64(a.DataShards),
+		cache:     make(map[int64][]byte),
+	}
+	r.numBlocks = (r.size + r.blockSize - 1) / r.blockSize
+	return r, nil
+}
+
+// Size returns the size of the file.
+func (r *RemoteFileReader) Size() int64 {
+	return r.size
+}
+
+// FileRef returns the ref of the file the reader reads.
+func (r *RemoteFileReader) FileRef() *fileref.FileRef {
+	return r.fileRef
+}
+
+// fetchBlocks downloads count blocks starting at the block index into the
+// cache.
+func (r *RemoteFileReader) fetchBlocks(block, count int64) error {
+	if block+count > r.numBlocks {
+		count = r.numBlocks - block
+	}
+	r.req.numBlocks = count
+	data, err := r.req.downloadBlock(block+1, int(count))
+	if err != nil {
+		return errors.Wrap(err, "Download failed")
+	}
+	if len(data) == 0 {
+		return errors.New("download_failed", "Not enough blobbers responded for the block")
+	}
+
+	r.cache = make(map[int64][]byte, count)
+	for i := int64(0); i < count && len(data) > 0; i++ {
+		n := minInt64(r.blockSize, int64(len(data)))
+		blockData := data[:n]
+		data = data[n:]
+		// drop the padding of the last block
+		if end := (block+i)*r.blockSize + n; end > r.size {
+			blockData = blockData[:n-(end-r.size)]
+		}
+		r.cache[block+i] = blockData
+	}
+	return nil
+}
+
+func minInt64(x, y int64) int64 {
+	if x < y {
+		return x
+	}
+	return y
+}
+
+// readAt reads the file at the offset, with readAhead it fetches the blocks
+// following the read ones too.
+func (r *RemoteFileReader) readAt(p []byte, off int64, readAhead bool) (int, error) {
+	if off < 0 {
+		return 0, errors.New("invalid_offset", "Negative offset")
+	}
+	if off >= r.size {
+		return 0, io.EOF
+	}
+
+	n := 0
+	for n < len(p) && off < r.size {
+		block := off / r.blockSize
+		data, ok := r.cache[block]
+		if !ok {
+			// fetch the blocks the read needs, limited by the blocks downloaded
+			// in one request
+			count := (minInt64(off+int64(len(p)-n), r.size)-1)/r.blockSize - block + 1
+			if readAhead || count > int64(numBlockDownloads) {
+				count = int64(numBlockDownloads)
+			}
+			if err := r.fetchBlocks(block, count); err != nil {
+				return n, err
+			}
+			if data, ok = r.cache[block]; !ok {
+				return n, errors.New("download_failed", "Block is missing in the download")
+			}
+		}
+		start := off - block*r.blockSize
+		if start >= int64(len(data)) {
+			return n, io.ErrUnexpectedEOF
+		}
+		c := copy(p[n:], data[start:])
+		n += c
+		off += int64(c)
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// writeTo copies the whole file into the writer and checks its content hash.
+func (r *RemoteFileReader) writeTo(w io.Writer) error {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	fH := sha1.New()
+	if _, err := io.Copy(io.MultiWriter(w, fH), r); err != nil {
+		return err
+	}
+	if hex.EncodeToString(fH.Sum(nil)) != r.fileRef.ActualFileHash {
+		return errors.New("hash_mismatch", "File content didn't match with uploaded file")
+	}
+	return nil
+}
+
+// ReadAt implements io.ReaderAt.
+func (r *RemoteFileReader) ReadAt(p []byte, off int64) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.readAt(p, off, false)
+}
+
+// Read implements io.Reader, it reads ahead the following blocks.
+func (r *RemoteFileReader) Read(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if len(p) == 0 {
+		return 0, nil
+	}
+	n, err := r.readAt(p, r.offset, true)
+	r.offset += int64(n)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+// Seek implements io.Seeker.
+func (r *RemoteFileReader) Seek(offset int64, whence int) (int64, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += r.offset
+	case io.SeekEnd:
+		offset += r.size
+	default:
+		return 0, errors.New("invalid_whence", "Invalid whence for seek")
+	}
+	if offset < 0 {
+		return 0, errors.New("invalid_offset", "Negative offset")
+	}
+	r.offset = offset
+	return offset, nil
+}
+
+// Close stops the reader and drops the fetched blocks.
+func (r *RemoteFileReader) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.cancel()
+	r.cache = make(map[int64][]byte)
+	return nil
+}
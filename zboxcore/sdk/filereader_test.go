@@ -0,0 +1,174 @@
+package sdk
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/0chain/gosdk/core/common"
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRemoteFileReader(content []byte, blockSize int64) *RemoteFileReader {
+	r := &RemoteFileReader{
+		size:      int64(len(content)),
+		blockSize: blockSize,
+		cache:     make(map[int64][]byte),
+		cancel:    func() {},
+	}
+	r.numBlocks = (r.size + blockSize - 1) / blockSize
+	for i := int64(0); i < r.numBlocks; i++ {
+		end := minInt64((i+1)*blockSize, r.size)
+		r.cache[i] = content[i*blockSize : end]
+	}
+	return r
+}
+
+func TestRemoteFileReader_ReadAt(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	tests := []struct {
+		name    string
+		off     int64
+		size    int
+		want    string
+		wantErr error
+	}{
+		{"Within_Block", 1, 3, "123", nil},
+		{"Across_Blocks", 6, 6, "6789ab", nil},
+		{"Till_End", 16, 4, "ghij", nil},
+		{"Past_End", 18, 4, "ij", io.EOF},
+		{"At_End", 20, 1, "", io.EOF},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRemoteFileReader(content, 8)
+			p := make([]byte, tt.size)
+			n, err := r.ReadAt(p, tt.off)
+			require.EqualValues(t, tt.wantErr, err)
+			require.EqualValues(t, tt.want, string(p[:n]))
+		})
+	}
+}
+
+func TestRemoteFileReader_SeekAndRead(t *testing.T) {
+	require := require.New(t)
+	content := []byte("0123456789abcdefghij")
+	r := newTestRemoteFileReader(content, 8)
+
+	off, err := r.Seek(-4, io.SeekEnd)
+	require.NoError(err)
+	require.EqualValues(16, off)
+	data, err := ioutil.ReadAll(r)
+	require.NoError(err)
+	require.EqualValues("ghij", string(data))
+
+	_, err = r.Seek(0, io.SeekStart)
+	require.NoError(err)
+	data, err = ioutil.ReadAll(r)
+	require.NoError(err)
+	require.EqualValues(content, data)
+
+	_, err = r.Seek(-1, io.SeekStart)
+	require.Error(err)
+	require.NoError(r.Close())
+}
+
+func TestRemoteFileReader_writeTo(t *testing.T) {
+	content := []byte("0123456789abcdefghij")
+	hash := sha1.Sum(content)
+	tests := []struct {
+		name    string
+		hash    string
+		wantErr bool
+	}{
+		{"Test_Success", hex.EncodeToString(hash[:]), false},
+		{"Test_Hash_Mismatch_Failed", "mismatch", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := newTestRemoteFileReader(content, 8)
+			r.fileRef = &fileref.FileRef{ActualFileHash: tt.hash}
+			buf := &bytes.Buffer{}
+			err := r.writeTo(buf)
+			require.EqualValues(t, tt.wantErr, err != nil)
+			require.EqualValues(t, content, buf.Bytes())
+		})
+	}
+}
+
+func TestAllocation_DownloadBytes(t *testing.T) {
+	tests := []struct {
+		name        string
+		remotePath  string
+		initialized bool
+		errMsg      string
+	}{
+		{"Test_Uninitialized_Failed", "/1.txt", false, notInitialized.Error()},
+		{"Test_Empty_Path_Failed", "", true, "invalid_path: Invalid path for the reader"},
+		{"Test_Relative_Path_Failed", "1.txt", true, "invalid_path: Path should be valid and absolute"},
+		{"Test_No_Blobbers_Failed", "/1.txt", true, noBLOBBERS.Error()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &Allocation{initialized: tt.initialized}
+			sdkInitialized = true
+			_, err := a.DownloadBytes(tt.remotePath)
+			require.Error(t, err)
+			require.EqualValues(t, tt.errMsg, err.Error())
+		})
+	}
+}
+
+func TestAllocation_OpenReader_Expired(t *testing.T) {
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	ref := &fileref.FileRef{
+		Ref:        fileref.Ref{Type: fileref.FILE, Path: "/1.txt"},
+		Attributes: fileref.Attributes{ExpiresAt: common.Now() - 10},
+	}
+	body, err := json.Marshal(ref)
+	require.NoError(t, err)
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.Contains(req.URL.Path, zboxutil.FILE_META_ENDPOINT)
+	})).Return(func(*http.Request) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+
+	a := &Allocation{DataShards: 2, ParityShards: 2}
+	setupMockAllocation(t, a)
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      mockBlobberId + strconv.Itoa(i),
+			Baseurl: t.Name() + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+
+	_, err = a.DownloadBytes("/1.txt")
+	require.Error(t, err)
+	require.True(t, strings.HasPrefix(err.Error(), "file_expired: "), err.Error())
+}
@@ -0,0 +1,169 @@
+package sdk
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/common"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// The ways a file can be repaired, see FileHealth.
+const (
+	RepairNone     = "none"
+	RepairByUpload = "upload"
+	RepairByDelete = "delete"
+)
+
+// FileHealth is the state of a file on the blobbers of the allocation.
+type FileHealth struct {
+	Path           string `json:"path"`
+	ActualFileHash string `json:"actual_file_hash,omitempty"`
+	ActualFileSize int64  `json:"actual_file_size"`
+	// Found are the blobbers holding the file with the consensus hash
+	Found []string `json:"found"`
+	// Missing are the blobbers which don't have the file
+	Missing []string `json:"missing,omitempty"`
+	// Stale are the blobbers holding the file with another hash
+	Stale []string `json:"stale,omitempty"`
+	// Repair is RepairNone, RepairByUpload or RepairByDelete
+	Repair string `json:"repair"`
+}
+
+// HealthReport is the result of a health check of the allocation.
+type HealthReport struct {
+	AllocationID string           `json:"allocation_id"`
+	RootPath     string           `json:"root_path"`
+	CheckedAt    common.Timestamp `json:"checked_at"`
+	Files        []*FileHealth    `json:"files"`
+	// Errors has the paths which couldn't be checked with the reason
+	Errors map[string]string `json:"errors,omitempty"`
+
+	TotalFiles     int   `json:"total_files"`
+	HealthyFiles   int   `json:"healthy_files"`
+	RepairByUpload int   `json:"repair_by_upload"`
+	RepairByDelete int   `json:"repair_by_delete"`
+	TotalSize      int64 `json:"total_size"`
+	// RepairSize is the size of the files which need a repair by upload
+	RepairSize int64 `json:"repair_size"`
+}
+
+// JSON returns the report as JSON.
+func (r *HealthReport) JSON() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (r *HealthReport) add(file *FileHealth) {
+	r.Files = append(r.Files, file)
+	r.TotalFiles++
+	r.TotalSize += file.ActualFileSize
+	switch file.Repair {
+	case RepairNone:
+		r.HealthyFiles++
+	case RepairByUpload:
+		r.RepairByUpload++
+		r.RepairSize += file.ActualFileSize
+	case RepairByDelete:
+		r.RepairByDelete++
+	}
+}
+
+// HealthCheck checks the files under the rootPath on all the blobbers of the
+// allocation and reports the ones which need a repair, without repairing
+// them. The files which can't be checked are in the errors of the report.
+func (a *Allocation) HealthCheck(rootPath string) (*HealthReport, error) {
+	if !a.isInitialized() {
+		return nil, notInitialized
+	}
+	fullconsensus := float32(a.DataShards + a.ParityShards)
+	consensusThresh := 100 / fullconsensus
+	listDir, err := a.listDir(rootPath, consensusThresh, fullconsensus)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &HealthReport{
+		AllocationID: a.ID,
+		RootPath:     zboxutil.RemoteClean(rootPath),
+		CheckedAt:    common.Now(),
+		Errors:       make(map[string]string),
+	}
+	// the blobbers with another version of a file list it as another child
+	seen := make(map[string]bool)
+	dirs := []*ListResult{listDir}
+	for len(dirs) > 0 {
+		dir := dirs[0]
+		dirs = dirs[1:]
+		if seen[dir.Path] {
+			continue
+		}
+		seen[dir.Path] = true
+		if dir.Type == fileref.FILE {
+			file, err := a.fileHealth(dir.Path)
+			if err != nil {
+				report.Errors[dir.Path] = err.Error()
+				continue
+			}
+			report.add(file)
+			continue
+		}
+		if len(dir.Children) == 0 && dir != listDir {
+			listed, err := a.listDir(dir.Path, consensusThresh, fullconsensus)
+			if err != nil {
+				report.Errors[dir.Path] = err.Error()
+				continue
+			}
+			dir = listed
+		}
+		dirs = append(dirs, dir.Children...)
+	}
+	sort.Slice(report.Files, func(i, j int) bool {
+		return report.Files[i].Path < report.Files[j].Path
+	})
+	return report, nil
+}
+
+// fileHealth gets the file meta from all the blobbers and compares it with
+// the consensus one.
+func (a *Allocation) fileHealth(remotepath string) (*FileHealth, error) {
+	listReq := &ListRequest{}
+	listReq.allocationID = a.ID
+	listReq.allocationTx = a.Tx
+	listReq.blobbers = a.Blobbers
+	listReq.fullconsensus = float32(a.DataShards + a.ParityShards)
+	listReq.consensusThresh = 100 / listReq.fullconsensus
+	listReq.ctx = a.ctx
+	listReq.remotefilepath = remotepath
+	found, fileRef, refs := listReq.getFileConsensusFromBlobbers()
+	if fileRef == nil {
+		return nil, errors.New("", "File not found for the given remotepath")
+	}
+
+	file := &FileHealth{
+		Path:           remotepath,
+		ActualFileHash: fileRef.ActualFileHash,
+		ActualFileSize: fileRef.ActualFileSize,
+		Found:          []string{},
+		Repair:         RepairNone,
+	}
+	for _, rsp := range refs {
+		blobberID := a.Blobbers[rsp.blobberIdx].ID
+		switch {
+		case !found.And(zboxutil.NewUint128(1).Lsh(uint64(rsp.blobberIdx))).Equals64(0):
+			file.Found = append(file.Found, blobberID)
+		case rsp.err != nil || rsp.fileref == nil:
+			file.Missing = append(file.Missing, blobberID)
+		default:
+			file.Stale = append(file.Stale, blobberID)
+		}
+	}
+	if len(file.Found) < len(a.Blobbers) {
+		file.Repair = RepairByUpload
+		if len(file.Found) < a.DataShards {
+			file.Repair = RepairByDelete
+		}
+	}
+	return file, nil
+}
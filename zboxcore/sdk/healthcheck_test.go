@@ -0,0 +1,154 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocation_HealthCheck(t *testing.T) {
+	const (
+		mockActualHash = "4041e3eeb170751544a47af4e4f9d374e76cee1d"
+		mockStaleHash  = "mock stale hash"
+		mockPath       = "/1.txt"
+	)
+
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	// setupHttpResponses lists the file in the root dir, the file has the
+	// hashes by the blobber, an empty hash is a missing file.
+	setupHttpResponses := func(t *testing.T, testName string, hashes []string) {
+		for i := 0; i < numBlobbers; i++ {
+			url := "TestAllocation_HealthCheck" + testName + mockBlobberUrl + strconv.Itoa(i)
+			hash := hashes[i]
+			mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+				return strings.HasPrefix(req.URL.Path, url+zboxutil.LIST_ENDPOINT)
+			})).Return(func(*http.Request) *http.Response {
+				body, err := json.Marshal(&fileref.ListResult{
+					Meta: map[string]interface{}{
+						"type": fileref.DIRECTORY,
+						"path": "/",
+					},
+					Entities: []map[string]interface{}{{
+						"type":             fileref.FILE,
+						"path":             mockPath,
+						"actual_file_hash": hash,
+					}},
+				})
+				require.NoError(t, err)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				}
+			}, nil)
+
+			mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+				return strings.HasPrefix(req.URL.Path, url+zboxutil.FILE_META_ENDPOINT)
+			})).Return(func(*http.Request) *http.Response {
+				if len(hash) == 0 {
+					return &http.Response{
+						StatusCode: http.StatusBadRequest,
+						Body:       ioutil.NopCloser(bytes.NewReader([]byte("not found"))),
+					}
+				}
+				fileRef := &fileref.FileRef{ActualFileHash: hash, ActualFileSize: 10}
+				fileRef.Type = fileref.FILE
+				body, err := json.Marshal(fileRef)
+				require.NoError(t, err)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				}
+			}, nil)
+		}
+	}
+
+	blobberID := func(testName string, i int) string {
+		return testName + mockBlobberId + strconv.Itoa(i)
+	}
+
+	tests := []struct {
+		name     string
+		hashes   []string
+		wantFile func(testName string) *FileHealth
+	}{
+		{
+			name:   "Test_Healthy_Success",
+			hashes: []string{mockActualHash, mockActualHash, mockActualHash, mockActualHash},
+			wantFile: func(testName string) *FileHealth {
+				return &FileHealth{
+					Path:           mockPath,
+					ActualFileHash: mockActualHash,
+					ActualFileSize: 10,
+					Found:          []string{blobberID(testName, 0), blobberID(testName, 1), blobberID(testName, 2), blobberID(testName, 3)},
+					Repair:         RepairNone,
+				}
+			},
+		},
+		{
+			name:   "Test_Repair_By_Upload_Success",
+			hashes: []string{mockActualHash, mockActualHash, mockStaleHash, ""},
+			wantFile: func(testName string) *FileHealth {
+				return &FileHealth{
+					Path:           mockPath,
+					ActualFileHash: mockActualHash,
+					ActualFileSize: 10,
+					Found:          []string{blobberID(testName, 0), blobberID(testName, 1)},
+					Missing:        []string{blobberID(testName, 3)},
+					Stale:          []string{blobberID(testName, 2)},
+					Repair:         RepairByUpload,
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			a := &Allocation{
+				DataShards:   2,
+				ParityShards: 2,
+			}
+			setupMockAllocation(t, a)
+			for i := 0; i < numBlobbers; i++ {
+				a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+					ID:      blobberID(tt.name, i),
+					Baseurl: "TestAllocation_HealthCheck" + tt.name + mockBlobberUrl + strconv.Itoa(i),
+				})
+			}
+			setupHttpResponses(t, tt.name, tt.hashes)
+
+			report, err := a.HealthCheck("/")
+			require.NoError(err)
+			require.Empty(report.Errors)
+			require.EqualValues([]*FileHealth{tt.wantFile(tt.name)}, report.Files)
+			require.EqualValues(1, report.TotalFiles)
+			require.EqualValues(10, report.TotalSize)
+
+			data, err := report.JSON()
+			require.NoError(err)
+			var decoded HealthReport
+			require.NoError(json.Unmarshal(data, &decoded))
+			require.EqualValues(report.Files, decoded.Files)
+		})
+	}
+}
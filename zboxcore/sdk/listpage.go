@@ -0,0 +1,319 @@
+package sdk
+
+import (
+	"encoding/base64"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// DefaultListPageLimit is the number of entries of a ListDirPaged page when
+// no limit is given.
+const DefaultListPageLimit = 1000
+
+// ListSortBy is the field the entries of a ListDirPaged page are sorted by.
+type ListSortBy int
+
+const (
+	// ListSortNone keeps the order of the blobbers.
+	ListSortNone ListSortBy = iota
+	ListSortByName
+	ListSortBySize
+	ListSortByUpdated
+)
+
+// ListSort is the order of the entries of ListDirPaged. The directory listed
+// by the blobbers which don't support pages is sorted as a whole before the
+// page is cut out of it, so the pages follow each other in the order. The
+// blobbers supporting pages return them in name order, the entries are
+// sorted within the page then.
+type ListSort struct {
+	By   ListSortBy
+	Desc bool
+}
+
+// ListFilter selects the entries of a ListDirPaged page. It's applied by the
+// client to the entries of the page, so a page can have less entries than
+// the limit and still be followed by other pages. The zero fields match all
+// the entries.
+type ListFilter struct {
+	// Type is fileref.FILE or fileref.DIRECTORY.
+	Type string
+	// MimePrefix matches the files which mime type starts with it.
+	MimePrefix string
+	// MinSize and MaxSize bound the actual size of the files, a zero MaxSize
+	// doesn't bound it.
+	MinSize int64
+	MaxSize int64
+	// UpdatedAfter matches the entries updated after it.
+	UpdatedAfter time.Time
+}
+
+func (f *ListFilter) match(lr *ListResult) bool {
+	if f == nil {
+		return true
+	}
+	if len(f.Type) > 0 && lr.Type != f.Type {
+		return false
+	}
+	if len(f.MimePrefix) > 0 && !strings.HasPrefix(lr.MimeType, f.MimePrefix) {
+		return false
+	}
+	if lr.ActualSize < f.MinSize || (f.MaxSize > 0 && lr.ActualSize > f.MaxSize) {
+		return false
+	}
+	if !f.UpdatedAfter.IsZero() {
+		updatedAt, ok := parseListTime(lr.UpdatedAt)
+		if !ok || !updatedAt.After(f.UpdatedAfter) {
+			return false
+		}
+	}
+	return true
+}
+
+// parseListTime parses the created and updated times of the list results.
+func parseListTime(value string) (time.Time, bool) {
+	t, err := time.Parse(time.RFC3339Nano, value)
+	return t, err == nil
+}
+
+// ListPage is a page of a directory listed by ListDirPaged, the Children of
+// the ListResult are the entries of the page.
+type ListPage struct {
+	*ListResult
+	// NextCursor lists the next page, it's empty for the last page.
+	NextCursor string
+}
+
+// encodeListCursor encodes the offset of the next page with the name of the
+// entry before it, which tells the blobbers listing the whole directory.
+func encodeListCursor(offset int, after string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(offset) + ":" + after))
+}
+
+func decodeListCursor(cursor string) (int, string, error) {
+	if len(cursor) == 0 {
+		return 0, "", nil
+	}
+	decoded, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", errors.New("invalid_cursor", "Invalid list cursor")
+	}
+	fields := strings.SplitN(string(decoded), ":", 2)
+	offset, err := strconv.Atoi(fields[0])
+	if err != nil || offset < 0 {
+		return 0, "", errors.New("invalid_cursor", "Invalid list cursor")
+	}
+	var after string
+	if len(fields) == 2 {
+		after = fields[1]
+	}
+	return offset, after, nil
+}
+
+// pageOfChildren returns the limit children from the offset on.
+func pageOfChildren(children []fileref.RefEntity, offset, limit int) []fileref.RefEntity {
+	if offset >= len(children) {
+		return nil
+	}
+	if offset+limit < len(children) {
+		return children[offset : offset+limit]
+	}
+	return children[offset:]
+}
+
+// listLess returns the order of the entries for the sort, nil to keep the
+// order. The entries equal for the sort are ordered by name, so every blobber
+// cuts the same page.
+func listLess(order ListSort, name func(int) string, size func(int) int64,
+	updated func(int) string) func(i, j int) bool {
+
+	var compare func(i, j int) int
+	switch order.By {
+	case ListSortByName:
+		compare = func(i, j int) int { return 0 }
+	case ListSortBySize:
+		compare = func(i, j int) int {
+			switch {
+			case size(i) < size(j):
+				return -1
+			case size(i) > size(j):
+				return 1
+			}
+			return 0
+		}
+	case ListSortByUpdated:
+		compare = func(i, j int) int { return strings.Compare(updated(i), updated(j)) }
+	default:
+		return nil
+	}
+	return func(i, j int) bool {
+		c := compare(i, j)
+		if c == 0 {
+			c = strings.Compare(name(i), name(j))
+		}
+		if order.Desc {
+			return c > 0
+		}
+		return c < 0
+	}
+}
+
+func sortListResults(entries []*ListResult, order ListSort) {
+	less := listLess(order,
+		func(i int) string { return entries[i].Name },
+		func(i int) int64 { return entries[i].ActualSize },
+		func(i int) string { return entries[i].UpdatedAt })
+	if less != nil {
+		sort.SliceStable(entries, less)
+	}
+}
+
+// sortRefs sorts the children listed by a blobber like sortListResults sorts
+// the list results.
+func sortRefs(children []fileref.RefEntity, order ListSort) {
+	less := listLess(order,
+		func(i int) string { return children[i].GetName() },
+		func(i int) int64 {
+			if file, ok := children[i].(*fileref.FileRef); ok {
+				return file.ActualFileSize
+			}
+			return 0
+		},
+		func(i int) string { return children[i].GetUpdatedAt() })
+	if less != nil {
+		sort.SliceStable(children, less)
+	}
+}
+
+// ListDirPaged lists the directory at the path a page at a time, so the huge
+// directories are listed without holding them at once. The first page is
+// listed with an empty cursor, the next ones with the NextCursor of the
+// previous page and the same sort. A limit of zero or less is the
+// DefaultListPageLimit.
+//
+// The released blobbers ignore the offset and the limit of the page: every
+// call downloads the whole directory from each blobber, the page is cut out
+// of it by the client.
+func (a *Allocation) ListDirPaged(path string, cursor string, limit int,
+	order ListSort, filter *ListFilter) (*ListPage, error) {
+
+	page, _, err := a.listDirPage(path, cursor, limit, order, false)
+	if err != nil {
+		return nil, err
+	}
+	entries := page.Children[:0]
+	for _, child := range page.Children {
+		if filter.match(child) {
+			entries = append(entries, child)
+		}
+	}
+	page.Children = entries
+	// the consensus doesn't keep the order of the blobbers
+	sortListResults(page.Children, order)
+	return page, nil
+}
+
+// listDirPage lists the page of the directory at the cursor. With keepWhole
+// the whole directory listed by the blobbers which don't support pages is
+// kept, it tells whether the page is the whole directory then.
+func (a *Allocation) listDirPage(path string, cursor string, limit int,
+	order ListSort, keepWhole bool) (*ListPage, bool, error) {
+
+	if !a.isInitialized() {
+		return nil, false, notInitialized
+	}
+	if len(path) == 0 {
+		return nil, false, errors.New("invalid_path", "Invalid path for the list")
+	}
+	path = zboxutil.RemoteClean(path)
+	if !zboxutil.IsRemoteAbs(path) {
+		return nil, false, errors.New("invalid_path", "Path should be valid and absolute")
+	}
+	offset, after, err := decodeListCursor(cursor)
+	if err != nil {
+		return nil, false, err
+	}
+	if limit <= 0 {
+		limit = DefaultListPageLimit
+	}
+
+	listReq := &ListRequest{}
+	listReq.allocationID = a.ID
+	listReq.allocationTx = a.Tx
+	listReq.blobbers = a.Blobbers
+	listReq.consensusThresh = (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards)
+	listReq.fullconsensus = float32(a.DataShards + a.ParityShards)
+	listReq.ctx = a.ctx
+	listReq.remotefilepath = path
+	listReq.pageOffset = offset
+	listReq.pageAfter = after
+	listReq.pageSort = order
+	listReq.keepWhole = keepWhole
+	// the entry after the page tells there is a next page
+	listReq.pageLimit = limit + 1
+	result := listReq.GetListFromBlobbers()
+	if result == nil {
+		return nil, false, errors.New("list_request_failed", "Failed to get list response from the blobbers")
+	}
+
+	page := &ListPage{ListResult: result}
+	if keepWhole && atomic.LoadInt32(&listReq.unpaged) > 0 &&
+		atomic.LoadInt32(&listReq.paged) == 0 {
+		return page, true, nil
+	}
+	if len(result.Children) > limit {
+		result.Children = result.Children[:limit]
+		page.NextCursor = encodeListCursor(offset+limit, result.Children[limit-1].Name)
+	}
+	return page, false, nil
+}
+
+// listDirAll lists all the entries of the directory a page at a time. The
+// blobbers which don't support pages list the whole directory for the first
+// page already, that listing is kept then. Otherwise the first page is
+// listed again, a page is cheap for the blobbers supporting them.
+func (a *Allocation) listDirAll(path string) (*ListResult, error) {
+	page, whole, err := a.listDirPage(path, "", DefaultListPageLimit, ListSort{}, true)
+	if err != nil {
+		return nil, err
+	}
+	if whole {
+		return page.ListResult, nil
+	}
+
+	var dir *ListResult
+	seen := make(map[string]bool)
+	cursor := ""
+	for {
+		page, _, err := a.listDirPage(path, cursor, DefaultListPageLimit, ListSort{}, false)
+		if err != nil {
+			return nil, err
+		}
+		entries := page.Children
+		if dir == nil {
+			dir = page.ListResult
+			dir.Children = nil
+		}
+		added := false
+		for _, entry := range entries {
+			if seen[entry.Path] {
+				continue
+			}
+			seen[entry.Path] = true
+			added = true
+			dir.Children = append(dir.Children, entry)
+		}
+		// a page without new entries would be listed again and again
+		if len(page.NextCursor) == 0 || !added {
+			return dir, nil
+		}
+		cursor = page.NextCursor
+	}
+}
@@ -0,0 +1,253 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocation_ListDirPaged(t *testing.T) {
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	var entities []map[string]interface{}
+	for i, name := range []string{"c.txt", "d1", "a.png", "b.txt", "d2"} {
+		entity := map[string]interface{}{
+			"name":        name,
+			"path":        "/" + name,
+			"lookup_hash": strconv.Itoa(i),
+			"type":        fileref.DIRECTORY,
+		}
+		if strings.Contains(name, ".") {
+			entity["type"] = fileref.FILE
+			entity["actual_file_size"] = i * 10
+			entity["actual_file_hash"] = name
+			entity["mimetype"] = "text/plain"
+			if strings.HasSuffix(name, ".png") {
+				entity["mimetype"] = "image/png"
+			}
+		}
+		entities = append(entities, entity)
+	}
+
+	tests := []struct {
+		name      string
+		paged     bool
+		limit     int
+		sort      ListSort
+		filter    *ListFilter
+		wantPages [][]string
+	}{
+		{
+			name:      "Test_Whole_Directory_Cut_In_Pages",
+			limit:     2,
+			wantPages: [][]string{{"c.txt", "d1"}, {"a.png", "b.txt"}, {"d2"}},
+		},
+		{
+			name:      "Test_Whole_Directory_One_Over_The_Page",
+			limit:     4,
+			wantPages: [][]string{{"c.txt", "d1", "a.png", "b.txt"}, {"d2"}},
+		},
+		{
+			name:      "Test_Blobber_Pages",
+			paged:     true,
+			limit:     2,
+			wantPages: [][]string{{"c.txt", "d1"}, {"a.png", "b.txt"}, {"d2"}},
+		},
+		{
+			name:      "Test_Last_Page_Full",
+			paged:     true,
+			limit:     5,
+			wantPages: [][]string{{"c.txt", "d1", "a.png", "b.txt", "d2"}},
+		},
+		{
+			name:      "Test_Sorted_Across_Pages",
+			limit:     3,
+			sort:      ListSort{By: ListSortByName, Desc: true},
+			wantPages: [][]string{{"d2", "d1", "c.txt"}, {"b.txt", "a.png"}},
+		},
+		{
+			name:      "Test_Sorted_By_Size_Then_Name",
+			limit:     2,
+			sort:      ListSort{By: ListSortBySize},
+			wantPages: [][]string{{"c.txt", "d1"}, {"d2", "a.png"}, {"b.txt"}},
+		},
+		{
+			name:      "Test_Filtered",
+			limit:     3,
+			filter:    &ListFilter{Type: fileref.FILE, MimePrefix: "text/", MinSize: 5},
+			wantPages: [][]string{{}, {"b.txt"}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+				return strings.HasPrefix(req.URL.Path, tt.name) &&
+					strings.Contains(req.URL.Path, zboxutil.LIST_ENDPOINT)
+			})).Return(func(req *http.Request) *http.Response {
+				list := entities
+				if tt.paged {
+					offset, err := strconv.Atoi(req.URL.Query().Get("offset"))
+					require.NoError(err)
+					limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+					require.NoError(err)
+					list = list[offset:]
+					if limit < len(list) {
+						list = list[:limit]
+					}
+				}
+				body, err := json.Marshal(&fileref.ListResult{
+					Meta:     map[string]interface{}{"type": fileref.DIRECTORY, "path": "/"},
+					Entities: list,
+				})
+				require.NoError(err)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				}
+			}, nil)
+
+			a := &Allocation{DataShards: 2, ParityShards: 2}
+			setupMockAllocation(t, a)
+			for i := 0; i < numBlobbers; i++ {
+				a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+					ID:      mockBlobberId + strconv.Itoa(i),
+					Baseurl: tt.name + mockBlobberUrl + strconv.Itoa(i),
+				})
+			}
+
+			var pages [][]string
+			cursor := ""
+			for {
+				page, err := a.ListDirPaged("/", cursor, tt.limit, tt.sort, tt.filter)
+				require.NoError(err)
+				names := []string{}
+				for _, child := range page.Children {
+					names = append(names, child.Name)
+				}
+				pages = append(pages, names)
+				if page.NextCursor == "" {
+					break
+				}
+				cursor = page.NextCursor
+			}
+			require.EqualValues(tt.wantPages, pages)
+		})
+	}
+
+	a := &Allocation{DataShards: 2, ParityShards: 2}
+	setupMockAllocation(t, a)
+	_, err := a.ListDirPaged("/", "not a cursor", 0, ListSort{}, nil)
+	require.Error(t, err)
+}
+
+func TestAllocation_listDirAll(t *testing.T) {
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	var entities []map[string]interface{}
+	for i := 0; i < DefaultListPageLimit+10; i++ {
+		name := fmt.Sprintf("%05d.txt", i)
+		entities = append(entities, map[string]interface{}{
+			"name":        name,
+			"path":        "/" + name,
+			"lookup_hash": strconv.Itoa(i),
+			"type":        fileref.FILE,
+		})
+	}
+
+	tests := []struct {
+		name  string
+		paged bool
+		// the list requests by blobber
+		wantCalls int64
+	}{
+		{
+			// the whole directory listed for the first page is kept
+			name:      "Test_Whole_Directory_Kept",
+			wantCalls: 1,
+		},
+		{
+			// the first page is listed again, then the second one
+			name:      "Test_Blobber_Pages",
+			paged:     true,
+			wantCalls: 3,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			var calls int64
+			mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+				return strings.HasPrefix(req.URL.Path, tt.name) &&
+					strings.Contains(req.URL.Path, zboxutil.LIST_ENDPOINT)
+			})).Return(func(req *http.Request) *http.Response {
+				atomic.AddInt64(&calls, 1)
+				list := entities
+				if tt.paged {
+					offset, err := strconv.Atoi(req.URL.Query().Get("offset"))
+					require.NoError(err)
+					limit, err := strconv.Atoi(req.URL.Query().Get("limit"))
+					require.NoError(err)
+					list = list[offset:]
+					if limit < len(list) {
+						list = list[:limit]
+					}
+				}
+				body, err := json.Marshal(&fileref.ListResult{
+					Meta:     map[string]interface{}{"type": fileref.DIRECTORY, "path": "/"},
+					Entities: list,
+				})
+				require.NoError(err)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				}
+			}, nil)
+
+			a := &Allocation{DataShards: 2, ParityShards: 2}
+			setupMockAllocation(t, a)
+			for i := 0; i < numBlobbers; i++ {
+				a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+					ID:      mockBlobberId + strconv.Itoa(i),
+					Baseurl: tt.name + mockBlobberUrl + strconv.Itoa(i),
+				})
+			}
+
+			dir, err := a.listDirAll("/")
+			require.NoError(err)
+			require.Len(dir.Children, len(entities))
+			require.EqualValues(tt.wantCalls*numBlobbers, atomic.LoadInt64(&calls))
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"net/http"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/0chain/errors"
@@ -30,6 +31,21 @@ type ListRequest struct {
 	authToken          *marker.AuthTicket
 	ctx                context.Context
 	wg                 *sync.WaitGroup
+	// pageOffset and pageLimit select a page of the directory, the whole
+	// directory is listed for a zero pageLimit
+	pageOffset int
+	pageLimit  int
+	// pageAfter is the name of the entry before the page
+	pageAfter string
+	// pageSort is the order of the whole directory the page is cut out of
+	pageSort ListSort
+	// keepWhole keeps the whole directory listed for a page instead of
+	// cutting the page out of it
+	keepWhole bool
+	// unpaged and paged count the blobbers which listed the whole directory
+	// for a page and the ones which listed the page only
+	unpaged int32
+	paged   int32
 	Consensus
 }
 
@@ -51,6 +67,7 @@ type ListResult struct {
 	LookupHash      string             `json:"lookup_hash"`
 	EncryptionKey   string             `json:"encryption_key"`
 	Attributes      fileref.Attributes `json:"attributes"`
+	CustomMeta      string             `json:"custom_meta,omitempty"`
 	ActualSize      int64              `json:"actual_size"`
 	ActualNumBlocks int64              `json:"actual_num_blocks"`
 	CreatedAt       string             `json:"created_at"`
@@ -59,6 +76,11 @@ type ListResult struct {
 	Consensus       `json:"-"`
 }
 
+// GetCustomMeta returns the key/value pairs attached to the file.
+func (lr *ListResult) GetCustomMeta() (map[string]string, error) {
+	return parseCustomMeta(lr.CustomMeta)
+}
+
 func (req *ListRequest) getListInfoFromBlobber(blobber *blockchain.StorageNode, blobberIdx int, rspCh chan<- *listResponse) {
 	defer req.wg.Done()
 	//body := new(bytes.Buffer)
@@ -89,7 +111,12 @@ func (req *ListRequest) getListInfoFromBlobber(blobber *blockchain.StorageNode,
 	}
 
 	//formWriter.Close()
-	httpreq, err := zboxutil.NewListRequest(blobber.Baseurl, req.allocationTx, req.remotefilepathhash, string(authTokenBytes))
+	var httpreq *http.Request
+	if req.pageLimit > 0 {
+		httpreq, err = zboxutil.NewListPageRequest(blobber.Baseurl, req.allocationTx, req.remotefilepathhash, string(authTokenBytes), req.pageOffset, req.pageLimit)
+	} else {
+		httpreq, err = zboxutil.NewListRequest(blobber.Baseurl, req.allocationTx, req.remotefilepathhash, string(authTokenBytes))
+	}
 	if err != nil {
 		Logger.Error("List info request error: ", err.Error())
 		return
@@ -119,6 +146,9 @@ func (req *ListRequest) getListInfoFromBlobber(blobber *blockchain.StorageNode,
 			if err != nil {
 				return errors.Wrap(err, "error getting the dir tree from list response:")
 			}
+			if req.pageLimit > 0 {
+				ref.Children = req.pageOf(ref.Children)
+			}
 			return nil
 		}
 
@@ -127,6 +157,32 @@ func (req *ListRequest) getListInfoFromBlobber(blobber *blockchain.StorageNode,
 	})
 }
 
+// pageOf returns the page of the children listed by a blobber. A blobber
+// which doesn't support pages lists the whole directory, it's sorted and the
+// page is cut out of it then. Such a listing has more children than the page,
+// or has the entry before the page.
+func (req *ListRequest) pageOf(children []fileref.RefEntity) []fileref.RefEntity {
+	unpaged := len(children) > req.pageLimit
+	if !unpaged && req.pageOffset > 0 && len(req.pageAfter) > 0 {
+		for _, child := range children {
+			if child.GetName() == req.pageAfter {
+				unpaged = true
+				break
+			}
+		}
+	}
+	if !unpaged {
+		atomic.AddInt32(&req.paged, 1)
+		return children
+	}
+	atomic.AddInt32(&req.unpaged, 1)
+	sortRefs(children, req.pageSort)
+	if req.keepWhole {
+		return children
+	}
+	return pageOfChildren(children, req.pageOffset, req.pageLimit)
+}
+
 func (req *ListRequest) getlistFromBlobbers() []*listResponse {
 	numList := len(req.blobbers)
 	req.wg = &sync.WaitGroup{}
@@ -199,6 +255,7 @@ func (req *ListRequest) GetListFromBlobbers() *ListResult {
 				childResult.Hash = (child.(*fileref.FileRef)).ActualFileHash
 				childResult.MimeType = (child.(*fileref.FileRef)).MimeType
 				childResult.EncryptionKey = (child.(*fileref.FileRef)).EncryptedKey
+				childResult.CustomMeta = (child.(*fileref.FileRef)).CustomMeta
 				childResult.ActualSize = (child.(*fileref.FileRef)).ActualFileSize
 				if childResult.ActualSize > 0 {
 					childResult.ActualNumBlocks = childResult.ActualSize / CHUNK_SIZE
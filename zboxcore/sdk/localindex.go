@@ -0,0 +1,117 @@
+package sdk
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/0chain/errors"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// localIndexEntry is the hash of a local file with the stat it was computed
+// for, the hash is reused while the stat is the same.
+type localIndexEntry struct {
+	Size    int64  `json:"size"`
+	ModTime int64  `json:"mod_time"`
+	Inode   uint64 `json:"inode,omitempty"`
+	Hash    string `json:"hash"`
+}
+
+// localIndex is the persistent index of the hashes of the local files, it
+// spares the sync diff from reading the files which didn't change since the
+// last one. A nil index hashes every file.
+type localIndex struct {
+	path    string
+	entries map[string]localIndexEntry
+	// seen are the entries of the files which still exist, the others are
+	// dropped by save
+	seen map[string]localIndexEntry
+}
+
+// localIndexPath is the path of the local index kept next to the snapshot of
+// a sync.
+func localIndexPath(lastSyncCachePath string) string {
+	return lastSyncCachePath + ".local"
+}
+
+// loadLocalIndex reads the index, a missing or broken one starts empty.
+func loadLocalIndex(path string) *localIndex {
+	idx := &localIndex{
+		path:    path,
+		entries: make(map[string]localIndexEntry),
+		seen:    make(map[string]localIndexEntry),
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return idx
+	}
+	if err := json.Unmarshal(content, &idx.entries); err != nil {
+		Logger.Error("Invalid local index ", path, ": ", err)
+		idx.entries = make(map[string]localIndexEntry)
+	}
+	return idx
+}
+
+// hash returns the hash of the local file at filePath, listed as lPath in the
+// index.
+func (idx *localIndex) hash(lPath, filePath string, info os.FileInfo) (string, error) {
+	if idx == nil {
+		return calcFileHash(filePath)
+	}
+	entry := localIndexEntry{
+		Size:    info.Size(),
+		ModTime: info.ModTime().UnixNano(),
+		Inode:   fileInode(info),
+	}
+	if prev, ok := idx.entries[lPath]; ok && prev.Size == entry.Size &&
+		prev.ModTime == entry.ModTime && prev.Inode == entry.Inode {
+
+		idx.seen[lPath] = prev
+		return prev.Hash, nil
+	}
+	hash, err := calcFileHash(filePath)
+	if err != nil {
+		return "", err
+	}
+	entry.Hash = hash
+	idx.seen[lPath] = entry
+	return hash, nil
+}
+
+// save replaces the index with the entries of the files seen since the load.
+func (idx *localIndex) save() error {
+	if idx == nil {
+		return nil
+	}
+	content, err := json.Marshal(idx.seen)
+	if err != nil {
+		return errors.Wrap(err, "failed to convert JSON.")
+	}
+	tmpPath := idx.path + ".tmp"
+	if err := ioutil.WriteFile(tmpPath, content, 0644); err != nil {
+		return errors.Wrap(err, "error saving local index.")
+	}
+	if err := os.Rename(tmpPath, idx.path); err != nil {
+		os.Remove(tmpPath)
+		return errors.Wrap(err, "error saving local index.")
+	}
+	return nil
+}
+
+func calcFileHash(filePath string) (string, error) {
+	fp, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer fp.Close()
+
+	h := sha1.New()
+	if _, err := io.Copy(h, fp); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
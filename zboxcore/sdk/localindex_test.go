@@ -0,0 +1,62 @@
+package sdk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalIndex(t *testing.T) {
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "localindex")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	indexPath := filepath.Join(dir, "index")
+	filePath := filepath.Join(dir, "1.txt")
+	require.NoError(ioutil.WriteFile(filePath, []byte("content"), 0644))
+	wantHash, err := calcFileHash(filePath)
+	require.NoError(err)
+
+	idx := loadLocalIndex(indexPath)
+	info, err := os.Stat(filePath)
+	require.NoError(err)
+	hash, err := idx.hash("/1.txt", filePath, info)
+	require.NoError(err)
+	require.EqualValues(wantHash, hash)
+	require.NoError(idx.save())
+
+	// the hash of an unchanged file is taken from the index
+	idx = loadLocalIndex(indexPath)
+	entry := idx.entries["/1.txt"]
+	entry.Hash = "indexed"
+	idx.entries["/1.txt"] = entry
+	hash, err = idx.hash("/1.txt", filePath, info)
+	require.NoError(err)
+	require.EqualValues("indexed", hash)
+
+	// a changed file is hashed again
+	require.NoError(ioutil.WriteFile(filePath, []byte("changed"), 0644))
+	modTime := info.ModTime().Add(time.Second)
+	require.NoError(os.Chtimes(filePath, modTime, modTime))
+	info, err = os.Stat(filePath)
+	require.NoError(err)
+	hash, err = idx.hash("/1.txt", filePath, info)
+	require.NoError(err)
+	wantHash, err = calcFileHash(filePath)
+	require.NoError(err)
+	require.EqualValues(wantHash, hash)
+
+	// the files which weren't seen are dropped
+	require.NoError(idx.save())
+	idx = loadLocalIndex(indexPath)
+	require.Len(idx.entries, 1)
+	require.NoError(idx.save())
+	require.Empty(loadLocalIndex(indexPath).entries)
+
+	_, err = calcFileHash(filepath.Join(dir, "missing"))
+	require.True(os.IsNotExist(err))
+}
@@ -0,0 +1,8 @@
+package sdk
+
+import "os"
+
+// fileInode is 0 on windows, the index relies on the size and mtime there.
+func fileInode(info os.FileInfo) uint64 {
+	return 0
+}
@@ -0,0 +1,396 @@
+package sdk
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/allocationchange"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/marker"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// MetaCacheCheckInterval is how often the metadata cache checks the
+// allocation roots of the blobbers, it's served unchecked in between.
+var MetaCacheCheckInterval = 10 * time.Second
+
+// metaCacheSaveDelay batches the saves of the entries put in the cache, the
+// file is written once for all the entries put in the delay.
+const metaCacheSaveDelay = 2 * time.Second
+
+// metaCacheData is the persisted metadata cache, the listings and the file
+// metas by path as of the allocation roots of the blobbers.
+type metaCacheData struct {
+	// Roots is the allocation root by blobber url.
+	Roots map[string]string          `json:"roots"`
+	Lists map[string]json.RawMessage `json:"lists"`
+	Files map[string]json.RawMessage `json:"files"`
+}
+
+// repairState is a cached result of RepairRequired. It's not persisted, it
+// changes with the blobbers being up as much as with their roots.
+type repairState struct {
+	found    zboxutil.Uint128
+	required bool
+	ref      fileref.FileRef
+}
+
+// metaCache caches the metadata of an allocation. The entries are kept as
+// JSON, every read returns its own copy.
+type metaCache struct {
+	mu        sync.Mutex
+	file      string
+	checkedAt time.Time
+	gen       uint64
+	data      metaCacheData
+	repairs   map[string]*repairState
+	// saveTimer is the pending save of the entries put, nil if none
+	saveTimer *time.Timer
+}
+
+// metaCaches is the metadata caches by allocation id, for the commits to
+// update them.
+var metaCaches = make(map[string]*metaCache)
+var metaCachesMutex sync.Mutex
+
+func newMetaCache(file string) *metaCache {
+	c := &metaCache{file: file}
+	c.reset(nil)
+	if len(file) == 0 {
+		return c
+	}
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return c
+	}
+	var data metaCacheData
+	if err := json.Unmarshal(b, &data); err != nil {
+		Logger.Error("Metadata cache decode error: ", err)
+		return c
+	}
+	c.reset(data.Roots)
+	for k, v := range data.Lists {
+		c.data.Lists[k] = v
+	}
+	for k, v := range data.Files {
+		c.data.Files[k] = v
+	}
+	return c
+}
+
+// reset empties the cache, which is then as of the roots.
+func (c *metaCache) reset(roots map[string]string) {
+	if roots == nil {
+		roots = make(map[string]string)
+	}
+	c.data = metaCacheData{
+		Roots: roots,
+		Lists: make(map[string]json.RawMessage),
+		Files: make(map[string]json.RawMessage),
+	}
+	c.repairs = make(map[string]*repairState)
+	c.gen++
+}
+
+// save writes the cache to its file, the mutex is held by the caller.
+func (c *metaCache) save() {
+	if c.saveTimer != nil {
+		c.saveTimer.Stop()
+		c.saveTimer = nil
+	}
+	if len(c.file) == 0 {
+		return
+	}
+	b, err := json.Marshal(&c.data)
+	if err != nil {
+		Logger.Error("Metadata cache encode error: ", err)
+		return
+	}
+	// the file is replaced at once, never left half written
+	tmp := c.file + ".tmp"
+	if err = ioutil.WriteFile(tmp, b, 0644); err == nil {
+		err = os.Rename(tmp, c.file)
+	}
+	if err != nil {
+		Logger.Error("Metadata cache save error: ", err)
+	}
+}
+
+// saveLater saves the cache after the save delay, along with the entries put
+// in between. The mutex is held by the caller.
+func (c *metaCache) saveLater() {
+	if len(c.file) == 0 || c.saveTimer != nil {
+		return
+	}
+	c.saveTimer = time.AfterFunc(metaCacheSaveDelay, c.flush)
+}
+
+// flush saves the entries put since the last save.
+func (c *metaCache) flush() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.saveTimer != nil {
+		c.save()
+	}
+}
+
+// check empties the cache when the allocation roots of the blobbers aren't
+// the ones it's as of. The roots are checked once in the check interval, only
+// for the blobbers which respond.
+func (c *metaCache) check(a *Allocation) {
+	c.mu.Lock()
+	checked := time.Since(c.checkedAt) < MetaCacheCheckInterval
+	c.mu.Unlock()
+	if checked {
+		return
+	}
+
+	roots := make(map[string]string)
+	for url, stats := range a.GetBlobberStats() {
+		roots[url] = stats.AllocationRoot
+	}
+	if len(roots) == 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checkedAt = time.Now()
+	if sameRoots(roots, c.data.Roots) {
+		return
+	}
+	c.reset(roots)
+	c.save()
+}
+
+// sameRoots tells whether the roots of the blobbers which responded are the
+// cached ones. A blobber missing from the cached roots isn't known to be the
+// same.
+func sameRoots(roots, cached map[string]string) bool {
+	for url, root := range roots {
+		if r, ok := cached[url]; !ok || r != root {
+			return false
+		}
+	}
+	return true
+}
+
+// generation returns the generation of the cache, which changes with every
+// entry dropped. The results fetched from the blobbers are only put in the
+// cache of the generation they were fetched in, not to bring back the
+// entries dropped in between.
+func (c *metaCache) generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.gen
+}
+
+func (c *metaCache) get(kind func(*metaCacheData) map[string]json.RawMessage, path string, v interface{}) bool {
+	c.mu.Lock()
+	b, ok := kind(&c.data)[path]
+	c.mu.Unlock()
+	return ok && json.Unmarshal(b, v) == nil
+}
+
+func (c *metaCache) put(kind func(*metaCacheData) map[string]json.RawMessage, path string, gen uint64, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen != c.gen {
+		return
+	}
+	kind(&c.data)[path] = b
+	c.saveLater()
+}
+
+func cachedLists(data *metaCacheData) map[string]json.RawMessage { return data.Lists }
+func cachedFiles(data *metaCacheData) map[string]json.RawMessage { return data.Files }
+
+func (c *metaCache) getList(path string) (*ListResult, bool) {
+	lr := &ListResult{}
+	if !c.get(cachedLists, path, lr) {
+		return nil, false
+	}
+	return lr, true
+}
+
+func (c *metaCache) putList(path string, gen uint64, lr *ListResult) {
+	c.put(cachedLists, path, gen, lr)
+}
+
+func (c *metaCache) getFile(path string) (*ConsolidatedFileMeta, bool) {
+	meta := &ConsolidatedFileMeta{}
+	if !c.get(cachedFiles, path, meta) {
+		return nil, false
+	}
+	return meta, true
+}
+
+func (c *metaCache) putFile(path string, gen uint64, meta *ConsolidatedFileMeta) {
+	c.put(cachedFiles, path, gen, meta)
+}
+
+func (c *metaCache) getRepair(path string) (*repairState, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	state, ok := c.repairs[path]
+	if !ok {
+		return nil, false
+	}
+	copied := *state
+	return &copied, true
+}
+
+func (c *metaCache) putRepair(path string, gen uint64, state *repairState) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if gen == c.gen {
+		c.repairs[path] = state
+	}
+}
+
+// committed updates the cache after a commit of the SDK to the blobber. A
+// cache as of another root than the one the commit followed is emptied,
+// otherwise only the paths of the changes are dropped and the cache moves
+// on to the new root.
+func (c *metaCache) committed(blobberURL string, latestWM *marker.WriteMarker, root string,
+	changes []allocationchange.AllocationChange) {
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	prevRoot := ""
+	if latestWM != nil {
+		prevRoot = latestWM.AllocationRoot
+	}
+	if r, ok := c.data.Roots[blobberURL]; ok && r != prevRoot {
+		c.reset(nil)
+	}
+	for _, change := range changes {
+		c.drop(change.GetAffectedPath())
+	}
+	c.data.Roots[blobberURL] = root
+	c.save()
+}
+
+// drop drops the remote path, the paths under it and the listings of the
+// directories above it.
+func (c *metaCache) drop(remotePath string) {
+	if len(remotePath) == 0 {
+		c.reset(c.data.Roots)
+		return
+	}
+	c.gen++
+	remotePath = zboxutil.RemoteClean(remotePath)
+	prefix := strings.TrimSuffix(remotePath, "/") + "/"
+	under := func(p string) bool {
+		return p == remotePath || strings.HasPrefix(p, prefix)
+	}
+	for p := range c.data.Lists {
+		if under(p) {
+			delete(c.data.Lists, p)
+		}
+	}
+	for p := range c.data.Files {
+		if under(p) {
+			delete(c.data.Files, p)
+		}
+	}
+	for p := range c.repairs {
+		if under(p) {
+			delete(c.repairs, p)
+		}
+	}
+	for dir := remotePath; dir != "/"; {
+		dir = path.Dir(dir)
+		delete(c.data.Lists, dir)
+	}
+}
+
+// updateMetaCache updates the metadata cache of the allocation, if it has
+// one, after a commit of the changes to the blobber.
+func updateMetaCache(req *CommitRequest, latestWM *marker.WriteMarker, root string) {
+	metaCachesMutex.Lock()
+	c := metaCaches[req.allocationID]
+	metaCachesMutex.Unlock()
+	if c != nil {
+		c.committed(req.blobber.Baseurl, latestWM, root, req.changes)
+	}
+}
+
+// dropMetaCache drops the remote path from the metadata cache of the
+// allocation, if it has one, after a change made without a commit.
+func dropMetaCache(allocationID string, remotePath string) {
+	metaCachesMutex.Lock()
+	c := metaCaches[allocationID]
+	metaCachesMutex.Unlock()
+	if c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.drop(remotePath)
+		c.save()
+	}
+}
+
+// EnableMetaCache caches the listings, the file metas and the repair states
+// of the allocation, so ListDir, GetFileMeta and RepairRequired don't ask the
+// blobbers again and again for the same paths. The cache is emptied when the
+// allocation roots of the blobbers change, and updated by the commits of the
+// SDK itself. The listings and the file metas are persisted in the dir, an
+// empty dir keeps them in memory only.
+//
+// The caches of the allocations enabled with the same id are shared.
+func (a *Allocation) EnableMetaCache(dir string) error {
+	if !a.isInitialized() {
+		return notInitialized
+	}
+	var file string
+	if len(dir) > 0 {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return errors.Wrap(err, "metadata cache dir")
+		}
+		file = filepath.Join(dir, a.ID+".metacache.json")
+	}
+	metaCachesMutex.Lock()
+	defer metaCachesMutex.Unlock()
+	c, ok := metaCaches[a.ID]
+	if !ok || c.file != file {
+		c = newMetaCache(file)
+		metaCaches[a.ID] = c
+	}
+	a.metaCache = c
+	return nil
+}
+
+// DisableMetaCache stops caching the metadata of the allocation. The
+// persisted cache is kept for the next EnableMetaCache.
+func (a *Allocation) DisableMetaCache() {
+	metaCachesMutex.Lock()
+	defer metaCachesMutex.Unlock()
+	if c, ok := metaCaches[a.ID]; ok && c == a.metaCache {
+		delete(metaCaches, a.ID)
+		c.flush()
+	}
+	a.metaCache = nil
+}
+
+// ClearMetaCache empties the metadata cache of the allocation.
+func (a *Allocation) ClearMetaCache() {
+	if c := a.metaCache; c != nil {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.reset(nil)
+		c.checkedAt = time.Time{}
+		c.save()
+	}
+}
@@ -0,0 +1,166 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/allocationchange"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/marker"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocation_MetaCache(t *testing.T) {
+	require := require.New(t)
+
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	defer func(interval time.Duration) { MetaCacheCheckInterval = interval }(MetaCacheCheckInterval)
+	MetaCacheCheckInterval = 0
+
+	var listCalls, remoteVersion, committed, down int64
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.Contains(req.URL.Path, zboxutil.LIST_ENDPOINT)
+	})).Return(func(*http.Request) *http.Response {
+		atomic.AddInt64(&listCalls, 1)
+		body, err := json.Marshal(&fileref.ListResult{
+			Meta: map[string]interface{}{"type": fileref.DIRECTORY, "path": "/", "name": "/"},
+			Entities: []map[string]interface{}{{
+				"type": fileref.FILE,
+				"path": "/1.txt",
+				"name": "1.txt",
+			}},
+		})
+		require.NoError(err)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.HasSuffix(req.URL.Path, zboxutil.ALLOCATION_ENDPOINT)
+	})).Return(func(req *http.Request) *http.Response {
+		if strings.HasSuffix(req.URL.Path, "3"+zboxutil.ALLOCATION_ENDPOINT) && atomic.LoadInt64(&down) == 1 {
+			return &http.Response{
+				StatusCode: http.StatusInternalServerError,
+				Body:       ioutil.NopCloser(strings.NewReader("down")),
+			}
+		}
+		// the first blobber moves on with the commits of the SDK
+		root := strconv.FormatInt(atomic.LoadInt64(&remoteVersion), 10)
+		if strings.HasSuffix(req.URL.Path, "0"+zboxutil.ALLOCATION_ENDPOINT) &&
+			atomic.LoadInt64(&committed) == 1 && root == "0" {
+			root = "committed"
+		}
+		body, err := json.Marshal(&BlobberAllocationStats{AllocationRoot: root})
+		require.NoError(err)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.Contains(req.URL.Path, zboxutil.DIR_ENDPOINT)
+	})).Return(func(*http.Request) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader("{}")),
+		}
+	}, nil)
+
+	a := &Allocation{ID: "metacache", DataShards: 2, ParityShards: 2}
+	setupMockAllocation(t, a)
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      mockBlobberId + strconv.Itoa(i),
+			Baseurl: t.Name() + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+	dir, err := ioutil.TempDir("", "metacache")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	require.NoError(a.EnableMetaCache(dir))
+	defer a.DisableMetaCache()
+
+	listDir := func(wantCalls int64) {
+		atomic.StoreInt64(&listCalls, 0)
+		lr, err := a.ListDir("/")
+		require.NoError(err)
+		require.Len(lr.Children, 1)
+		require.EqualValues("/1.txt", lr.Children[0].Path)
+		require.EqualValues(wantCalls, atomic.LoadInt64(&listCalls))
+	}
+	listDir(numBlobbers)
+	listDir(0)
+
+	// a blobber not responding doesn't empty the cache
+	atomic.StoreInt64(&down, 1)
+	listDir(0)
+	atomic.StoreInt64(&down, 0)
+
+	// the dirs created drop the listings above them
+	require.NoError(a.CreateDir("/d"))
+	listDir(numBlobbers)
+	listDir(0)
+
+	// the own commits drop the paths they change and keep the roots
+	a.metaCache.mu.Lock()
+	prevRoot := a.metaCache.data.Roots[a.Blobbers[0].Baseurl]
+	a.metaCache.mu.Unlock()
+	require.EqualValues("0", prevRoot)
+	atomic.StoreInt64(&committed, 1)
+	updateMetaCache(&CommitRequest{
+		allocationID: a.ID,
+		blobber:      a.Blobbers[0],
+		changes: []allocationchange.AllocationChange{&allocationchange.NewFileChange{
+			File: &fileref.FileRef{Ref: fileref.Ref{Path: "/2.txt"}},
+		}},
+	}, &marker.WriteMarker{AllocationRoot: prevRoot}, "committed")
+	listDir(numBlobbers)
+	listDir(0)
+
+	// the cache is persisted, the entries put with a delay
+	a.metaCache.mu.Lock()
+	require.NotNil(a.metaCache.saveTimer)
+	a.metaCache.mu.Unlock()
+	a.metaCache.flush()
+	data, err := ioutil.ReadFile(filepath.Join(dir, a.ID+".metacache.json"))
+	require.NoError(err)
+	require.Contains(string(data), "/1.txt")
+	c := newMetaCache(filepath.Join(dir, a.ID+".metacache.json"))
+	_, ok := c.getList("/")
+	require.True(ok)
+
+	// the commits of others empty the cache
+	atomic.StoreInt64(&remoteVersion, 1)
+	listDir(numBlobbers)
+	listDir(0)
+
+	a.ClearMetaCache()
+	listDir(numBlobbers)
+}
@@ -42,6 +42,9 @@ func (req *RenameRequest) renameBlobberObject(blobber *blockchain.StorageNode, b
 	if err != nil {
 		return nil, err
 	}
+	if err := checkUnlocked(refEntity); err != nil {
+		return nil, err
+	}
 
 	body := new(bytes.Buffer)
 	formWriter := multipart.NewWriter(body)
@@ -82,9 +85,14 @@ func (req *RenameRequest) renameBlobberObject(blobber *blockchain.StorageNode, b
 	return refEntity, nil
 }
 
-func (req *RenameRequest) ProcessRename() error {
+// renameObject renames the object on the blobbers in the request connection
+// without committing it. The returned changes are indexed by the blobber
+// position, nil for the blobbers which haven't renamed the object; they're
+// returned on a consensus failure too.
+func (req *RenameRequest) renameObject() ([]allocationchange.AllocationChange, error) {
 	numList := len(req.blobbers)
 	objectTreeRefs := make([]fileref.RefEntity, numList)
+	errs := make([]error, numList)
 	req.wg = &sync.WaitGroup{}
 	req.wg.Add(numList)
 	for i := 0; i < numList; i++ {
@@ -93,6 +101,7 @@ func (req *RenameRequest) ProcessRename() error {
 			refEntity, err := req.renameBlobberObject(req.blobbers[blobberIdx], blobberIdx)
 			if err != nil {
 				Logger.Error(err.Error())
+				errs[blobberIdx] = err
 				return
 			}
 			objectTreeRefs[blobberIdx] = refEntity
@@ -100,8 +109,32 @@ func (req *RenameRequest) ProcessRename() error {
 	}
 	req.wg.Wait()
 
+	changes := make([]allocationchange.AllocationChange, numList)
+	pos := 0
+	for i := req.renameMask; i != 0; i &= ^(1 << uint32(pos)) {
+		pos = bits.TrailingZeros32(i)
+		newChange := &allocationchange.RenameFileChange{}
+		newChange.NewName = req.newName
+		newChange.ObjectTree = objectTreeRefs[pos]
+		newChange.NumBlocks = 0
+		newChange.Operation = allocationchange.RENAME_OPERATION
+		newChange.Size = 0
+		changes[pos] = newChange
+	}
+
 	if !req.isConsensusOk() {
-		return errors.New("Rename failed: Rename request failed. Operation failed.")
+		if err := lockedError(errs); err != nil {
+			return changes, err
+		}
+		return changes, errors.New("Rename failed: Rename request failed. Operation failed.")
+	}
+	return changes, nil
+}
+
+func (req *RenameRequest) ProcessRename() error {
+	changes, err := req.renameObject()
+	if err != nil {
+		return err
 	}
 
 	req.consensus = 0
@@ -116,13 +149,7 @@ func (req *RenameRequest) ProcessRename() error {
 		commitReq.allocationID = req.allocationID
 		commitReq.allocationTx = req.allocationTx
 		commitReq.blobber = req.blobbers[pos]
-		newChange := &allocationchange.RenameFileChange{}
-		newChange.NewName = req.newName
-		newChange.ObjectTree = objectTreeRefs[pos]
-		newChange.NumBlocks = 0
-		newChange.Operation = allocationchange.RENAME_OPERATION
-		newChange.Size = 0
-		commitReq.changes = append(commitReq.changes, newChange)
+		commitReq.changes = append(commitReq.changes, changes[pos])
 		commitReq.connectionID = req.connectionID
 		commitReq.wg = wg
 		commitReqs[c] = commitReq
@@ -0,0 +1,92 @@
+package sdk
+
+import (
+	"bufio"
+	"os"
+	"sync"
+
+	"github.com/0chain/errors"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// repairCheckpoint keeps the paths done by a repair in a local file, one path
+// by line. A nil checkpoint keeps nothing.
+type repairCheckpoint struct {
+	path  string
+	done  map[string]bool
+	file  *os.File
+	mutex sync.Mutex
+}
+
+// openRepairCheckpoint loads the paths done before from the checkpoint file,
+// the file is created if it doesn't exist.
+func openRepairCheckpoint(path string) (*repairCheckpoint, error) {
+	c := &repairCheckpoint{
+		path: path,
+		done: make(map[string]bool),
+	}
+	if file, err := os.Open(path); err == nil {
+		scanner := bufio.NewScanner(file)
+		for scanner.Scan() {
+			if line := scanner.Text(); len(line) > 0 {
+				c.done[line] = true
+			}
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return nil, errors.Wrap(err, "Can't read the repair checkpoint")
+		}
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+	if err != nil {
+		return nil, errors.Wrap(err, "Can't open the repair checkpoint")
+	}
+	c.file = file
+	return c, nil
+}
+
+func (c *repairCheckpoint) isDone(path string) bool {
+	if c == nil {
+		return false
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.done[path]
+}
+
+func (c *repairCheckpoint) add(path string) {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.done[path] = true
+	if c.file == nil {
+		return
+	}
+	if _, err := c.file.WriteString(path + "\n"); err != nil {
+		Logger.Error("Repair checkpoint write error: ", err)
+	}
+}
+
+func (c *repairCheckpoint) close() {
+	if c == nil {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+}
+
+// remove drops the checkpoint once the repair is complete.
+func (c *repairCheckpoint) remove() {
+	if c == nil {
+		return
+	}
+	c.close()
+	os.Remove(c.path)
+}
@@ -4,19 +4,59 @@ import (
 	"context"
 	"os"
 	"sync"
+	"sync/atomic"
 
+	"github.com/0chain/errors"
 	"github.com/0chain/gosdk/zboxcore/fileref"
 	. "github.com/0chain/gosdk/zboxcore/logger"
 	"go.uber.org/zap"
 )
 
+// RepairOptions configures the repair of the allocation.
+type RepairOptions struct {
+	// Workers is the number of files repaired at the same time, one by
+	// default
+	Workers int
+	// CheckpointPath is the local file keeping the paths done by the repair.
+	// A repair started with the same checkpoint skips them, the checkpoint is
+	// removed once the repair completes without failures.
+	CheckpointPath string
+	// FromBlobbers repairs the files without local copies, see
+	// RepairFileFromBlobbers
+	FromBlobbers bool
+}
+
+// RepairProgress counts the files done by the repair.
+type RepairProgress struct {
+	FilesChecked  int64 `json:"files_checked"`
+	FilesRepaired int64 `json:"files_repaired"`
+	FilesFailed   int64 `json:"files_failed"`
+	// FilesSkipped are the files done before, as the checkpoint has them
+	FilesSkipped int64 `json:"files_skipped"`
+	// BytesMoved are the bytes downloaded and uploaded for the repair
+	BytesMoved int64 `json:"bytes_moved"`
+}
+
+// RepairProgressCallback is implemented by the status callbacks which want
+// the progress of the repair after every file.
+type RepairProgressCallback interface {
+	RepairProgress(progress RepairProgress)
+}
+
+var errRepairCanceled = errors.New("user_aborted", "Repair aborted by user")
+
 type RepairRequest struct {
-	listDir           *ListResult
-	isRepairCanceled  bool
-	localRootPath     string
+	// progress is first to be 64 bit aligned for the atomic operations
+	progress         RepairProgress
+	listDir          *ListResult
+	isRepairCanceled int32
+	localRootPath    string
+	// fromBlobbers repairs the files without local copies
+	fromBlobbers      bool
+	workers           int
+	checkpoint        *repairCheckpoint
 	statusCB          StatusCallback
 	completedCallback func()
-	filesRepaired     int
 	wg                *sync.WaitGroup
 }
 
@@ -60,21 +100,41 @@ func (r *RepairRequest) processRepair(ctx context.Context, a *Allocation) {
 	if r.completedCallback != nil {
 		defer r.completedCallback()
 	}
+	defer r.checkpoint.close()
 
-	if r.checkForCancel(a) {
-		return
+	workers := r.workers
+	if workers <= 0 {
+		workers = 1
 	}
+	files := make(chan *ListResult, workers)
+	wg := &sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for file := range files {
+				r.repairPath(a, file)
+			}
+		}()
+	}
+	if !r.checkForCancel(a) {
+		r.iterateDir(a, r.listDir, files)
+	}
+	close(files)
+	wg.Wait()
 
-	r.iterateDir(a, r.listDir)
-
+	// the checkpoint is kept to retry only the failed files
+	if !r.canceled() && atomic.LoadInt64(&r.progress.FilesFailed) == 0 {
+		r.checkpoint.remove()
+	}
 	if r.statusCB != nil {
-		r.statusCB.RepairCompleted(r.filesRepaired)
+		r.statusCB.RepairCompleted(int(atomic.LoadInt64(&r.progress.FilesRepaired)))
 	}
 
 	return
 }
 
-func (r *RepairRequest) iterateDir(a *Allocation, dir *ListResult) {
+func (r *RepairRequest) iterateDir(a *Allocation, dir *ListResult, files chan<- *ListResult) {
 	switch dir.Type {
 	case fileref.DIRECTORY:
 		if len(dir.Children) == 0 {
@@ -91,11 +151,11 @@ func (r *RepairRequest) iterateDir(a *Allocation, dir *ListResult) {
 			if r.checkForCancel(a) {
 				return
 			}
-			r.iterateDir(a, childDir)
+			r.iterateDir(a, childDir, files)
 		}
 
 	case fileref.FILE:
-		r.repairFile(a, dir)
+		files <- dir
 
 	default:
 		Logger.Info("Invalid directory type", zap.Any("type", dir.Type))
@@ -104,81 +164,160 @@ func (r *RepairRequest) iterateDir(a *Allocation, dir *ListResult) {
 	return
 }
 
-func (r *RepairRequest) repairFile(a *Allocation, file *ListResult) {
-	if r.checkForCancel(a) {
+// repairPath repairs the file unless the checkpoint has it, and updates the
+// progress.
+func (r *RepairRequest) repairPath(a *Allocation, file *ListResult) {
+	if r.checkpoint.isDone(file.Path) {
+		atomic.AddInt64(&r.progress.FilesSkipped, 1)
+		r.reportProgress()
+		return
+	}
+	repaired, moved, err := r.repairFile(a, file)
+	if err == errRepairCanceled {
 		return
 	}
+	atomic.AddInt64(&r.progress.FilesChecked, 1)
+	atomic.AddInt64(&r.progress.BytesMoved, moved)
+	if err != nil {
+		atomic.AddInt64(&r.progress.FilesFailed, 1)
+	} else {
+		if repaired {
+			atomic.AddInt64(&r.progress.FilesRepaired, 1)
+		}
+		r.checkpoint.add(file.Path)
+	}
+	r.reportProgress()
+}
+
+// cancel stops the repair, the workers check it between the files.
+func (r *RepairRequest) cancel() {
+	atomic.StoreInt32(&r.isRepairCanceled, 1)
+}
+
+func (r *RepairRequest) canceled() bool {
+	return atomic.LoadInt32(&r.isRepairCanceled) == 1
+}
+
+// getProgress returns a snapshot of the progress.
+func (r *RepairRequest) getProgress() *RepairProgress {
+	return &RepairProgress{
+		FilesChecked:  atomic.LoadInt64(&r.progress.FilesChecked),
+		FilesRepaired: atomic.LoadInt64(&r.progress.FilesRepaired),
+		FilesFailed:   atomic.LoadInt64(&r.progress.FilesFailed),
+		FilesSkipped:  atomic.LoadInt64(&r.progress.FilesSkipped),
+		BytesMoved:    atomic.LoadInt64(&r.progress.BytesMoved),
+	}
+}
+
+func (r *RepairRequest) reportProgress() {
+	if cb, ok := r.statusCB.(RepairProgressCallback); ok {
+		cb.RepairProgress(*r.getProgress())
+	}
+}
+
+// repairFile repairs the file if needed. It returns whether the file was
+// repaired and the number of bytes downloaded and uploaded for it.
+func (r *RepairRequest) repairFile(a *Allocation, file *ListResult) (bool, int64, error) {
+	if r.checkForCancel(a) {
+		return false, 0, errRepairCanceled
+	}
 	Logger.Info("Checking file for the path :", zap.Any("path", file.Path))
-	found, repairRequired, _, err := a.RepairRequired(file.Path)
+	found, repairRequired, fileRef, err := a.repairRequired(file.Path)
 	if err != nil {
 		Logger.Error("repair_required_failed", zap.Error(err))
-		return
+		return false, 0, err
+	}
+	if !repairRequired {
+		return false, 0, nil
 	}
 
-	if repairRequired {
-		Logger.Info("Repair required for the path :", zap.Any("path", file.Path))
-		if found.CountOnes() >= a.DataShards {
-			Logger.Info("Repair by upload", zap.Any("path", file.Path))
-			var wg sync.WaitGroup
-			statusCB := &RepairStatusCB{
-				wg:       &wg,
-				statusCB: r.statusCB,
-			}
-
-			localPath := r.getLocalPath(file)
-
-			if !checkFileExists(localPath) {
-				if r.checkForCancel(a) {
-					return
-				}
-				Logger.Info("Downloading file for the path :", zap.Any("path", file.Path))
-				wg.Add(1)
-				err = a.DownloadFile(localPath, file.Path, statusCB)
-				if err != nil {
-					Logger.Error("download_file_failed", zap.Error(err))
-					return
-				}
-				wg.Wait()
-				if !statusCB.success {
-					Logger.Error("Failed to download file for repair, Status call back success failed",
-						zap.Any("localpath", localPath), zap.Any("remotepath", file.Path))
-					return
-				}
-				Logger.Info("Download file success for repair", zap.Any("localpath", localPath), zap.Any("remotepath", file.Path))
-				statusCB.success = false
-			}
+	Logger.Info("Repair required for the path :", zap.Any("path", file.Path))
+	if found.CountOnes() < a.DataShards {
+		Logger.Info("Repair by delete", zap.Any("path", file.Path))
+		consensus := float32(found.CountOnes())
+		err := a.deleteFile(file.Path, consensus, consensus)
+		if err != nil {
+			Logger.Error("repair_file_failed", zap.Error(err))
+			return false, 0, err
+		}
+		Logger.Info("Repair file success", zap.Any("remotepath", file.Path))
+		return true, 0, nil
+	}
 
-			if r.checkForCancel(a) {
-				return
-			}
+	Logger.Info("Repair by upload", zap.Any("path", file.Path))
+	var wg sync.WaitGroup
+	statusCB := &RepairStatusCB{
+		wg:       &wg,
+		statusCB: r.statusCB,
+	}
+	perShard := (fileRef.ActualFileSize + int64(a.DataShards) - 1) / int64(a.DataShards)
+	uploaded := perShard * int64(len(a.Blobbers)-found.CountOnes())
+	var moved int64
 
-			Logger.Info("Repairing file for the path :", zap.Any("path", file.Path))
-			wg.Add(1)
-			err = a.RepairFile(localPath, file.Path, statusCB)
-			if err != nil {
-				Logger.Error("repair_file_failed", zap.Error(err))
-				return
-			}
-			wg.Wait()
-			if !statusCB.success {
-				Logger.Error("Failed to repair file, Status call back success failed",
-					zap.Any("localpath", localPath), zap.Any("remotepath", file.Path))
-				return
-			}
-		} else {
-			Logger.Info("Repair by delete", zap.Any("path", file.Path))
-			consensus := float32(found.CountOnes())
-			err := a.deleteFile(file.Path, consensus, consensus)
-			if err != nil {
-				Logger.Error("repair_file_failed", zap.Error(err))
-				return
-			}
+	if r.fromBlobbers {
+		if r.checkForCancel(a) {
+			return false, moved, errRepairCanceled
+		}
+		Logger.Info("Repairing file from the blobbers for the path :", zap.Any("path", file.Path))
+		wg.Add(1)
+		err = a.RepairFileFromBlobbers(file.Path, statusCB)
+		if err != nil {
+			Logger.Error("repair_file_failed", zap.Error(err))
+			return false, moved, err
+		}
+		wg.Wait()
+		if !statusCB.success {
+			Logger.Error("Failed to repair file, Status call back success failed",
+				zap.Any("remotepath", file.Path))
+			return false, moved, statusCB.err
 		}
 		Logger.Info("Repair file success", zap.Any("remotepath", file.Path))
-		r.filesRepaired++
+		return true, fileRef.ActualFileSize + uploaded, nil
 	}
 
-	return
+	localPath := r.getLocalPath(file)
+
+	if !checkFileExists(localPath) {
+		if r.checkForCancel(a) {
+			return false, moved, errRepairCanceled
+		}
+		Logger.Info("Downloading file for the path :", zap.Any("path", file.Path))
+		wg.Add(1)
+		err = a.DownloadFile(localPath, file.Path, statusCB)
+		if err != nil {
+			Logger.Error("download_file_failed", zap.Error(err))
+			return false, moved, err
+		}
+		wg.Wait()
+		if !statusCB.success {
+			Logger.Error("Failed to download file for repair, Status call back success failed",
+				zap.Any("localpath", localPath), zap.Any("remotepath", file.Path))
+			return false, moved, statusCB.err
+		}
+		Logger.Info("Download file success for repair", zap.Any("localpath", localPath), zap.Any("remotepath", file.Path))
+		statusCB.success = false
+		moved += fileRef.ActualFileSize
+	}
+
+	if r.checkForCancel(a) {
+		return false, moved, errRepairCanceled
+	}
+
+	Logger.Info("Repairing file for the path :", zap.Any("path", file.Path))
+	wg.Add(1)
+	err = a.RepairFile(localPath, file.Path, statusCB)
+	if err != nil {
+		Logger.Error("repair_file_failed", zap.Error(err))
+		return false, moved, err
+	}
+	wg.Wait()
+	if !statusCB.success {
+		Logger.Error("Failed to repair file, Status call back success failed",
+			zap.Any("localpath", localPath), zap.Any("remotepath", file.Path))
+		return false, moved, statusCB.err
+	}
+	Logger.Info("Repair file success", zap.Any("remotepath", file.Path))
+	return true, moved + uploaded, nil
 }
 
 func (r *RepairRequest) getLocalPath(file *ListResult) string {
@@ -194,11 +333,8 @@ func checkFileExists(localPath string) bool {
 }
 
 func (r *RepairRequest) checkForCancel(a *Allocation) bool {
-	if r.isRepairCanceled {
+	if r.canceled() {
 		Logger.Info("Repair Cancelled by the user")
-		if r.statusCB != nil {
-			r.statusCB.RepairCompleted(r.filesRepaired)
-		}
 		return true
 	}
 	return false
@@ -0,0 +1,173 @@
+package sdk
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type repairProgressStatus struct {
+	StatusCallback
+	mutex         sync.Mutex
+	progress      []RepairProgress
+	filesRepaired int
+}
+
+func (s *repairProgressStatus) RepairProgress(progress RepairProgress) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.progress = append(s.progress, progress)
+}
+
+func (s *repairProgressStatus) RepairCompleted(filesRepaired int) {
+	s.filesRepaired = filesRepaired
+}
+
+func TestRepairRequest_processRepair(t *testing.T) {
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+	// the blobbers don't have the files, they can't be checked
+	mockClient.On("Do", mock.Anything).Return(func(*http.Request) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusBadRequest,
+			Body:       ioutil.NopCloser(bytes.NewReader([]byte("not found"))),
+		}
+	}, nil)
+
+	dir, err := ioutil.TempDir("", "repair")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	listDir := &ListResult{
+		Type: fileref.DIRECTORY,
+		Path: "/",
+	}
+	for i := 0; i < 5; i++ {
+		listDir.Children = append(listDir.Children, &ListResult{
+			Type: fileref.FILE,
+			Path: "/" + strconv.Itoa(i) + ".txt",
+		})
+	}
+
+	tests := []struct {
+		name           string
+		done           []string
+		workers        int
+		wantProgress   RepairProgress
+		wantCheckpoint bool
+	}{
+		{
+			name:           "Test_Failed_Files_Counted",
+			workers:        3,
+			wantProgress:   RepairProgress{FilesChecked: 5, FilesFailed: 5},
+			wantCheckpoint: true,
+		},
+		{
+			name:           "Test_Checkpoint_Skipped",
+			done:           []string{"/0.txt", "/3.txt"},
+			wantProgress:   RepairProgress{FilesChecked: 3, FilesFailed: 3, FilesSkipped: 2},
+			wantCheckpoint: true,
+		},
+		{
+			name:         "Test_All_Done_Checkpoint_Removed",
+			done:         []string{"/0.txt", "/1.txt", "/2.txt", "/3.txt", "/4.txt"},
+			workers:      2,
+			wantProgress: RepairProgress{FilesSkipped: 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			a := &Allocation{
+				DataShards:   2,
+				ParityShards: 2,
+			}
+			setupMockAllocation(t, a)
+			for i := 0; i < numBlobbers; i++ {
+				a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+					ID:      tt.name + mockBlobberId + strconv.Itoa(i),
+					Baseurl: "TestRepairRequest_processRepair" + tt.name + mockBlobberUrl + strconv.Itoa(i),
+				})
+			}
+
+			checkpointPath := filepath.Join(dir, tt.name)
+			content := ""
+			for _, path := range tt.done {
+				content += path + "\n"
+			}
+			require.NoError(ioutil.WriteFile(checkpointPath, []byte(content), 0600))
+			checkpoint, err := openRepairCheckpoint(checkpointPath)
+			require.NoError(err)
+
+			status := &repairProgressStatus{}
+			r := &RepairRequest{
+				listDir:    listDir,
+				workers:    tt.workers,
+				checkpoint: checkpoint,
+				statusCB:   status,
+			}
+			r.processRepair(a.ctx, a)
+
+			require.EqualValues(&tt.wantProgress, r.getProgress())
+			require.Len(status.progress, 5)
+			require.EqualValues(0, status.filesRepaired)
+			// the checkpoint is kept for the next repair to retry the failed files
+			_, err = os.Stat(checkpointPath)
+			require.EqualValues(tt.wantCheckpoint, err == nil)
+		})
+	}
+}
+
+func TestRepairCheckpoint(t *testing.T) {
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "repair")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "checkpoint")
+
+	checkpoint, err := openRepairCheckpoint(path)
+	require.NoError(err)
+	require.False(checkpoint.isDone("/1.txt"))
+	checkpoint.add("/1.txt")
+	checkpoint.add("/d/2.txt")
+	require.True(checkpoint.isDone("/1.txt"))
+	checkpoint.close()
+
+	checkpoint, err = openRepairCheckpoint(path)
+	require.NoError(err)
+	require.True(checkpoint.isDone("/1.txt"))
+	require.True(checkpoint.isDone("/d/2.txt"))
+	require.False(checkpoint.isDone("/3.txt"))
+	checkpoint.remove()
+	_, err = os.Stat(path)
+	require.True(os.IsNotExist(err))
+	// processRepair closes it again once removed
+	checkpoint.close()
+	checkpoint.add("/3.txt")
+	require.True(checkpoint.isDone("/3.txt"))
+
+	var nilCheckpoint *repairCheckpoint
+	nilCheckpoint.add("/1.txt")
+	require.False(nilCheckpoint.isDone("/1.txt"))
+	nilCheckpoint.remove()
+}
@@ -34,6 +34,9 @@ const (
 	OpDownload int = 1
 	OpRepair   int = 2
 	OpUpdate   int = 3
+	OpDelete   int = 4
+	OpCopy     int = 5
+	OpMove     int = 6
 )
 
 type StatusCallback interface {
@@ -46,6 +49,7 @@ type StatusCallback interface {
 }
 
 var numBlockDownloads = 10
+var downloadHedgeDelay time.Duration
 var sdkInitialized = false
 var networkWorkerTimerInHours = 1
 
@@ -808,6 +812,15 @@ func SetNumBlockDownloads(num int) {
 	return
 }
 
+// SetDownloadHedgeDelay sets how long a block download waits for the blobbers
+// before it asks the spare ones too. Zero adapts the delay to the observed
+// latency of the blobbers.
+func SetDownloadHedgeDelay(delay time.Duration) {
+	if delay >= 0 {
+		downloadHedgeDelay = delay
+	}
+}
+
 func GetAllocations() ([]*Allocation, error) {
 	return GetAllocationsForClient(client.GetClientID())
 }
@@ -0,0 +1,203 @@
+package sdk
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"hash"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/util"
+	"github.com/0chain/gosdk/zboxcore/encoder"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"golang.org/x/crypto/sha3"
+)
+
+// CorruptedShardCallback is implemented by the status callbacks which want to
+// know the blobbers returning corrupted data for a download. The download
+// goes on without the blobber.
+type CorruptedShardCallback interface {
+	CorruptedShard(allocationID, filePath string, blobberID string, err error)
+}
+
+const merkleChunkSize = 64
+
+// shardVerifier hashes the shard a blobber returns block by block, the same
+// way the upload hashed it, to check it against the content hash and the
+// merkle root of the blobber's ref once the blobber returned all the blocks.
+type shardVerifier struct {
+	contentHash  string
+	merkleRoot   string
+	numBlocks    int64
+	nextBlock    int64
+	h            hash.Hash
+	merkleHashes []hash.Hash
+	// skipped is set when the blobber didn't return some of the blocks
+	skipped bool
+}
+
+func newShardVerifier(ref *fileref.FileRef, numBlocks int64) *shardVerifier {
+	v := &shardVerifier{
+		contentHash:  ref.ContentHash,
+		merkleRoot:   ref.MerkleRoot,
+		numBlocks:    numBlocks,
+		nextBlock:    1,
+		h:            sha1.New(),
+		merkleHashes: make([]hash.Hash, fileref.CHUNK_SIZE/merkleChunkSize),
+	}
+	for idx := range v.merkleHashes {
+		v.merkleHashes[idx] = sha3.New256()
+	}
+	return v
+}
+
+// write hashes the chunks of the blocks starting at the block number.
+func (v *shardVerifier) write(blockNum int64, chunks [][]byte) {
+	if v.skipped || blockNum != v.nextBlock {
+		v.skipped = true
+		return
+	}
+	for _, chunk := range chunks {
+		v.h.Write(chunk)
+		for i := 0; i < len(chunk); i += merkleChunkSize {
+			end := i + merkleChunkSize
+			if end > len(chunk) {
+				end = len(chunk)
+			}
+			v.merkleHashes[i/merkleChunkSize].Write(chunk[i:end])
+		}
+	}
+	v.nextBlock += int64(len(chunks))
+}
+
+// verify checks the hashed shard, it returns false when the shard wasn't
+// hashed completely.
+func (v *shardVerifier) verify() (bool, error) {
+	if v.skipped || v.nextBlock <= v.numBlocks {
+		return false, nil
+	}
+	if contentHash := hex.EncodeToString(v.h.Sum(nil)); contentHash != v.contentHash {
+		return true, errors.New("content_hash_mismatch",
+			fmt.Sprintf("Shard content hash %s didn't match %s", contentHash, v.contentHash))
+	}
+	merkleLeaves := make([]util.Hashable, len(v.merkleHashes))
+	for idx := range v.merkleHashes {
+		merkleLeaves[idx] = util.NewStringHashable(hex.EncodeToString(v.merkleHashes[idx].Sum(nil)))
+	}
+	var mt util.MerkleTreeI = &util.MerkleTree{}
+	mt.ComputeTree(merkleLeaves)
+	if mt.GetRoot() != v.merkleRoot {
+		return true, errors.New("merkle_root_mismatch",
+			fmt.Sprintf("Shard merkle root %s didn't match %s", mt.GetRoot(), v.merkleRoot))
+	}
+	return true, nil
+}
+
+// setupShardVerifiers prepares the verifiers of the blobbers in the download
+// mask from their refs. The shards of encrypted files are re-encrypted for
+// the download, they can't be checked against the uploaded hashes.
+func (req *DownloadRequest) setupShardVerifiers(refs []*fileMetaResponse, numBlocks int64) {
+	req.shardVerifiers = make(map[int]*shardVerifier)
+	if len(req.encryptedKey) > 0 {
+		return
+	}
+	for _, rsp := range refs {
+		if rsp.fileref == nil || req.downloadMask.And(zboxutil.NewUint128(1).Lsh(uint64(rsp.blobberIdx))).Equals64(0) {
+			continue
+		}
+		req.shardVerifiers[rsp.blobberIdx] = newShardVerifier(rsp.fileref, numBlocks)
+	}
+}
+
+// verifyShards checks the shards of the blobbers which returned all the
+// blocks and reports the corrupted ones. It returns the number of corrupted
+// shards found.
+func (req *DownloadRequest) verifyShards() int {
+	corrupted := 0
+	for idx, v := range req.shardVerifiers {
+		checked, err := v.verify()
+		if !checked {
+			continue
+		}
+		if err != nil {
+			req.reportCorruptedShard(idx, err)
+			corrupted++
+		}
+	}
+	return corrupted
+}
+
+// reportCorruptedShard leaves the blobber out of the rest of the download and
+// reports it.
+func (req *DownloadRequest) reportCorruptedShard(blobberIdx int, err error) {
+	blobber := req.blobbers[blobberIdx]
+	Logger.Error("Corrupted shard from blobber ", blobber.Baseurl, " ", err)
+	req.corruptedMask = req.corruptedMask.Or(zboxutil.NewUint128(1).Lsh(uint64(blobberIdx)))
+	req.downloadMask = req.downloadMask.And(req.corruptedMask.Not())
+	delete(req.shardVerifiers, blobberIdx)
+	if cb, ok := req.statusCallback.(CorruptedShardCallback); ok {
+		filePath := req.remotefilepath
+		if len(filePath) == 0 {
+			filePath = req.remotefilepathhash
+		}
+		cb.CorruptedShard(req.allocationID, filePath, blobber.ID,
+			errors.Wrap(err, "Blobber returned corrupted data"))
+	}
+}
+
+// isVerifying tells whether the shard of the blobber is being verified.
+func (req *DownloadRequest) isVerifying(blobberIdx int) bool {
+	v, ok := req.shardVerifiers[blobberIdx]
+	return ok && !v.skipped
+}
+
+// skipIncompleteShards stops the verification of the shards which miss a
+// block before the next one, another blobber served it.
+func (req *DownloadRequest) skipIncompleteShards(nextBlock int64) {
+	for _, v := range req.shardVerifiers {
+		if v.nextBlock != nextBlock {
+			v.skipped = true
+		}
+	}
+}
+
+// shardsToFetch returns the number of shards fetched for a block out of the
+// available ones. The decode of the data shards alone always succeeds, the
+// extra shards fetched once the file hash didn't match find the corrupted
+// shard by the block: it's detected with a shard more and found with two.
+func (req *DownloadRequest) shardsToFetch(available int) int {
+	if n := req.datashards + req.extraShards; n < available {
+		return n
+	}
+	return available
+}
+
+// findCorruptedShard looks for the shard which fails the verification of the
+// block, by decoding the block without each of the shards in turn. It needs
+// two shards more than the data shards to tell, it returns -1 when it can't.
+func (req *DownloadRequest) findCorruptedShard(erasureencoder *encoder.StreamEncoder,
+	shards [][]byte, shardSize int) int {
+
+	var present []int
+	for idx, shard := range shards {
+		if shard != nil {
+			present = append(present, idx)
+		}
+	}
+	// with a shard left out there have to be more than the data shards to
+	// verify the rest
+	if len(present) <= req.datashards+1 {
+		return -1
+	}
+	for _, idx := range present {
+		in := make([][]byte, len(shards))
+		copy(in, shards)
+		in[idx] = nil
+		if _, err := erasureencoder.Decode(in, shardSize); err == nil {
+			return idx
+		}
+	}
+	return -1
+}
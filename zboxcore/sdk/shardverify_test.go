@@ -0,0 +1,288 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0chain/gosdk/core/util"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	"github.com/0chain/gosdk/zboxcore/encoder"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/sha3"
+)
+
+func testShardRef(chunks [][]byte) *fileref.FileRef {
+	h := sha1.New()
+	merkleLeaves := make([]util.Hashable, fileref.CHUNK_SIZE/merkleChunkSize)
+	for idx := range merkleLeaves {
+		mh := sha3.New256()
+		for _, chunk := range chunks {
+			if start := idx * merkleChunkSize; start < len(chunk) {
+				end := start + merkleChunkSize
+				if end > len(chunk) {
+					end = len(chunk)
+				}
+				mh.Write(chunk[start:end])
+			}
+		}
+		merkleLeaves[idx] = util.NewStringHashable(hex.EncodeToString(mh.Sum(nil)))
+	}
+	for _, chunk := range chunks {
+		h.Write(chunk)
+	}
+	var mt util.MerkleTreeI = &util.MerkleTree{}
+	mt.ComputeTree(merkleLeaves)
+	ref := &fileref.FileRef{}
+	ref.ContentHash = hex.EncodeToString(h.Sum(nil))
+	ref.MerkleRoot = mt.GetRoot()
+	return ref
+}
+
+func TestShardVerifier(t *testing.T) {
+	chunks := [][]byte{
+		make([]byte, fileref.CHUNK_SIZE),
+		make([]byte, fileref.CHUNK_SIZE),
+		make([]byte, 1000),
+	}
+	for i, chunk := range chunks {
+		for j := range chunk {
+			chunk[j] = byte(i + j)
+		}
+	}
+	ref := testShardRef(chunks)
+
+	tests := []struct {
+		name        string
+		write       func(v *shardVerifier)
+		wantChecked bool
+		wantErr     bool
+	}{
+		{
+			name: "Test_Success",
+			write: func(v *shardVerifier) {
+				v.write(1, chunks[:2])
+				v.write(3, chunks[2:])
+			},
+			wantChecked: true,
+		},
+		{
+			name: "Test_Incomplete_Not_Checked",
+			write: func(v *shardVerifier) {
+				v.write(1, chunks[:2])
+			},
+		},
+		{
+			name: "Test_Skipped_Block_Not_Checked",
+			write: func(v *shardVerifier) {
+				v.write(1, chunks[:1])
+				v.write(3, chunks[2:])
+			},
+		},
+		{
+			name: "Test_Corrupted_Failed",
+			write: func(v *shardVerifier) {
+				corrupted := append([]byte{}, chunks[1]...)
+				corrupted[10]++
+				v.write(1, [][]byte{chunks[0], corrupted, chunks[2]})
+			},
+			wantChecked: true,
+			wantErr:     true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newShardVerifier(ref, int64(len(chunks)))
+			tt.write(v)
+			checked, err := v.verify()
+			require.EqualValues(t, tt.wantChecked, checked)
+			require.EqualValues(t, tt.wantErr, err != nil)
+		})
+	}
+}
+
+type corruptedShardStatus struct {
+	StatusCallback
+	blobberIDs []string
+}
+
+func (s *corruptedShardStatus) CorruptedShard(allocationID, filePath string, blobberID string, err error) {
+	s.blobberIDs = append(s.blobberIDs, blobberID)
+}
+
+func TestDownloadRequest_findCorruptedShard(t *testing.T) {
+	require := require.New(t)
+	erasureencoder, err := encoder.NewEncoder(2, 2)
+	require.NoError(err)
+	data := make([]byte, 2*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	shards, err := erasureencoder.Encode(data)
+	require.NoError(err)
+
+	status := &corruptedShardStatus{}
+	req := &DownloadRequest{datashards: 2, parityshards: 2, statusCallback: status, downloadMask: zboxutil.NewUint128(15)}
+	for i := 0; i < numBlobbers; i++ {
+		req.blobbers = append(req.blobbers, &blockchain.StorageNode{ID: mockBlobberId + strconv.Itoa(i)})
+	}
+
+	for corrupted := range shards {
+		in := make([][]byte, len(shards))
+		for i := range shards {
+			in[i] = append([]byte{}, shards[i]...)
+		}
+		in[corrupted][5]++
+		require.EqualValues(corrupted, req.findCorruptedShard(erasureencoder, in, len(shards[0])))
+
+		// with a shard missing the corrupted one can't be told
+		in[(corrupted+1)%len(in)] = nil
+		require.EqualValues(-1, req.findCorruptedShard(erasureencoder, in, len(shards[0])))
+	}
+
+	req.reportCorruptedShard(1, encoder.ErrCorrupted)
+	require.EqualValues([]string{mockBlobberId + "1"}, status.blobberIDs)
+	require.EqualValues(zboxutil.NewUint128(13), req.downloadMask)
+}
+
+func TestDownloadRequest_downloadBlock_Corrupted(t *testing.T) {
+	erasureencoder, err := encoder.NewEncoder(2, 3)
+	require.NoError(t, err)
+	data := make([]byte, 2*1024)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	shards, err := erasureencoder.Encode(data)
+	require.NoError(t, err)
+	// the first blobber asked returns a corrupted shard
+	corrupted := append([]byte{}, shards[0]...)
+	corrupted[5]++
+
+	tests := []struct {
+		name        string
+		extraShards int
+		wantFetched int32
+		wantData    bool
+		wantIDs     []string
+	}{
+		{
+			// the data shards alone decode the corrupted shard unnoticed, the
+			// file hash check catches it
+			name:        "Test_Data_Shards_Only",
+			wantFetched: 2,
+		},
+		{
+			name:        "Test_Extra_Shards_Found",
+			extraShards: 2,
+			wantFetched: 4,
+			wantData:    true,
+			wantIDs:     []string{"Test_Extra_Shards_Found0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			status := &corruptedShardStatus{}
+			req := &DownloadRequest{
+				datashards:     2,
+				parityshards:   3,
+				numBlocks:      1,
+				ctx:            context.Background(),
+				statusCallback: status,
+				downloadMask:   zboxutil.NewUint128(31),
+				extraShards:    tt.extraShards,
+			}
+			for i := range shards {
+				req.blobbers = append(req.blobbers, &blockchain.StorageNode{ID: tt.name + strconv.Itoa(i)})
+			}
+			var fetched int32
+			setupMockBlockDownload(t, req.blobbers, func(blockReq *BlockDownloadRequest) *downloadBlock {
+				atomic.AddInt32(&fetched, 1)
+				shard := shards[blockReq.blobberIdx]
+				if blockReq.blobberIdx == 0 {
+					shard = corrupted
+				}
+				return &downloadBlock{Success: true, idx: blockReq.blobberIdx, BlockChunks: [][]byte{shard}}
+			})
+
+			got, err := req.downloadBlock(1, 1)
+			require.NoError(err)
+			require.EqualValues(tt.wantData, bytes.Equal(data, got))
+			require.EqualValues(tt.wantFetched, atomic.LoadInt32(&fetched))
+			require.EqualValues(tt.wantIDs, status.blobberIDs)
+		})
+	}
+}
+
+func TestDownloadRequest_verifyShards_Hedged(t *testing.T) {
+	require := require.New(t)
+	const numBlocks = 3
+	erasureencoder, err := encoder.NewEncoder(2, 2)
+	require.NoError(err)
+	// the shards of the blobbers by block
+	blocks := make([][][]byte, numBlocks)
+	for b := range blocks {
+		data := make([]byte, 2*1024)
+		for i := range data {
+			data[i] = byte(b + i)
+		}
+		blocks[b], err = erasureencoder.Encode(data)
+		require.NoError(err)
+	}
+
+	status := &corruptedShardStatus{}
+	req := &DownloadRequest{
+		datashards:     2,
+		parityshards:   2,
+		numBlocks:      1,
+		ctx:            context.Background(),
+		statusCallback: status,
+		downloadMask:   zboxutil.NewUint128(15),
+	}
+	var refs []*fileMetaResponse
+	for i := 0; i < numBlobbers; i++ {
+		req.blobbers = append(req.blobbers, &blockchain.StorageNode{ID: t.Name() + strconv.Itoa(i)})
+		var chunks [][]byte
+		for b := range blocks {
+			chunks = append(chunks, blocks[b][i])
+		}
+		refs = append(refs, &fileMetaResponse{fileref: testShardRef(chunks), blobberIdx: i})
+	}
+	req.setupShardVerifiers(refs, numBlocks)
+	// the blobbers are asked in the order 0, 1, 3, 2
+	for i, latency := range []time.Duration{time.Millisecond, 2 * time.Millisecond, time.Second, 500 * time.Millisecond} {
+		observeBlobberLatency(req.blobbers[i], latency)
+	}
+
+	// the second blobber is slow for the first block, the spare one serves
+	// it and the rest of the blocks, with a corrupted shard
+	setupMockBlockDownload(t, req.blobbers, func(blockReq *BlockDownloadRequest) *downloadBlock {
+		idx := blockReq.blobberIdx
+		if idx == 1 && blockReq.blockNum == 1 {
+			<-blockReq.ctx.Done()
+			return &downloadBlock{idx: idx, err: blockReq.ctx.Err()}
+		}
+		shard := blocks[blockReq.blockNum-1][idx]
+		if idx == 3 {
+			shard = append([]byte{}, shard...)
+			shard[5]++
+		}
+		return &downloadBlock{Success: true, idx: idx, BlockChunks: [][]byte{shard}}
+	})
+	downloadHedgeDelay = 20 * time.Millisecond
+	defer func() { downloadHedgeDelay = 0 }()
+
+	for b := int64(1); b <= numBlocks; b++ {
+		_, err := req.downloadBlock(b, 1)
+		require.NoError(err)
+	}
+	require.EqualValues(1, req.verifyShards())
+	require.EqualValues([]string{t.Name() + "3"}, status.blobberIDs)
+}
@@ -1,16 +1,14 @@
 package sdk
 
 import (
-	"crypto/sha1"
-	"encoding/hex"
 	"encoding/json"
-	"io"
 	"io/ioutil"
-	"log"
 	"sort"
 
 	"os"
+	"path"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/0chain/errors"
@@ -26,6 +24,14 @@ const (
 	Delete      = "Delete"
 	Conflict    = "Conflict"
 	LocalDelete = "LocalDelete"
+	// CreateDir and LocalCreateDir create the empty dirs, the dirs with
+	// content are created by the transfers of the files
+	CreateDir      = "CreateDir"
+	LocalCreateDir = "LocalCreateDir"
+	// Move and Copy reuse a remote file with the content of a local one, the
+	// Src of the diff is the remote path to move or copy
+	Move = "Move"
+	Copy = "Copy"
 )
 
 type fileInfo struct {
@@ -33,26 +39,28 @@ type fileInfo struct {
 	ActualSize int64  `json:"actual_size"`
 	Hash       string `json:"hash"`
 	Type       string `json:"type"`
+	CustomMeta string `json:"custom_meta,omitempty"`
 }
 
 type FileDiff struct {
 	Op   string `json:"operation"`
 	Path string `json:"path"`
 	Type string `json:"type"`
+	Src  string `json:"src,omitempty"`
 }
 
-func (a *Allocation) getRemoteFilesAndDirs(dirList []string, fMap map[string]fileInfo, exclMap map[string]int) ([]string, error) {
+func (a *Allocation) getRemoteFilesAndDirs(dirList []string, fMap map[string]fileInfo, rules *ignoreRules) ([]string, error) {
 	childDirList := make([]string, 0)
 	for _, dir := range dirList {
-		ref, err := a.ListDir(dir)
+		ref, err := a.listDirAll(dir)
 		if err != nil {
 			return []string{}, err
 		}
 		for _, child := range ref.Children {
-			if _, ok := exclMap[child.Path]; ok {
+			if rules.isIgnored(child.Path, child.Type == fileref.DIRECTORY) {
 				continue
 			}
-			fMap[child.Path] = fileInfo{Size: child.Size, ActualSize: child.ActualSize, Hash: child.Hash, Type: child.Type}
+			fMap[child.Path] = fileInfo{Size: child.Size, ActualSize: child.ActualSize, Hash: child.Hash, Type: child.Type, CustomMeta: child.CustomMeta}
 			if child.Type == fileref.DIRECTORY {
 				childDirList = append(childDirList, child.Path)
 			}
@@ -61,13 +69,27 @@ func (a *Allocation) getRemoteFilesAndDirs(dirList []string, fMap map[string]fil
 	return childDirList, nil
 }
 
+// GetRemoteFileMap lists the allocation without the paths of the exclMap and
+// their content.
 func (a *Allocation) GetRemoteFileMap(exclMap map[string]int) (map[string]fileInfo, error) {
+	var exclPath []string
+	for p := range exclMap {
+		exclPath = append(exclPath, p)
+	}
+	rules, err := newSyncIgnoreRules("", nil, exclPath)
+	if err != nil {
+		return nil, err
+	}
+	return a.getRemoteFileMap(rules)
+}
+
+func (a *Allocation) getRemoteFileMap(rules *ignoreRules) (map[string]fileInfo, error) {
 	// 1. Iteratively get dir and files separately till no more dirs left
 	remoteList := make(map[string]fileInfo)
 	dirs := []string{"/"}
 	var err error
 	for {
-		dirs, err = a.getRemoteFilesAndDirs(dirs, remoteList, exclMap)
+		dirs, err = a.getRemoteFilesAndDirs(dirs, remoteList, rules)
 		if err != nil {
 			Logger.Error(err.Error())
 			break
@@ -80,65 +102,49 @@ func (a *Allocation) GetRemoteFileMap(exclMap map[string]int) (map[string]fileIn
 	return remoteList, err
 }
 
-func calcFileHash(filePath string) string {
-	fp, err := os.Open(filePath)
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer fp.Close()
-
-	h := sha1.New()
-	if _, err := io.Copy(h, fp); err != nil {
-		log.Fatal(err)
-	}
-	return hex.EncodeToString(h.Sum(nil))
-}
-
-func getRemoteExcludeMap(exclPath []string) map[string]int {
-	exclMap := make(map[string]int)
-	for idx, path := range exclPath {
-		exclMap[strings.TrimRight(path, "/")] = idx
-	}
-	return exclMap
-}
-
-func addLocalFileList(root string, fMap map[string]fileInfo, dirList *[]string, filter map[string]bool, exclMap map[string]int) filepath.WalkFunc {
+func addLocalFileList(root string, fMap map[string]fileInfo, dirList *[]string, rules *ignoreRules, idx *localIndex) filepath.WalkFunc {
 	return func(path string, info os.FileInfo, err error) error {
 		if err != nil {
 			Logger.Error("Local file list error for path", path, err.Error())
 			return nil
 		}
-		// Filter out
-		if _, ok := filter[info.Name()]; ok {
-			return nil
-		}
 		lPath, err := filepath.Rel(root, path)
 		if err != nil {
 			Logger.Error("getting relative path failed", err)
 		}
-		lPath = "/" + lPath
-		// Exclude
-		if _, ok := exclMap[lPath]; ok {
+		if lPath == "." {
+			return nil
+		}
+		lPath = "/" + filepath.ToSlash(lPath)
+		// Exclude, with the content of the dirs
+		if rules.isIgnored(lPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
 			return nil
 		}
 		// Add to list
 		if info.IsDir() {
 			*dirList = append(*dirList, lPath)
 		} else {
-			fMap[lPath] = fileInfo{Size: info.Size(), Hash: calcFileHash(path), Type: fileref.FILE}
+			hash, err := idx.hash(lPath, path, info)
+			if err != nil {
+				// the file is gone since it was listed
+				if os.IsNotExist(err) {
+					return nil
+				}
+				return errors.Wrap(err, "error hashing local file "+path)
+			}
+			fMap[lPath] = fileInfo{Size: info.Size(), Hash: hash, Type: fileref.FILE}
 		}
 		return nil
 	}
 }
 
-func getLocalFileMap(rootPath string, filters []string, exclMap map[string]int) (map[string]fileInfo, error) {
+func getLocalFileMap(rootPath string, rules *ignoreRules, idx *localIndex) (map[string]fileInfo, error) {
 	localMap := make(map[string]fileInfo)
 	var dirList []string
-	filterMap := make(map[string]bool)
-	for _, f := range filters {
-		filterMap[f] = true
-	}
-	err := filepath.Walk(rootPath, addLocalFileList(rootPath, localMap, &dirList, filterMap, exclMap))
+	err := filepath.Walk(rootPath, addLocalFileList(rootPath, localMap, &dirList, rules, idx))
 	// Add the dirs at the end of the list for dir deletiion after all file deletion
 	for _, d := range dirList {
 		localMap[d] = fileInfo{Type: fileref.DIRECTORY}
@@ -147,6 +153,15 @@ func getLocalFileMap(rootPath string, filters []string, exclMap map[string]int)
 	return localMap, err
 }
 
+// syncParentDirs returns the dirs of the map which have children.
+func syncParentDirs(fMap map[string]fileInfo) map[string]bool {
+	parents := make(map[string]bool)
+	for p := range fMap {
+		parents[path.Dir(p)] = true
+	}
+	return parents
+}
+
 func isParentFolderExists(lFDiff []FileDiff, path string) bool {
 	subdirs := strings.Split(path, "/")
 	p := "/"
@@ -163,6 +178,8 @@ func isParentFolderExists(lFDiff []FileDiff, path string) bool {
 
 func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[string]fileInfo, localRootPath string) []FileDiff {
 	var lFDiff []FileDiff
+	rParents := syncParentDirs(rMap)
+	lParents := syncParentDirs(lMap)
 
 	// Create a remote hash map and find modifications
 	rMod := make(map[string]fileInfo)
@@ -219,6 +236,12 @@ func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[s
 				continue
 			}
 		}
+		if op == Download && rMap[rPath].Type == fileref.DIRECTORY {
+			if rParents[rPath] {
+				continue
+			}
+			op = LocalCreateDir
+		}
 		lFDiff = append(lFDiff, FileDiff{Path: rPath, Op: op, Type: rMap[rPath].Type})
 	}
 
@@ -238,12 +261,17 @@ func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[s
 				continue
 			}
 			if fInfo.IsDir() {
-				continue
+				if op != Upload || lParents[lPath] {
+					continue
+				}
+				op = CreateDir
 			}
 		}
 		lFDiff = append(lFDiff, FileDiff{Path: lPath, Op: op, Type: lMap[lPath].Type})
 	}
 
+	lFDiff = findMoves(lFDiff, rMap, lMap)
+
 	// If there are differences, remove childs if the parent folder is deleted
 	if len(lFDiff) > 0 {
 		sort.SliceStable(lFDiff, func(i, j int) bool { return lFDiff[i].Path < lFDiff[j].Path })
@@ -255,8 +283,8 @@ func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[s
 					newlFDiff = append(newlFDiff, f)
 				}
 			} else {
-				// Add only files for other Op
-				if f.Type == fileref.FILE {
+				// Add only files and empty dirs for other Op
+				if f.Type == fileref.FILE || f.Op == CreateDir || f.Op == LocalCreateDir {
 					newlFDiff = append(newlFDiff, f)
 				}
 			}
@@ -266,7 +294,137 @@ func findDelta(rMap map[string]fileInfo, lMap map[string]fileInfo, prevMap map[s
 	return lFDiff
 }
 
+// findMoves replaces the uploads of the local files with the content of a
+// remote one by a Move of the remote file, if it's deleted by the diff, or by
+// a Copy otherwise. Moving or copying with another name takes a rename at an
+// intermediate path, see Sync, the diff falls back to the upload
+// if the intermediate path is taken.
+func findMoves(lFDiff []FileDiff, rMap map[string]fileInfo, lMap map[string]fileInfo) []FileDiff {
+	deletes := make(map[string]bool)
+	for _, f := range lFDiff {
+		if f.Op == Delete {
+			deletes[f.Path] = true
+		}
+	}
+	// the deletes of the files under a deleted dir are left out of the diff
+	deleted := func(p string) bool {
+		for ; p != "/" && p != "."; p = path.Dir(p) {
+			if deletes[p] {
+				return true
+			}
+		}
+		return false
+	}
+	// the remote files by content, sorted for a deterministic choice
+	var rPaths []string
+	for rPath, rInfo := range rMap {
+		if rInfo.Type == fileref.FILE && len(rInfo.Hash) > 0 && rInfo.ActualSize > 0 {
+			rPaths = append(rPaths, rPath)
+		}
+	}
+	sort.Strings(rPaths)
+	moveSrc := make(map[string][]string)
+	copySrc := make(map[string]string)
+	for _, rPath := range rPaths {
+		key := syncContentKey(rMap[rPath].Hash, rMap[rPath].ActualSize)
+		if deleted(rPath) {
+			moveSrc[key] = append(moveSrc[key], rPath)
+		} else if _, ok := copySrc[key]; !ok {
+			copySrc[key] = rPath
+		}
+	}
+
+	// a path is taken if it exists on either side or is used by another move
+	taken := func(p string) bool {
+		_, rOk := rMap[p]
+		_, lOk := lMap[p]
+		return rOk || lOk
+	}
+	used := make(map[string]bool)
+	dirExists := func(dir string) bool {
+		return dir == "/" || rMap[dir].Type == fileref.DIRECTORY && !deleted(dir)
+	}
+
+	sort.SliceStable(lFDiff, func(i, j int) bool { return lFDiff[i].Path < lFDiff[j].Path })
+	moved := make(map[string]bool)
+	for i, f := range lFDiff {
+		if f.Op != Upload {
+			continue
+		}
+		lInfo := lMap[f.Path]
+		key := syncContentKey(lInfo.Hash, lInfo.Size)
+		dstDir, dstName := path.Split(f.Path)
+		dstDir = path.Clean(dstDir)
+		if !dirExists(dstDir) {
+			continue
+		}
+		if srcs := moveSrc[key]; len(srcs) > 0 {
+			src := srcs[0]
+			srcDir, srcName := path.Split(src)
+			srcDir = path.Clean(srcDir)
+			// renamed at the source dir before the move
+			tmp := path.Join(srcDir, dstName)
+			if srcDir == dstDir || srcName == dstName || !taken(tmp) && !used[tmp] {
+				used[tmp] = true
+				moveSrc[key] = srcs[1:]
+				moved[src] = true
+				lFDiff[i] = FileDiff{Op: Move, Path: f.Path, Type: f.Type, Src: src}
+				continue
+			}
+		}
+		if src, ok := copySrc[key]; ok {
+			srcDir, srcName := path.Split(src)
+			srcDir = path.Clean(srcDir)
+			// copied with the source name before the rename
+			tmp := path.Join(dstDir, srcName)
+			if srcDir != dstDir && (srcName == dstName || !taken(tmp) && !used[tmp]) {
+				used[tmp] = true
+				lFDiff[i] = FileDiff{Op: Copy, Path: f.Path, Type: f.Type, Src: src}
+			}
+		}
+	}
+
+	if len(moved) == 0 {
+		return lFDiff
+	}
+	// the moves replace the deletes of the files, the deletes of their dirs
+	// stay and Sync runs them after the moves
+	var newlFDiff []FileDiff
+	for _, f := range lFDiff {
+		if f.Op == Delete && moved[f.Path] {
+			continue
+		}
+		newlFDiff = append(newlFDiff, f)
+	}
+	return newlFDiff
+}
+
+func syncContentKey(hash string, size int64) string {
+	return hash + ":" + strconv.FormatInt(size, 10)
+}
+
+// GetAllocationDiff returns the operations which bring the allocation and the
+// local root in line since the last sync, described by the remote snapshot at
+// lastSyncCachePath. The hashes of the local files are kept in an index next
+// to the snapshot, the files are hashed again only when their size, mtime or
+// inode change.
+//
+// The localFileFilters and the remoteExcludePath are .gitignore style
+// patterns, of names and of paths from the root, see ignoreRules. They're
+// followed by the rules of the SyncIgnoreFile at the local root, and they
+// apply to both the local and the remote files.
 func (a *Allocation) GetAllocationDiff(lastSyncCachePath string, localRootPath string, localFileFilters []string, remoteExcludePath []string) ([]FileDiff, error) {
+	localRootPath = strings.TrimRight(localRootPath, "/")
+	rules, err := newSyncIgnoreRules(localRootPath, localFileFilters, remoteExcludePath)
+	if err != nil {
+		return nil, err
+	}
+	diff, _, err := a.getAllocationDiff(lastSyncCachePath, localRootPath, rules)
+	return diff, err
+}
+
+// getAllocationDiff returns the diff with the remote files it's based on.
+func (a *Allocation) getAllocationDiff(lastSyncCachePath string, localRootPath string, rules *ignoreRules) ([]FileDiff, map[string]fileInfo, error) {
 	var lFdiff []FileDiff
 	prevRemoteFileMap := make(map[string]fileInfo)
 	// 1. Validate localSycnCachePath
@@ -275,44 +433,56 @@ func (a *Allocation) GetAllocationDiff(lastSyncCachePath string, localRootPath s
 		fileInfo, err := os.Stat(lastSyncCachePath)
 		if err == nil {
 			if fileInfo.IsDir() {
-				return lFdiff, errors.Wrap(err, "invalid file cache.")
+				return lFdiff, nil, errors.Wrap(err, "invalid file cache.")
 			}
 			content, err := ioutil.ReadFile(lastSyncCachePath)
 			if err != nil {
-				return lFdiff, errors.New("", "can't read cache file.")
+				return lFdiff, nil, errors.New("", "can't read cache file.")
 			}
 			err = json.Unmarshal(content, &prevRemoteFileMap)
 			if err != nil {
-				return lFdiff, errors.New("", "invalid cache content.")
+				return lFdiff, nil, errors.New("", "invalid cache content.")
 			}
 		}
 	}
 
-	// 2. Build a map for exclude path
-	exclMap := getRemoteExcludeMap(remoteExcludePath)
-
-	// 3. Get flat file list from remote
-	remoteFileMap, err := a.GetRemoteFileMap(exclMap)
+	// 2. Get flat file list from remote
+	remoteFileMap, err := a.getRemoteFileMap(rules)
 	if err != nil {
-		return lFdiff, errors.Wrap(err, "error getting list dir from remote.")
+		return lFdiff, nil, errors.Wrap(err, "error getting list dir from remote.")
 	}
 
-	// 4. Get flat file list on the local filesystem
-	localRootPath = strings.TrimRight(localRootPath, "/")
-	localFileList, err := getLocalFileMap(localRootPath, localFileFilters, exclMap)
+	// 3. Get flat file list on the local filesystem, the hashes of the files
+	// which didn't change since the last diff are taken from the local index
+	var idx *localIndex
+	if len(lastSyncCachePath) > 0 {
+		idx = loadLocalIndex(localIndexPath(lastSyncCachePath))
+	}
+	localFileList, err := getLocalFileMap(localRootPath, rules, idx)
 	if err != nil {
-		return lFdiff, errors.Wrap(err, "error getting list dir from local.")
+		return lFdiff, nil, errors.Wrap(err, "error getting list dir from local.")
+	}
+	if err := idx.save(); err != nil {
+		Logger.Error("Saving the local index failed: ", err)
 	}
 
-	// 5. Get the file diff with operation
+	// 4. Get the file diff with operation
 	lFdiff = findDelta(remoteFileMap, localFileList, prevRemoteFileMap, localRootPath)
 	Logger.Debug("Diff: ", lFdiff)
-	return lFdiff, nil
+	return lFdiff, remoteFileMap, nil
 }
 
 // SaveRemoteSnapShot - Saves the remote current information to the given file
 // This file can be passed to GetAllocationDiff to exactly find the previous sync state to current.
 func (a *Allocation) SaveRemoteSnapshot(pathToSave string, remoteExcludePath []string) error {
+	rules, err := newSyncIgnoreRules("", nil, remoteExcludePath)
+	if err != nil {
+		return err
+	}
+	return a.saveRemoteSnapshot(pathToSave, rules)
+}
+
+func (a *Allocation) saveRemoteSnapshot(pathToSave string, rules *ignoreRules) error {
 	bIsFileExists := false
 	// Validate path
 	fileInfo, err := os.Stat(pathToSave)
@@ -324,8 +494,7 @@ func (a *Allocation) SaveRemoteSnapshot(pathToSave string, remoteExcludePath []s
 	}
 
 	// Get flat file list from remote
-	exclMap := getRemoteExcludeMap(remoteExcludePath)
-	remoteFileList, err := a.GetRemoteFileMap(exclMap)
+	remoteFileList, err := a.getRemoteFileMap(rules)
 	if err != nil {
 		return errors.Wrap(err, "error getting list dir from remote.")
 	}
@@ -0,0 +1,116 @@
+package sdk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindDelta_Moves(t *testing.T) {
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "sync")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	remote := map[string]fileInfo{
+		"/a":          {Type: fileref.DIRECTORY},
+		"/a/big.bin":  {ActualSize: 100, Hash: "h1", Type: fileref.FILE},
+		"/b":          {Type: fileref.DIRECTORY},
+		"/keep.bin":   {ActualSize: 50, Hash: "h2", Type: fileref.FILE},
+		"/old":        {Type: fileref.DIRECTORY},
+		"/old/x.bin":  {ActualSize: 30, Hash: "h3", Type: fileref.FILE},
+		"/old/z.bin":  {ActualSize: 20, Hash: "h4", Type: fileref.FILE},
+		"/old/w.bin":  {ActualSize: 5, Hash: "h8", Type: fileref.FILE},
+		"/empty.bin":  {Hash: "h5", Type: fileref.FILE},
+		"/other.bin":  {ActualSize: 10, Hash: "h6", Type: fileref.FILE},
+		"/b/same.bin": {ActualSize: 10, Hash: "h7", Type: fileref.FILE},
+	}
+	prev := make(map[string]fileInfo)
+	for p, info := range remote {
+		prev[p] = info
+	}
+	local := map[string]fileInfo{
+		"/a":          {Type: fileref.DIRECTORY},
+		"/b":          {Type: fileref.DIRECTORY},
+		"/keep.bin":   {Size: 50, Hash: "h2", Type: fileref.FILE},
+		"/empty.bin":  {Hash: "h5", Type: fileref.FILE},
+		"/other.bin":  {Size: 10, Hash: "h6", Type: fileref.FILE},
+		"/b/same.bin": {Size: 10, Hash: "h7", Type: fileref.FILE},
+		// renamed at the same dir
+		"/a/renamed.bin": {Size: 100, Hash: "h1", Type: fileref.FILE},
+		// duplicated to another dir
+		"/b/keep.bin": {Size: 50, Hash: "h2", Type: fileref.FILE},
+		// moved out of a deleted dir with another name
+		"/b/y.bin": {Size: 30, Hash: "h3", Type: fileref.FILE},
+		// duplicated at the root dir
+		"/keep2.bin": {Size: 50, Hash: "h2", Type: fileref.FILE},
+		// the same hash with another size isn't the same content
+		"/b/z.bin": {Size: 21, Hash: "h4", Type: fileref.FILE},
+		// empty files are uploaded
+		"/b/empty.bin": {Hash: "h5", Type: fileref.FILE},
+		// the rename at the source dir would clash with an existing file
+		"/b/w.bin": {Size: 20, Hash: "h4", Type: fileref.FILE},
+		// duplicated from the same dir can't be copied
+		"/b/other.bin": {Size: 10, Hash: "h7", Type: fileref.FILE},
+	}
+	for p, info := range local {
+		localPath := filepath.Join(dir, filepath.FromSlash(p))
+		if info.Type == fileref.DIRECTORY {
+			require.NoError(os.MkdirAll(localPath, os.ModePerm))
+			continue
+		}
+		require.NoError(os.MkdirAll(filepath.Dir(localPath), os.ModePerm))
+		require.NoError(ioutil.WriteFile(localPath, nil, 0644))
+	}
+
+	diff := findDelta(remote, local, prev, dir)
+	require.EqualValues([]FileDiff{
+		{Op: Move, Path: "/a/renamed.bin", Type: fileref.FILE, Src: "/a/big.bin"},
+		{Op: Upload, Path: "/b/empty.bin", Type: fileref.FILE},
+		{Op: Copy, Path: "/b/keep.bin", Type: fileref.FILE, Src: "/keep.bin"},
+		{Op: Upload, Path: "/b/other.bin", Type: fileref.FILE},
+		{Op: Upload, Path: "/b/w.bin", Type: fileref.FILE},
+		{Op: Move, Path: "/b/y.bin", Type: fileref.FILE, Src: "/old/x.bin"},
+		{Op: Upload, Path: "/b/z.bin", Type: fileref.FILE},
+		{Op: Upload, Path: "/keep2.bin", Type: fileref.FILE},
+		{Op: Delete, Path: "/old", Type: fileref.DIRECTORY},
+	}, diff)
+}
+
+func TestFindDelta_Dirs(t *testing.T) {
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "sync")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	remote := map[string]fileInfo{
+		"/gone":     {Type: fileref.DIRECTORY},
+		"/r":        {Type: fileref.DIRECTORY},
+		"/r2":       {Type: fileref.DIRECTORY},
+		"/r2/1.txt": {ActualSize: 1, Hash: "h1", Type: fileref.FILE},
+	}
+	prev := map[string]fileInfo{
+		"/gone": {Type: fileref.DIRECTORY},
+	}
+	local := map[string]fileInfo{
+		"/l":        {Type: fileref.DIRECTORY},
+		"/l2":       {Type: fileref.DIRECTORY},
+		"/l2/2.txt": {Size: 1, Hash: "h2", Type: fileref.FILE},
+	}
+	require.NoError(os.MkdirAll(filepath.Join(dir, "l"), os.ModePerm))
+	require.NoError(os.MkdirAll(filepath.Join(dir, "l2"), os.ModePerm))
+	require.NoError(ioutil.WriteFile(filepath.Join(dir, "l2", "2.txt"), []byte("2"), 0644))
+
+	diff := findDelta(remote, local, prev, dir)
+	require.EqualValues([]FileDiff{
+		{Op: Delete, Path: "/gone", Type: fileref.DIRECTORY},
+		{Op: CreateDir, Path: "/l", Type: fileref.DIRECTORY},
+		{Op: Upload, Path: "/l2/2.txt", Type: fileref.FILE},
+		{Op: LocalCreateDir, Path: "/r", Type: fileref.DIRECTORY},
+		{Op: Download, Path: "/r2/1.txt", Type: fileref.FILE},
+	}, diff)
+}
@@ -0,0 +1,494 @@
+package sdk
+
+import (
+	"encoding/json"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+// ConflictPolicy tells how Sync resolves a file modified both locally and
+// remotely since the last sync.
+type ConflictPolicy int
+
+const (
+	// ConflictKeepLocal replaces the remote file with the local one.
+	ConflictKeepLocal ConflictPolicy = iota
+	// ConflictKeepRemote replaces the local file with the remote one.
+	ConflictKeepRemote
+	// ConflictKeepBoth keeps the remote file at the path and uploads the
+	// local one as a renamed copy next to it, see conflictCopyPath.
+	ConflictKeepBoth
+)
+
+// SyncOptions are the options of Sync.
+type SyncOptions struct {
+	// CachePath is the snapshot of the remote files saved by the last sync,
+	// the sync starts from scratch if it's empty or doesn't exist. The new
+	// snapshot is saved there once the sync succeeds. The index of the hashes
+	// of the local files is kept next to it.
+	CachePath string
+	// LocalFileFilters and RemoteExcludePath are the patterns of the names
+	// and of the paths which aren't synced, on top of the SyncIgnoreFile at
+	// the local root, see GetAllocationDiff.
+	LocalFileFilters  []string
+	RemoteExcludePath []string
+	// Workers is the number of operations applied in parallel, 1 if not set.
+	Workers int
+	// Conflict is the policy for the files modified on both sides.
+	Conflict ConflictPolicy
+	// Attributes of the uploaded files.
+	Attributes fileref.Attributes
+	// Status gets the callbacks of every file transferred and an Error for
+	// every operation which failed. It may be nil.
+	Status StatusCallback
+}
+
+// SyncResult is the summary of a sync, the paths are relative to the root of
+// the allocation and to the local root.
+type SyncResult struct {
+	Uploaded     []string `json:"uploaded"`
+	Updated      []string `json:"updated"`
+	Downloaded   []string `json:"downloaded"`
+	Deleted      []string `json:"deleted"`
+	LocalDeleted []string `json:"local_deleted"`
+	Moved        []string `json:"moved"`
+	Copied       []string `json:"copied"`
+	// CreatedDirs and LocalCreatedDirs are the empty dirs created remotely
+	// and locally
+	CreatedDirs      []string `json:"created_dirs"`
+	LocalCreatedDirs []string `json:"local_created_dirs"`
+	// Conflicts are the paths modified on both sides, resolved by the policy
+	Conflicts []string `json:"conflicts"`
+	// Failed has the paths which couldn't be synced with the reason
+	Failed map[string]string `json:"failed"`
+	// SnapshotSaved tells whether the snapshot was saved to the CachePath
+	SnapshotSaved bool `json:"snapshot_saved"`
+}
+
+// applied is the number of operations applied by the sync.
+func (r *SyncResult) applied() int {
+	return len(r.Uploaded) + len(r.Updated) + len(r.Downloaded) + len(r.Deleted) +
+		len(r.LocalDeleted) + len(r.Moved) + len(r.Copied) + len(r.CreatedDirs) + len(r.LocalCreatedDirs)
+}
+
+type syncer struct {
+	a         *Allocation
+	localRoot string
+	opts      *SyncOptions
+	result    *SyncResult
+	// remote are the remote files the diff is based on
+	remote map[string]fileInfo
+	// dirAttrs are the attributes of the remote dirs the uploads inherit
+	dirAttrs *dirAttributes
+	mutex    sync.Mutex
+}
+
+// Sync brings the allocation and the local root dir in line. It computes the
+// diff with GetAllocationDiff and applies it with the bounded number of
+// workers, the conflicts are resolved with the policy of the options. The
+// moves and copies are applied first, their sources may be under the dirs
+// deleted by the rest of the diff. The snapshot is saved only when all the
+// operations succeed, so the next sync retries the failed ones instead of
+// taking them for deletions.
+func (a *Allocation) Sync(localRoot string, opts *SyncOptions) (*SyncResult, error) {
+	if !a.isInitialized() {
+		return nil, notInitialized
+	}
+	if opts == nil {
+		opts = &SyncOptions{}
+	}
+	localRoot = strings.TrimRight(localRoot, "/")
+	stat, err := os.Stat(localRoot)
+	if err != nil {
+		return nil, errors.Wrap(err, "Local path error")
+	}
+	if !stat.IsDir() {
+		return nil, errors.New("invalid_path", "Local path is not a directory")
+	}
+
+	rules, err := newSyncIgnoreRules(localRoot, opts.LocalFileFilters, opts.RemoteExcludePath)
+	if err != nil {
+		return nil, err
+	}
+	diff, remote, err := a.getAllocationDiff(opts.CachePath, localRoot, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &syncer{
+		a:         a,
+		localRoot: localRoot,
+		opts:      opts,
+		result: &SyncResult{
+			Uploaded:     []string{},
+			Updated:      []string{},
+			Downloaded:   []string{},
+			Deleted:      []string{},
+			LocalDeleted: []string{},
+			Moved:        []string{},
+			Copied:       []string{},
+			Conflicts:    []string{},
+			Failed:       make(map[string]string),
+
+			CreatedDirs:      []string{},
+			LocalCreatedDirs: []string{},
+		},
+		remote:   remote,
+		dirAttrs: newDirAttributes(),
+	}
+	s.run(diff)
+
+	if len(opts.CachePath) > 0 && len(s.result.Failed) == 0 {
+		if err := a.saveRemoteSnapshot(opts.CachePath, rules); err != nil {
+			return s.result, err
+		}
+		s.result.SnapshotSaved = true
+	}
+	return s.result, nil
+}
+
+func (s *syncer) run(diff []FileDiff) {
+	var moves, rest []FileDiff
+	for _, d := range diff {
+		if d.Op == Move || d.Op == Copy {
+			moves = append(moves, d)
+		} else {
+			rest = append(rest, d)
+		}
+	}
+	s.runPhase(moves)
+	s.runPhase(rest)
+
+	for _, list := range [][]string{s.result.Uploaded, s.result.Updated, s.result.Downloaded,
+		s.result.Deleted, s.result.LocalDeleted, s.result.Moved, s.result.Copied, s.result.Conflicts,
+		s.result.CreatedDirs, s.result.LocalCreatedDirs} {
+		sort.Strings(list)
+	}
+}
+
+func (s *syncer) runPhase(diff []FileDiff) {
+	workers := s.opts.Workers
+	if workers <= 0 {
+		workers = 1
+	}
+	diffCh := make(chan FileDiff)
+	wg := &sync.WaitGroup{}
+	wg.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer wg.Done()
+			for d := range diffCh {
+				if err := s.apply(d); err != nil {
+					Logger.Error("Sync of ", d.Path, " failed: ", err)
+					s.fail(d, err)
+				}
+			}
+		}()
+	}
+	for _, d := range diff {
+		diffCh <- d
+	}
+	close(diffCh)
+	wg.Wait()
+}
+
+func (s *syncer) localPath(remotePath string) string {
+	return filepath.Join(s.localRoot, filepath.FromSlash(remotePath))
+}
+
+func (s *syncer) done(list *[]string, path string) {
+	s.mutex.Lock()
+	*list = append(*list, path)
+	s.mutex.Unlock()
+}
+
+func (s *syncer) fail(d FileDiff, err error) {
+	s.mutex.Lock()
+	s.result.Failed[d.Path] = err.Error()
+	s.mutex.Unlock()
+	if s.opts.Status != nil {
+		s.opts.Status.Error(s.a.ID, d.Path, syncOpCode(d.Op), err)
+	}
+}
+
+func syncOpCode(op string) int {
+	switch op {
+	case Download:
+		return OpDownload
+	case Update:
+		return OpUpdate
+	case Delete, LocalDelete:
+		return OpDelete
+	case LocalCreateDir:
+		return OpDownload
+	default:
+		return OpUpload
+	}
+}
+
+// apply applies an operation of the diff and waits for it to finish.
+func (s *syncer) apply(d FileDiff) error {
+	switch d.Op {
+	case Upload:
+		if err := s.upload(s.localPath(d.Path), d.Path, false); err != nil {
+			return err
+		}
+		s.done(&s.result.Uploaded, d.Path)
+	case Update:
+		if err := s.upload(s.localPath(d.Path), d.Path, true); err != nil {
+			return err
+		}
+		s.done(&s.result.Updated, d.Path)
+	case Download:
+		if err := s.download(d.Path, s.localPath(d.Path)); err != nil {
+			return err
+		}
+		s.done(&s.result.Downloaded, d.Path)
+	case Delete:
+		if err := s.a.DeleteFile(d.Path); err != nil {
+			return err
+		}
+		s.done(&s.result.Deleted, d.Path)
+	case LocalDelete:
+		if err := os.RemoveAll(s.localPath(d.Path)); err != nil {
+			return err
+		}
+		s.done(&s.result.LocalDeleted, d.Path)
+	case Move:
+		if err := s.move(d.Src, d.Path); err != nil {
+			return err
+		}
+		s.done(&s.result.Moved, d.Path)
+	case Copy:
+		if err := s.copy(d.Src, d.Path); err != nil {
+			return err
+		}
+		s.done(&s.result.Copied, d.Path)
+	case CreateDir:
+		if err := s.a.CreateDir(d.Path); err != nil {
+			return err
+		}
+		s.done(&s.result.CreatedDirs, d.Path)
+	case LocalCreateDir:
+		if err := os.MkdirAll(s.localPath(d.Path), os.ModePerm); err != nil {
+			return err
+		}
+		s.done(&s.result.LocalCreatedDirs, d.Path)
+	case Conflict:
+		if err := s.resolveConflict(d); err != nil {
+			return err
+		}
+		s.done(&s.result.Conflicts, d.Path)
+	default:
+		return errors.New("invalid_operation", "Unknown sync operation "+d.Op)
+	}
+	return nil
+}
+
+// move renames the remote file at its dir and moves it to the dir of the
+// destination.
+func (s *syncer) move(src, dst string) error {
+	srcDir, srcName := path.Split(src)
+	dstDir, dstName := path.Split(dst)
+	if srcName != dstName {
+		if err := s.a.RenameObject(src, dstName); err != nil {
+			return err
+		}
+		src = path.Join(srcDir, dstName)
+	}
+	if path.Clean(srcDir) == path.Clean(dstDir) {
+		return nil
+	}
+	return s.a.MoveObject(src, path.Clean(dstDir))
+}
+
+// copy copies the remote file to the dir of the destination and renames the
+// copy there.
+func (s *syncer) copy(src, dst string) error {
+	_, srcName := path.Split(src)
+	dstDir, dstName := path.Split(dst)
+	dstDir = path.Clean(dstDir)
+	if err := s.a.CopyObject(src, dstDir); err != nil {
+		return err
+	}
+	if srcName == dstName {
+		return nil
+	}
+	return s.a.RenameObject(path.Join(dstDir, srcName), dstName)
+}
+
+func (s *syncer) resolveConflict(d FileDiff) error {
+	localPath := s.localPath(d.Path)
+	switch s.opts.Conflict {
+	case ConflictKeepLocal:
+		if err := s.upload(localPath, d.Path, true); err != nil {
+			return err
+		}
+		s.done(&s.result.Updated, d.Path)
+	case ConflictKeepRemote:
+		if err := s.download(d.Path, localPath); err != nil {
+			return err
+		}
+		s.done(&s.result.Downloaded, d.Path)
+	case ConflictKeepBoth:
+		// the remote file is downloaded first, the local one is moved aside
+		// only once the remote one can replace it
+		copyPath := conflictCopyPath(d.Path, func(p string) bool {
+			_, err := os.Stat(s.localPath(p))
+			return err == nil
+		})
+		tmpPath := localPath + ".download"
+		os.Remove(tmpPath)
+		if err := s.downloadTo(d.Path, tmpPath); err != nil {
+			return err
+		}
+		if err := os.Rename(localPath, s.localPath(copyPath)); err != nil {
+			os.Remove(tmpPath)
+			return err
+		}
+		if err := os.Rename(tmpPath, localPath); err != nil {
+			return err
+		}
+		s.done(&s.result.Downloaded, d.Path)
+		// a copy which fails to upload stays local, the next sync uploads it
+		if err := s.upload(s.localPath(copyPath), copyPath, false); err != nil {
+			return err
+		}
+		s.done(&s.result.Uploaded, copyPath)
+	default:
+		return errors.New("invalid_policy", "Unknown conflict policy")
+	}
+	return nil
+}
+
+// conflictCopyPath returns the path of the local copy of a conflicting file,
+// name.conflict.ext or name.conflict-N.ext for the first one which doesn't
+// exist.
+func conflictCopyPath(remotePath string, exists func(string) bool) string {
+	ext := filepath.Ext(remotePath)
+	base := strings.TrimSuffix(remotePath, ext)
+	copyPath := base + ".conflict" + ext
+	for i := 1; exists(copyPath); i++ {
+		copyPath = base + ".conflict-" + strconv.Itoa(i) + ext
+	}
+	return copyPath
+}
+
+// The keys of the custom meta which keep the mtime and the mode of the local
+// file, they're restored on download.
+const (
+	syncMetaModTime = "mtime"
+	syncMetaMode    = "mode"
+)
+
+// syncFileMeta adds the mtime and the mode of the file to the custom meta, a
+// custom meta which isn't a JSON object is replaced.
+func syncFileMeta(customMeta string, info os.FileInfo) string {
+	return mergeCustomMeta(customMeta, map[string]string{
+		syncMetaModTime: info.ModTime().UTC().Format(time.RFC3339Nano),
+		syncMetaMode:    "0" + strconv.FormatUint(uint64(info.Mode().Perm()), 8),
+	})
+}
+
+// keepSyncFileMeta returns the meta replacing the custom meta, with the mtime
+// and the mode of the custom meta unless the meta sets them.
+func keepSyncFileMeta(customMeta string, meta map[string]string) map[string]string {
+	kept := make(map[string]string)
+	if current, err := parseCustomMeta(customMeta); err == nil {
+		for _, key := range []string{syncMetaModTime, syncMetaMode} {
+			if value, ok := current[key]; ok {
+				kept[key] = value
+			}
+		}
+	}
+	for key, value := range meta {
+		kept[key] = value
+	}
+	return kept
+}
+
+// restoreSyncFileMeta sets the mtime and the mode kept in the custom meta to
+// the local file, the missing ones are left as they are.
+func restoreSyncFileMeta(localPath, customMeta string) error {
+	if len(customMeta) == 0 {
+		return nil
+	}
+	meta := make(map[string]string)
+	if err := json.Unmarshal([]byte(customMeta), &meta); err != nil {
+		return nil
+	}
+	if mode, ok := meta[syncMetaMode]; ok {
+		perm, err := strconv.ParseUint(mode, 8, 32)
+		if err != nil {
+			return errors.Wrap(err, "invalid mode "+mode)
+		}
+		if err := os.Chmod(localPath, os.FileMode(perm).Perm()); err != nil {
+			return err
+		}
+	}
+	if modTime, ok := meta[syncMetaModTime]; ok {
+		mtime, err := time.Parse(time.RFC3339Nano, modTime)
+		if err != nil {
+			return errors.Wrap(err, "invalid mtime "+modTime)
+		}
+		if err := os.Chtimes(localPath, mtime, mtime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *syncer) upload(localPath, remotePath string, isUpdate bool) error {
+	info, err := os.Stat(localPath)
+	if err != nil {
+		return err
+	}
+	cb := newWaitStatusCB(s.opts.Status)
+	customMeta := withCustomMeta(syncFileMeta(s.remote[remotePath].CustomMeta, info))
+	if isUpdate {
+		err = s.a.UpdateFile(localPath, remotePath, s.opts.Attributes, cb, customMeta)
+	} else {
+		err = s.a.UploadFile(localPath, remotePath, s.opts.Attributes, cb, customMeta,
+			withDirAttributes(s.dirAttrs))
+	}
+	if err != nil {
+		return err
+	}
+	return cb.wait()
+}
+
+// download replaces the local file with the remote one once it's complete.
+func (s *syncer) download(remotePath, localPath string) error {
+	tmpPath := localPath + ".download"
+	os.Remove(tmpPath)
+	if err := s.downloadTo(remotePath, tmpPath); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, localPath)
+}
+
+// downloadTo downloads the remote file with its mtime and mode.
+func (s *syncer) downloadTo(remotePath, localPath string) error {
+	cb := newWaitStatusCB(s.opts.Status)
+	if err := s.a.DownloadFile(localPath, remotePath, cb); err != nil {
+		return err
+	}
+	if err := cb.wait(); err != nil {
+		os.Remove(localPath)
+		return err
+	}
+	if err := restoreSyncFileMeta(localPath, s.remote[remotePath].CustomMeta); err != nil {
+		Logger.Error("Restoring the meta of ", localPath, " failed: ", err)
+	}
+	return nil
+}
@@ -0,0 +1,141 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocation_Sync(t *testing.T) {
+	require := require.New(t)
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	// the remote root is empty
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.Contains(req.URL.Path, "TestAllocation_Sync") &&
+			strings.Contains(req.URL.Path, zboxutil.LIST_ENDPOINT)
+	})).Return(func(*http.Request) *http.Response {
+		body, err := json.Marshal(&fileref.ListResult{
+			Meta: map[string]interface{}{
+				"type": fileref.DIRECTORY,
+				"path": "/",
+			},
+		})
+		require.NoError(err)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+
+	a := &Allocation{
+		DataShards:   2,
+		ParityShards: 2,
+	}
+	setupMockAllocation(t, a)
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      mockBlobberId + strconv.Itoa(i),
+			Baseurl: "TestAllocation_Sync" + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+
+	dir, err := ioutil.TempDir("", "sync")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	localRoot := filepath.Join(dir, "root")
+	require.NoError(os.MkdirAll(localRoot, os.ModePerm))
+	require.NoError(ioutil.WriteFile(filepath.Join(localRoot, "1.txt"), []byte("synced"), 0644))
+
+	// the file was synced before and got deleted remotely since
+	cachePath := filepath.Join(dir, "cache.json")
+	hash, err := calcFileHash(filepath.Join(localRoot, "1.txt"))
+	require.NoError(err)
+	snapshot, err := json.Marshal(map[string]fileInfo{
+		"/1.txt": {Size: 6, Hash: hash, Type: fileref.FILE},
+	})
+	require.NoError(err)
+	require.NoError(ioutil.WriteFile(cachePath, snapshot, 0644))
+
+	result, err := a.Sync(localRoot, &SyncOptions{CachePath: cachePath, Workers: 2})
+	require.NoError(err)
+	require.Empty(result.Failed)
+	require.EqualValues([]string{"/1.txt"}, result.LocalDeleted)
+	require.True(result.SnapshotSaved)
+	_, err = os.Stat(filepath.Join(localRoot, "1.txt"))
+	require.True(os.IsNotExist(err))
+
+	content, err := ioutil.ReadFile(cachePath)
+	require.NoError(err)
+	require.EqualValues("{}", string(content))
+}
+
+func TestConflictCopyPath(t *testing.T) {
+	existing := map[string]bool{
+		"/d/a.conflict.txt":   true,
+		"/d/a.conflict-1.txt": true,
+	}
+	exists := func(p string) bool { return existing[p] }
+	require.EqualValues(t, "/d/b.conflict.txt", conflictCopyPath("/d/b.txt", exists))
+	require.EqualValues(t, "/d/a.conflict-2.txt", conflictCopyPath("/d/a.txt", exists))
+	require.EqualValues(t, "/d/c.conflict", conflictCopyPath("/d/c", exists))
+}
+
+func TestSyncFileMeta(t *testing.T) {
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "sync")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	src := filepath.Join(dir, "src")
+	require.NoError(ioutil.WriteFile(src, []byte("src"), 0600))
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 6000, time.UTC)
+	require.NoError(os.Chtimes(src, mtime, mtime))
+	info, err := os.Stat(src)
+	require.NoError(err)
+
+	// the other keys of the custom meta are kept
+	customMeta := syncFileMeta(`{"tag":"x"}`, info)
+	meta := make(map[string]string)
+	require.NoError(json.Unmarshal([]byte(customMeta), &meta))
+	require.EqualValues(map[string]string{
+		"tag":           "x",
+		syncMetaModTime: "2020-01-02T03:04:05.000006Z",
+		syncMetaMode:    "0600",
+	}, meta)
+
+	dst := filepath.Join(dir, "dst")
+	require.NoError(ioutil.WriteFile(dst, []byte("src"), 0644))
+	require.NoError(restoreSyncFileMeta(dst, customMeta))
+	dstInfo, err := os.Stat(dst)
+	require.NoError(err)
+	require.True(mtime.Equal(dstInfo.ModTime()))
+	require.EqualValues(os.FileMode(0600), dstInfo.Mode().Perm())
+
+	// a custom meta without the sync keys changes nothing
+	require.NoError(restoreSyncFileMeta(dst, `{"tag":"x"}`))
+	require.NoError(restoreSyncFileMeta(dst, "not json"))
+}
@@ -0,0 +1,165 @@
+package sdk
+
+import (
+	"bufio"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/0chain/errors"
+)
+
+// SyncIgnoreFile is the file at the root of a synced dir with the ignore rules
+// of the sync, in the .gitignore format.
+const SyncIgnoreFile = ".zcnignore"
+
+type ignoreRule struct {
+	segments []string
+	negate   bool
+	dirOnly  bool
+}
+
+// ignoreRules are .gitignore style rules matched against the paths relative to
+// the sync root. A pattern matches the name at any level unless it has a
+// slash before its end, then it's relative to the root. "**" matches any
+// number of dirs, a trailing slash matches only dirs and a leading "!"
+// includes again what a previous rule excluded. The last matching rule wins,
+// and the content of an ignored dir is ignored with it.
+type ignoreRules struct {
+	rules []ignoreRule
+}
+
+// addPattern adds a rule in the .gitignore format, the blank lines and the
+// comments are skipped.
+func (r *ignoreRules) addPattern(pattern string) error {
+	pattern = strings.TrimRight(pattern, " \t\r")
+	if len(pattern) == 0 || strings.HasPrefix(pattern, "#") {
+		return nil
+	}
+	rule := ignoreRule{}
+	if strings.HasPrefix(pattern, "!") {
+		rule.negate = true
+		pattern = pattern[1:]
+	} else if strings.HasPrefix(pattern, `\`) {
+		// escapes a leading "!" or "#"
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		rule.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	if len(pattern) == 0 {
+		return nil
+	}
+	if !strings.Contains(pattern, "/") {
+		pattern = "**/" + pattern
+	}
+	for _, segment := range strings.Split(strings.TrimLeft(pattern, "/"), "/") {
+		if len(segment) == 0 {
+			continue
+		}
+		if _, err := path.Match(segment, ""); err != nil {
+			return errors.New("invalid_pattern", "Invalid ignore pattern "+pattern)
+		}
+		rule.segments = append(rule.segments, segment)
+	}
+	r.rules = append(r.rules, rule)
+	return nil
+}
+
+// loadIgnoreFile adds the rules of an ignore file, a missing file has none.
+func (r *ignoreRules) loadIgnoreFile(filePath string) error {
+	f, err := os.Open(filePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrap(err, "can't read ignore file.")
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if err := r.addPattern(scanner.Text()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// newSyncIgnoreRules builds the rules of a sync. The local file filters are
+// the patterns of the names to ignore, the remote exclude paths the patterns
+// of the paths from the root, they're followed by the rules of the ignore
+// file at the local root.
+func newSyncIgnoreRules(localRootPath string, localFileFilters []string, remoteExcludePath []string) (*ignoreRules, error) {
+	r := &ignoreRules{}
+	for _, filter := range localFileFilters {
+		if err := r.addPattern(filter); err != nil {
+			return nil, err
+		}
+	}
+	for _, exclPath := range remoteExcludePath {
+		if !strings.HasPrefix(exclPath, "/") {
+			exclPath = "/" + exclPath
+		}
+		if err := r.addPattern(exclPath); err != nil {
+			return nil, err
+		}
+	}
+	if len(localRootPath) > 0 {
+		if err := r.loadIgnoreFile(filepath.Join(localRootPath, SyncIgnoreFile)); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// isIgnored tells whether the path relative to the sync root is ignored. The
+// parent dirs of the path are expected to be checked already, like by a walk
+// which skips the ignored dirs.
+func (r *ignoreRules) isIgnored(relPath string, isDir bool) bool {
+	if r == nil {
+		return false
+	}
+	relPath = strings.Trim(relPath, "/")
+	if len(relPath) == 0 || relPath == "." {
+		return false
+	}
+	segments := strings.Split(relPath, "/")
+	ignored := false
+	for _, rule := range r.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if ignored == rule.negate && matchSegments(rule.segments, segments) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// matchSegments matches the path segments with the pattern segments, "**"
+// matches any number of them but a trailing "**" at least one.
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return len(segments) > 0
+		}
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	if ok, _ := path.Match(pattern[0], segments[0]); !ok {
+		return false
+	}
+	return matchSegments(pattern[1:], segments[1:])
+}
@@ -0,0 +1,78 @@
+package sdk
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIgnoreRules_isIgnored(t *testing.T) {
+	tests := []struct {
+		name     string
+		patterns []string
+		path     string
+		isDir    bool
+		want     bool
+	}{
+		{name: "Test_Name_At_Any_Level", patterns: []string{"*.tmp"}, path: "/a/b/c.tmp", want: true},
+		{name: "Test_Name_Not_Matched", patterns: []string{"*.tmp"}, path: "/a/b/c.txt"},
+		{name: "Test_Anchored", patterns: []string{"/build"}, path: "/build", isDir: true, want: true},
+		{name: "Test_Anchored_Not_Nested", patterns: []string{"/build"}, path: "/a/build", isDir: true},
+		{name: "Test_Middle_Slash_Anchored", patterns: []string{"a/*.log"}, path: "/b/a/1.log"},
+		{name: "Test_Double_Star_Prefix", patterns: []string{"**/logs/*.log"}, path: "/x/y/logs/1.log", want: true},
+		{name: "Test_Double_Star_Middle", patterns: []string{"a/**/b"}, path: "/a/b", want: true},
+		{name: "Test_Double_Star_Middle_Nested", patterns: []string{"a/**/b"}, path: "/a/x/y/b", want: true},
+		{name: "Test_Double_Star_Suffix", patterns: []string{"a/**"}, path: "/a/x/y", want: true},
+		{name: "Test_Double_Star_Suffix_Not_Dir", patterns: []string{"a/**"}, path: "/a", isDir: true},
+		{name: "Test_Dir_Only_File", patterns: []string{"cache/"}, path: "/x/cache"},
+		{name: "Test_Dir_Only_Dir", patterns: []string{"cache/"}, path: "/x/cache", isDir: true, want: true},
+		{name: "Test_Negation", patterns: []string{"*.log", "!keep.log"}, path: "/keep.log"},
+		{name: "Test_Negation_Order", patterns: []string{"!keep.log", "*.log"}, path: "/keep.log", want: true},
+		{name: "Test_Comment_And_Blank", patterns: []string{"# *.txt", "", "   "}, path: "/1.txt"},
+		{name: "Test_Escaped", patterns: []string{`\#1.txt`}, path: "/#1.txt", want: true},
+		{name: "Test_Root_Never", patterns: []string{"*"}, path: "/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &ignoreRules{}
+			for _, pattern := range tt.patterns {
+				require.NoError(t, r.addPattern(pattern))
+			}
+			require.EqualValues(t, tt.want, r.isIgnored(tt.path, tt.isDir))
+		})
+	}
+}
+
+func TestGetLocalFileMap_IgnoreFile(t *testing.T) {
+	require := require.New(t)
+	dir, err := ioutil.TempDir("", "syncignore")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	for _, p := range []string{"1.txt", "2.log", "keep.log", "tmp/3.txt", "a/4.txt"} {
+		localPath := filepath.Join(dir, filepath.FromSlash(p))
+		require.NoError(os.MkdirAll(filepath.Dir(localPath), os.ModePerm))
+		require.NoError(ioutil.WriteFile(localPath, []byte(p), 0644))
+	}
+	require.NoError(ioutil.WriteFile(filepath.Join(dir, SyncIgnoreFile), []byte("*.log\n!keep.log\ntmp/\n"), 0644))
+
+	rules, err := newSyncIgnoreRules(dir, []string{"4.txt"}, []string{"/" + SyncIgnoreFile})
+	require.NoError(err)
+	localMap, err := getLocalFileMap(dir, rules, nil)
+	require.NoError(err)
+	var files []string
+	for p, info := range localMap {
+		if info.Type == fileref.FILE {
+			files = append(files, p)
+		}
+	}
+	require.ElementsMatch([]string{"/1.txt", "/keep.log"}, files)
+	_, ok := localMap["/tmp"]
+	require.False(ok)
+
+	_, err = newSyncIgnoreRules(dir, []string{"[a"}, nil)
+	require.Error(err)
+}
@@ -0,0 +1,324 @@
+package sdk
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/0chain/errors"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+)
+
+const (
+	defaultSyncLocalInterval  = 2 * time.Second
+	defaultSyncRemoteInterval = 30 * time.Second
+	defaultSyncDebounce       = 2 * time.Second
+	defaultSyncMaxBackoff     = 5 * time.Minute
+)
+
+// SyncWatcherOptions are the options of a SyncWatcher.
+type SyncWatcherOptions struct {
+	// Sync are the options of every sync, CachePath is required to tell the
+	// changes since the last sync.
+	Sync SyncOptions
+	// LocalInterval is the interval of the local tree polls, 2s if not set.
+	LocalInterval time.Duration
+	// RemoteInterval is the interval of the allocation root polls, 30s if not
+	// set.
+	RemoteInterval time.Duration
+	// Debounce is the quiet time after a change before the sync starts, the
+	// changes in the meantime are synced together. 2s if not set.
+	Debounce time.Duration
+	// MaxBackoff caps the wait before a failed sync runs again, the wait
+	// starts at Debounce and doubles with every failed sync in a row. 5m if
+	// not set.
+	MaxBackoff time.Duration
+	// OnSync is called after every sync, it may be nil.
+	OnSync func(result *SyncResult, err error)
+}
+
+// SyncWatcherStatus is the state of a SyncWatcher.
+type SyncWatcherStatus struct {
+	Running  bool      `json:"running"`
+	Syncing  bool      `json:"syncing"`
+	Syncs    int       `json:"syncs"`
+	LastSync time.Time `json:"last_sync"`
+	// Failures is the count of the failed syncs in a row
+	Failures int `json:"failures"`
+	// LastResult and LastError are the outcome of the last sync
+	LastResult *SyncResult `json:"last_result,omitempty"`
+	LastError  string      `json:"last_error,omitempty"`
+}
+
+// SyncWatcher keeps a local dir and the allocation in sync. It polls the
+// local tree for changes of the size, mtime or mode of the files and the
+// allocation roots of the blobbers for the remote changes, and runs Sync once
+// the changes settle. A failed sync runs again after a backoff, or sooner
+// on a new change.
+type SyncWatcher struct {
+	a         *Allocation
+	localRoot string
+	opts      SyncWatcherOptions
+
+	localPrint  string
+	remotePrint string
+
+	status SyncWatcherStatus
+	stop   chan struct{}
+	done   chan struct{}
+	mutex  sync.Mutex
+}
+
+// NewSyncWatcher returns a watcher of the local root, it's started by Start.
+func (a *Allocation) NewSyncWatcher(localRoot string, opts *SyncWatcherOptions) (*SyncWatcher, error) {
+	if !a.isInitialized() {
+		return nil, notInitialized
+	}
+	if opts == nil || len(opts.Sync.CachePath) == 0 {
+		return nil, errors.New("invalid_options", "Sync cache path is required")
+	}
+	localRoot = strings.TrimRight(localRoot, "/")
+	if _, err := newSyncIgnoreRules(localRoot, opts.Sync.LocalFileFilters, opts.Sync.RemoteExcludePath); err != nil {
+		return nil, err
+	}
+	w := &SyncWatcher{
+		a:         a,
+		localRoot: localRoot,
+		opts:      *opts,
+	}
+	if w.opts.LocalInterval <= 0 {
+		w.opts.LocalInterval = defaultSyncLocalInterval
+	}
+	if w.opts.RemoteInterval <= 0 {
+		w.opts.RemoteInterval = defaultSyncRemoteInterval
+	}
+	if w.opts.Debounce <= 0 {
+		w.opts.Debounce = defaultSyncDebounce
+	}
+	if w.opts.MaxBackoff <= 0 {
+		w.opts.MaxBackoff = defaultSyncMaxBackoff
+	}
+	return w, nil
+}
+
+// Start starts watching, the first sync runs right away.
+func (w *SyncWatcher) Start() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.status.Running {
+		return errors.New("sync_watcher_running", "Sync watcher is running already")
+	}
+	w.status.Running = true
+	w.stop = make(chan struct{})
+	w.done = make(chan struct{})
+	go w.run(w.stop, w.done)
+	return nil
+}
+
+// Stop stops watching, it waits for the sync in progress to finish.
+func (w *SyncWatcher) Stop() {
+	w.mutex.Lock()
+	if !w.status.Running {
+		w.mutex.Unlock()
+		return
+	}
+	close(w.stop)
+	done := w.done
+	w.mutex.Unlock()
+	<-done
+
+	w.mutex.Lock()
+	w.status.Running = false
+	w.mutex.Unlock()
+}
+
+// Status returns the state of the watcher.
+func (w *SyncWatcher) Status() SyncWatcherStatus {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.status
+}
+
+func (w *SyncWatcher) run(stop, done chan struct{}) {
+	defer close(done)
+	localTicker := time.NewTicker(w.opts.LocalInterval)
+	defer localTicker.Stop()
+	remoteTicker := time.NewTicker(w.opts.RemoteInterval)
+	defer remoteTicker.Stop()
+
+	var debounce *time.Timer
+	var debounceC <-chan time.Time
+	schedule := func(delay time.Duration) {
+		if debounce != nil {
+			debounce.Stop()
+		}
+		debounce = time.NewTimer(delay)
+		debounceC = debounce.C
+	}
+	schedule(0)
+
+	for {
+		select {
+		case <-stop:
+			if debounce != nil {
+				debounce.Stop()
+			}
+			return
+		case <-localTicker.C:
+			if w.localChanged() {
+				schedule(w.opts.Debounce)
+			}
+		case <-remoteTicker.C:
+			if w.remoteChanged() {
+				schedule(w.opts.Debounce)
+			}
+		case <-debounceC:
+			debounceC = nil
+			applied, failures := w.sync()
+			if failures > 0 {
+				schedule(w.backoff(failures))
+			} else if applied {
+				// a sync which changed something runs again, for the
+				// changes made while it was running
+				schedule(w.opts.Debounce)
+			}
+		}
+	}
+}
+
+// sync runs a sync and takes the state before it as the new base, so the
+// changes made while it runs are seen by the next polls. It tells whether the
+// sync applied any operation and the count of the failed syncs in a row, a
+// sync failing any operation is a failed one. The base is kept on a failure,
+// the sync runs again after the backoff and not on every poll.
+func (w *SyncWatcher) sync() (bool, int) {
+	w.mutex.Lock()
+	w.status.Syncing = true
+	w.mutex.Unlock()
+
+	localPrint, localErr := w.localFingerprint()
+	remotePrint := w.remoteFingerprint()
+	syncOpts := w.opts.Sync
+	result, err := w.a.Sync(w.localRoot, &syncOpts)
+	if err != nil {
+		Logger.Error("Sync of ", w.localRoot, " failed: ", err)
+	}
+	if localErr == nil {
+		w.localPrint = localPrint
+	}
+	if len(remotePrint) > 0 {
+		w.remotePrint = remotePrint
+	}
+
+	w.mutex.Lock()
+	w.status.Syncing = false
+	w.status.Syncs++
+	w.status.LastSync = time.Now()
+	w.status.LastResult = result
+	w.status.LastError = ""
+	if err != nil {
+		w.status.LastError = err.Error()
+	}
+	if err != nil || len(result.Failed) > 0 {
+		w.status.Failures++
+	} else {
+		w.status.Failures = 0
+	}
+	failures := w.status.Failures
+	w.mutex.Unlock()
+	if w.opts.OnSync != nil {
+		w.opts.OnSync(result, err)
+	}
+	return result != nil && result.applied() > 0, failures
+}
+
+// backoff is the wait before the sync after the failures in a row, Debounce
+// doubled for every failure but the first, up to MaxBackoff.
+func (w *SyncWatcher) backoff(failures int) time.Duration {
+	wait := w.opts.Debounce
+	for i := 1; i < failures && wait < w.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > w.opts.MaxBackoff {
+		wait = w.opts.MaxBackoff
+	}
+	return wait
+}
+
+func (w *SyncWatcher) localChanged() bool {
+	fp, err := w.localFingerprint()
+	if err != nil {
+		Logger.Error("Local poll of ", w.localRoot, " failed: ", err)
+		return false
+	}
+	if fp == w.localPrint {
+		return false
+	}
+	w.localPrint = fp
+	return true
+}
+
+// remoteChanged compares the allocation roots of the blobbers with the last
+// ones, a poll without any response doesn't tell a change.
+func (w *SyncWatcher) remoteChanged() bool {
+	fp := w.remoteFingerprint()
+	if len(fp) == 0 || fp == w.remotePrint {
+		return false
+	}
+	w.remotePrint = fp
+	return true
+}
+
+// localFingerprint is a hash of the paths, sizes, mtimes and modes of the
+// files of the local tree which aren't ignored. The rules are read again, the
+// ignore file may change.
+func (w *SyncWatcher) localFingerprint() (string, error) {
+	rules, err := newSyncIgnoreRules(w.localRoot, w.opts.Sync.LocalFileFilters, w.opts.Sync.RemoteExcludePath)
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	err = filepath.Walk(w.localRoot, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		lPath, err := filepath.Rel(w.localRoot, path)
+		if err != nil {
+			return nil
+		}
+		lPath = "/" + filepath.ToSlash(lPath)
+		if rules.isIgnored(lPath, info.IsDir()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// the mtime of a dir changes with its entries, which are seen anyway
+		if info.IsDir() {
+			fmt.Fprintf(h, "%s %v\n", lPath, info.Mode())
+			return nil
+		}
+		fmt.Fprintf(h, "%s %d %d %v\n", lPath, info.Size(), info.ModTime().UnixNano(), info.Mode())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// remoteFingerprint is the allocation roots of the blobbers which responded.
+func (w *SyncWatcher) remoteFingerprint() string {
+	var roots []string
+	for url, stats := range w.a.GetBlobberStats() {
+		roots = append(roots, url+":"+stats.AllocationRoot)
+	}
+	sort.Strings(roots)
+	return strings.Join(roots, ",")
+}
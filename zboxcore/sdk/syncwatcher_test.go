@@ -0,0 +1,245 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSyncWatcher(t *testing.T) {
+	require := require.New(t)
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	// the remote root has the dirs created by the watcher, its allocation root
+	// changes with the counter
+	var remoteVersion, dirCreated int64
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.Contains(req.URL.Path, "TestSyncWatcher") &&
+			strings.Contains(req.URL.Path, zboxutil.DIR_ENDPOINT)
+	})).Return(func(*http.Request) *http.Response {
+		atomic.StoreInt64(&dirCreated, 1)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+		}
+	}, nil)
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.Contains(req.URL.Path, "TestSyncWatcher") &&
+			strings.Contains(req.URL.Path, zboxutil.LIST_ENDPOINT)
+	})).Return(func(req *http.Request) *http.Response {
+		result := &fileref.ListResult{
+			Meta: map[string]interface{}{
+				"type": fileref.DIRECTORY,
+				"path": "/",
+			},
+		}
+		isRoot := req.URL.Query().Get("path_hash") == fileref.GetReferenceLookup("", "/")
+		if isRoot && atomic.LoadInt64(&dirCreated) == 1 {
+			result.Entities = []map[string]interface{}{{
+				"type": fileref.DIRECTORY,
+				"path": "/d",
+				"name": "d",
+			}}
+		}
+		body, err := json.Marshal(result)
+		require.NoError(err)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.Contains(req.URL.Path, "TestSyncWatcher") &&
+			strings.HasSuffix(req.URL.Path, zboxutil.ALLOCATION_ENDPOINT)
+	})).Return(func(*http.Request) *http.Response {
+		body, err := json.Marshal(&BlobberAllocationStats{
+			AllocationRoot: strconv.FormatInt(atomic.LoadInt64(&remoteVersion), 10),
+		})
+		require.NoError(err)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+
+	a := &Allocation{
+		DataShards:   2,
+		ParityShards: 2,
+	}
+	setupMockAllocation(t, a)
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      mockBlobberId + strconv.Itoa(i),
+			Baseurl: "TestSyncWatcher" + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+
+	dir, err := ioutil.TempDir("", "syncwatcher")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+	localRoot := filepath.Join(dir, "root")
+	require.NoError(os.MkdirAll(localRoot, os.ModePerm))
+	require.NoError(ioutil.WriteFile(filepath.Join(localRoot, SyncIgnoreFile), []byte("*.tmp\n/"+SyncIgnoreFile+"\n"), 0644))
+
+	_, err = a.NewSyncWatcher(localRoot, &SyncWatcherOptions{})
+	require.Error(err)
+
+	syncs := make(chan *SyncResult, 10)
+	w, err := a.NewSyncWatcher(localRoot, &SyncWatcherOptions{
+		Sync:           SyncOptions{CachePath: filepath.Join(dir, "cache.json")},
+		LocalInterval:  10 * time.Millisecond,
+		RemoteInterval: 10 * time.Millisecond,
+		Debounce:       10 * time.Millisecond,
+		OnSync: func(result *SyncResult, err error) {
+			require.NoError(err)
+			syncs <- result
+		},
+	})
+	require.NoError(err)
+
+	waitSync := func() {
+		select {
+		case <-syncs:
+		case <-time.After(5 * time.Second):
+			require.Fail("sync not started")
+		}
+	}
+
+	require.NoError(w.Start())
+	defer w.Stop()
+	require.Error(w.Start())
+	// the first sync runs right away
+	waitSync()
+	require.True(w.Status().Running)
+	require.True(w.Status().LastResult.SnapshotSaved)
+
+	// a local change, the sync which created the dir runs again
+	require.NoError(os.Mkdir(filepath.Join(localRoot, "d"), os.ModePerm))
+	waitSync()
+	require.EqualValues([]string{"/d"}, w.Status().LastResult.CreatedDirs)
+	waitSync()
+	require.Empty(w.Status().LastResult.CreatedDirs)
+
+	// the ignored files aren't watched
+	require.NoError(ioutil.WriteFile(filepath.Join(localRoot, "1.tmp"), []byte("ignored"), 0644))
+	select {
+	case <-syncs:
+		require.Fail("ignored file synced")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// a remote change
+	atomic.AddInt64(&remoteVersion, 1)
+	waitSync()
+
+	w.Stop()
+	status := w.Status()
+	require.False(status.Running)
+	require.EqualValues(4, status.Syncs)
+	require.Empty(status.LastError)
+}
+
+func TestSyncWatcher_Backoff(t *testing.T) {
+	require := require.New(t)
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.Contains(req.URL.Path, "TestSyncWatcher_Backoff") &&
+			strings.HasSuffix(req.URL.Path, zboxutil.ALLOCATION_ENDPOINT)
+	})).Return(func(*http.Request) *http.Response {
+		body, err := json.Marshal(&BlobberAllocationStats{AllocationRoot: "root"})
+		require.NoError(err)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+
+	a := &Allocation{
+		DataShards:   2,
+		ParityShards: 2,
+	}
+	setupMockAllocation(t, a)
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      mockBlobberId + strconv.Itoa(i),
+			Baseurl: "TestSyncWatcher_Backoff" + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+
+	dir, err := ioutil.TempDir("", "syncwatcher")
+	require.NoError(err)
+	defer os.RemoveAll(dir)
+
+	// the local root is missing, every sync fails
+	syncs := make(chan time.Time, 10)
+	w, err := a.NewSyncWatcher(filepath.Join(dir, "root"), &SyncWatcherOptions{
+		Sync:           SyncOptions{CachePath: filepath.Join(dir, "cache.json")},
+		LocalInterval:  5 * time.Millisecond,
+		RemoteInterval: 5 * time.Millisecond,
+		Debounce:       20 * time.Millisecond,
+		MaxBackoff:     80 * time.Millisecond,
+		OnSync: func(result *SyncResult, err error) {
+			require.Error(err)
+			syncs <- time.Now()
+		},
+	})
+	require.NoError(err)
+
+	waitSync := func() time.Time {
+		select {
+		case at := <-syncs:
+			return at
+		case <-time.After(5 * time.Second):
+			require.Fail("sync not started")
+		}
+		return time.Time{}
+	}
+
+	require.NoError(w.Start())
+	defer w.Stop()
+	last := waitSync()
+	// the polls don't run the failed sync again, the backoff doubles up to
+	// MaxBackoff
+	for _, wait := range []time.Duration{20, 40, 80, 80} {
+		at := waitSync()
+		require.True(at.Sub(last) >= wait*time.Millisecond, "sync after %v, want %v", at.Sub(last), wait*time.Millisecond)
+		last = at
+	}
+
+	w.Stop()
+	status := w.Status()
+	require.Equal(status.Syncs, status.Failures)
+	require.NotEmpty(status.LastError)
+}
@@ -0,0 +1,410 @@
+package sdk
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"hash"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	. "github.com/0chain/gosdk/zboxcore/logger"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+var uploadJournalDir string
+
+// SetUploadJournalDir enables resumable uploads. Every file upload keeps its
+// progress journal in the dir till it's committed, so an interrupted upload
+// can be continued by ResumeUpload. The shards of a journaled upload are
+// sent in parts with their upload offsets, the blobbers must keep the parts
+// of the connection. An empty dir disables the journals.
+func SetUploadJournalDir(dir string) error {
+	if len(dir) > 0 {
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			return errors.Wrap(err, "can't create upload journal dir")
+		}
+	}
+	uploadJournalDir = dir
+	return nil
+}
+
+// BlobberUploadProgress is the upload state of one blobber in a journal. A
+// blobber which didn't get all its shard continues after the BytesSent, the
+// HashState is the state of its content hash then. The shard is hashed again
+// up to there on resume, the merkle leaves can't be saved, and checked
+// against the state.
+type BlobberUploadProgress struct {
+	BytesSent     int64  `json:"bytes_sent,omitempty"`
+	HashState     []byte `json:"hash_state,omitempty"`
+	Uploaded      bool   `json:"uploaded"`
+	ShardSize     int64  `json:"shard_size,omitempty"`
+	ContentHash   string `json:"content_hash,omitempty"`
+	MerkleRoot    string `json:"merkle_root,omitempty"`
+	ThumbnailSize int64  `json:"thumbnail_size,omitempty"`
+	ThumbnailHash string `json:"thumbnail_hash,omitempty"`
+}
+
+// UploadJournal is the on-disk progress record of a file upload.
+type UploadJournal struct {
+	AllocationID        string                            `json:"allocation_id"`
+	ConnectionID        string                            `json:"connection_id"`
+	LocalPath           string                            `json:"local_path"`
+	RemotePath          string                            `json:"remote_path"`
+	ThumbnailPath       string                            `json:"thumbnail_path,omitempty"`
+	IsUpdate            bool                              `json:"is_update"`
+	Attributes          fileref.Attributes                `json:"attributes"`
+	CustomMeta          string                            `json:"custom_meta,omitempty"`
+	Size                int64                             `json:"size"`
+	ModTime             int64                             `json:"mod_time"`
+	ActualHash          string                            `json:"actual_hash,omitempty"`
+	ActualThumbnailSize int64                             `json:"actual_thumbnail_size,omitempty"`
+	ActualThumbnailHash string                            `json:"actual_thumbnail_hash,omitempty"`
+	Blobbers            map[string]*BlobberUploadProgress `json:"blobbers"`
+
+	path  string
+	mutex sync.Mutex
+}
+
+func uploadJournalPath(allocationID, remotepath string) string {
+	return filepath.Join(uploadJournalDir,
+		fileref.GetReferenceLookup(allocationID, remotepath)+".json")
+}
+
+func newUploadJournal(allocationID string, req *UploadRequest,
+	fileInfo os.FileInfo) *UploadJournal {
+
+	return &UploadJournal{
+		AllocationID:  allocationID,
+		ConnectionID:  req.connectionID,
+		LocalPath:     req.filepath,
+		RemotePath:    req.remotefilepath,
+		ThumbnailPath: req.thumbnailpath,
+		IsUpdate:      req.isUpdate,
+		Attributes:    req.filemeta.Attributes,
+		CustomMeta:    req.filemeta.CustomMeta,
+		Size:          fileInfo.Size(),
+		ModTime:       fileInfo.ModTime().UnixNano(),
+		Blobbers:      make(map[string]*BlobberUploadProgress),
+		path:          uploadJournalPath(allocationID, req.remotefilepath),
+	}
+}
+
+func loadUploadJournal(path string) (*UploadJournal, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	j := &UploadJournal{}
+	if err = json.Unmarshal(content, j); err != nil {
+		return nil, errors.Wrap(err, "invalid upload journal")
+	}
+	if j.Blobbers == nil {
+		j.Blobbers = make(map[string]*BlobberUploadProgress)
+	}
+	j.path = path
+	return j, nil
+}
+
+// matches reports whether the local file is still the one being uploaded.
+func (j *UploadJournal) matches(fileInfo os.FileInfo) bool {
+	return fileInfo.Size() == j.Size && fileInfo.ModTime().UnixNano() == j.ModTime
+}
+
+func (j *UploadJournal) save() {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	content, err := json.Marshal(j)
+	if err != nil {
+		Logger.Error("Upload journal marshal error: ", err)
+		return
+	}
+	// write and rename, a crash must not leave a truncated journal behind
+	tmpPath := j.path + ".tmp"
+	if err = ioutil.WriteFile(tmpPath, content, 0600); err != nil {
+		Logger.Error("Upload journal write error: ", err)
+		return
+	}
+	if err = os.Rename(tmpPath, j.path); err != nil {
+		Logger.Error("Upload journal write error: ", err)
+	}
+}
+
+func (j *UploadJournal) remove() {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	os.Remove(j.path)
+}
+
+func (j *UploadJournal) progress(blobberID string) *BlobberUploadProgress {
+	p, ok := j.Blobbers[blobberID]
+	if !ok {
+		p = &BlobberUploadProgress{}
+		j.Blobbers[blobberID] = p
+	}
+	return p
+}
+
+// bytesSent returns the bytes of the shard the blobber holds and the state of
+// the content hash then.
+func (j *UploadJournal) bytesSent(blobberID string) (int64, []byte) {
+	if j == nil {
+		return 0, nil
+	}
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	p, ok := j.Blobbers[blobberID]
+	if !ok || p.Uploaded {
+		return 0, nil
+	}
+	return p.BytesSent, p.HashState
+}
+
+func (j *UploadJournal) setBytesSent(blobberID string, sent int64, state []byte) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	p := j.progress(blobberID)
+	p.BytesSent = sent
+	p.HashState = state
+	j.mutex.Unlock()
+	j.save()
+}
+
+// restart drops the progress of a blobber which lost the upload, it gets its
+// shard from the beginning.
+func (j *UploadJournal) restart(blobberID string) {
+	j.mutex.Lock()
+	defer j.mutex.Unlock()
+	delete(j.Blobbers, blobberID)
+}
+
+func (j *UploadJournal) setUploaded(blobberID string, file *fileref.FileRef) {
+	if j == nil {
+		return
+	}
+	j.mutex.Lock()
+	p := j.progress(blobberID)
+	p.Uploaded = true
+	p.ShardSize = file.Size
+	p.ContentHash = file.ContentHash
+	p.MerkleRoot = file.MerkleRoot
+	p.ThumbnailSize = file.ThumbnailSize
+	p.ThumbnailHash = file.ThumbnailHash
+	j.ActualHash = file.ActualFileHash
+	j.ActualThumbnailSize = file.ActualThumbnailSize
+	j.ActualThumbnailHash = file.ActualThumbnailHash
+	j.mutex.Unlock()
+	j.save()
+}
+
+// fileRef rebuilds the file reference a blobber got in the journaled
+// connection, it's used to commit the blobber without uploading again.
+func (j *UploadJournal) fileRef(blobberID string) *fileref.FileRef {
+	p := j.Blobbers[blobberID]
+	file := &fileref.FileRef{}
+	_, file.Name = filepath.Split(j.RemotePath)
+	file.Path = j.RemotePath
+	file.Type = fileref.FILE
+	file.AllocationID = j.AllocationID
+	file.Attributes = j.Attributes
+	file.CustomMeta = j.CustomMeta
+	file.Size = p.ShardSize
+	file.ContentHash = p.ContentHash
+	file.MerkleRoot = p.MerkleRoot
+	file.ThumbnailSize = p.ThumbnailSize
+	file.ThumbnailHash = p.ThumbnailHash
+	file.ActualFileHash = j.ActualHash
+	file.ActualFileSize = j.Size
+	file.ActualThumbnailSize = j.ActualThumbnailSize
+	file.ActualThumbnailHash = j.ActualThumbnailHash
+	file.CalculateHash()
+	return file
+}
+
+type connectionChange struct {
+	Operation string `json:"operation"`
+	Input     string `json:"input"`
+}
+
+type connectionDetails struct {
+	ConnectionID string              `json:"connection_id"`
+	Changes      []*connectionChange `json:"changes"`
+}
+
+// holdsUpload asks the blobber what the journaled connection still has of
+// the upload. It returns the bytes of the shard the blobber holds, and whether
+// that's the whole shard with the same merkle root.
+func (j *UploadJournal) holdsUpload(ctx context.Context, allocationTx string,
+	blobber *blockchain.StorageNode) (int64, bool) {
+
+	p, ok := j.Blobbers[blobber.ID]
+	if !ok || (!p.Uploaded && p.BytesSent == 0) {
+		return 0, false
+	}
+	httpreq, err := zboxutil.NewConnectionRequest(blobber.Baseurl, allocationTx, j.ConnectionID)
+	if err != nil {
+		Logger.Error(blobber.Baseurl, "Error creating connection request", err)
+		return 0, false
+	}
+	var details connectionDetails
+	ctx, cncl := context.WithTimeout(ctx, (time.Second * 30))
+	err = zboxutil.HttpDo(ctx, cncl, httpreq, func(resp *http.Response, err error) error {
+		if err != nil {
+			Logger.Error("Connection details: ", err)
+			return err
+		}
+		defer resp.Body.Close()
+		respBody, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode != http.StatusOK {
+			return errors.New("connection_details", string(respBody))
+		}
+		return json.Unmarshal(respBody, &details)
+	})
+	if err != nil || details.ConnectionID != j.ConnectionID {
+		return 0, false
+	}
+	for _, change := range details.Changes {
+		var input uploadFormData
+		if err := json.Unmarshal([]byte(change.Input), &input); err != nil {
+			continue
+		}
+		if input.Path != j.RemotePath {
+			continue
+		}
+		if !p.Uploaded {
+			return p.BytesSent, false
+		}
+		if input.MerkleRoot == p.MerkleRoot {
+			return p.ShardSize, true
+		}
+	}
+	return 0, false
+}
+
+// hashState returns the state of the hash, nil if it can't be saved.
+func hashState(h hash.Hash) []byte {
+	m, ok := h.(encoding.BinaryMarshaler)
+	if !ok {
+		return nil
+	}
+	state, err := m.MarshalBinary()
+	if err != nil {
+		return nil
+	}
+	return state
+}
+
+// ResumeUpload continues an interrupted upload of the remotepath from its
+// journal. Blobbers which still hold the whole shard in the journaled
+// connection are committed without uploading again, the ones holding a part
+// of it get the rest, the others get their shard from the beginning in the
+// same connection. If no blobber holds anything or the local file has
+// changed, the upload restarts in a new connection.
+func (a *Allocation) ResumeUpload(remotepath string, status StatusCallback) error {
+	if !a.isInitialized() {
+		return notInitialized
+	}
+	if len(uploadJournalDir) == 0 {
+		return errors.New("upload_journal_disabled", "Upload journal dir is not set")
+	}
+
+	remotepath = zboxutil.RemoteClean(remotepath)
+	journal, err := loadUploadJournal(uploadJournalPath(a.ID, remotepath))
+	if err != nil {
+		return errors.Wrap(err, "No resumable upload for the path")
+	}
+
+	fileInfo, err := GetFileInfo(journal.LocalPath)
+	if err != nil {
+		journal.remove()
+		return errors.Wrap(err, "Local file error")
+	}
+
+	resumed := make(map[uint64]*fileref.FileRef)
+	held := make([]int64, len(a.Blobbers))
+	if journal.matches(fileInfo) {
+		var mutex sync.Mutex
+		wg := &sync.WaitGroup{}
+		for pos, blobber := range a.Blobbers {
+			wg.Add(1)
+			go func(pos int, blobber *blockchain.StorageNode) {
+				defer wg.Done()
+				sent, complete := journal.holdsUpload(a.ctx, a.Tx, blobber)
+				held[pos] = sent
+				if complete {
+					mutex.Lock()
+					resumed[uint64(pos)] = journal.fileRef(blobber.ID)
+					mutex.Unlock()
+				}
+			}(pos, blobber)
+		}
+		wg.Wait()
+	}
+	partial := 0
+	for pos, blobber := range a.Blobbers {
+		if held[pos] == 0 {
+			journal.restart(blobber.ID)
+		} else if _, ok := resumed[uint64(pos)]; !ok {
+			partial++
+		}
+	}
+
+	if len(resumed) == 0 && partial == 0 {
+		Logger.Info("Upload can't be resumed, restarting ", remotepath)
+		journal.remove()
+		return a.uploadOrUpdateFile(journal.LocalPath, remotepath, status,
+			journal.IsUpdate, journal.ThumbnailPath, false, false,
+			journal.Attributes, withCustomMeta(journal.CustomMeta))
+	}
+
+	uploadReq := a.newUploadRequest(remotepath, journal.Size, status,
+		journal.IsUpdate, false, journal.Attributes)
+	uploadReq.filepath = journal.LocalPath
+	uploadReq.filemeta.CustomMeta = journal.CustomMeta
+	uploadReq.connectionID = journal.ConnectionID
+	uploadReq.journal = journal
+	uploadReq.resumed = resumed
+	for pos := range resumed {
+		uploadReq.uploadMask = uploadReq.uploadMask.And(zboxutil.NewUint128(1).Lsh(pos).Not())
+	}
+	if len(journal.ThumbnailPath) > 0 {
+		if thumbInfo, err := os.Stat(journal.ThumbnailPath); err == nil {
+			uploadReq.thumbnailpath = journal.ThumbnailPath
+			uploadReq.filemeta.ThumbnailSize = thumbInfo.Size()
+			uploadReq.thumbRemaining = thumbInfo.Size()
+		}
+	}
+	uploadReq.completedCallback = func(filepath string) {
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		delete(a.uploadProgressMap, filepath)
+	}
+	Logger.Info("Resuming upload ", remotepath, " blobbers holding it: ", len(resumed),
+		" holding a part: ", partial)
+
+	go func() {
+		a.uploadChan <- uploadReq
+		a.mutex.Lock()
+		defer a.mutex.Unlock()
+		a.uploadProgressMap[journal.LocalPath] = uploadReq
+	}()
+	return nil
+}
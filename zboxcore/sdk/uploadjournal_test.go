@@ -0,0 +1,330 @@
+package sdk
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/encoder"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUploadJournal_saveAndLoad(t *testing.T) {
+	var require = require.New(t)
+
+	uploadJournalDir = t.TempDir()
+	defer func() { uploadJournalDir = "" }()
+
+	j := &UploadJournal{
+		AllocationID: "alloc",
+		ConnectionID: "conn",
+		LocalPath:    "/tmp/1.txt",
+		RemotePath:   "/1.txt",
+		Size:         65536,
+		Blobbers:     make(map[string]*BlobberUploadProgress),
+		path:         uploadJournalPath("alloc", "/1.txt"),
+	}
+	j.setBytesSent("b1", 100, []byte("state"))
+	file := &fileref.FileRef{}
+	file.Size = 32768
+	file.ContentHash = "content"
+	file.MerkleRoot = "merkle"
+	file.ActualFileHash = "actual"
+	j.setUploaded("b2", file)
+
+	loaded, err := loadUploadJournal(uploadJournalPath("alloc", "/1.txt"))
+	require.NoError(err)
+	require.EqualValues("conn", loaded.ConnectionID)
+	sent, state := loaded.bytesSent("b1")
+	require.EqualValues(100, sent)
+	require.EqualValues("state", string(state))
+	require.True(loaded.Blobbers["b2"].Uploaded)
+
+	file = loaded.fileRef("b2")
+	require.EqualValues("1.txt", file.Name)
+	require.EqualValues(32768, file.Size)
+	require.EqualValues("merkle", file.MerkleRoot)
+	require.EqualValues("actual", file.ActualFileHash)
+	require.EqualValues(65536, file.ActualFileSize)
+
+	loaded.remove()
+	_, err = loadUploadJournal(uploadJournalPath("alloc", "/1.txt"))
+	require.Error(err)
+}
+
+func TestUploadJournal_holdsUpload(t *testing.T) {
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	tests := []struct {
+		name         string
+		progress     *BlobberUploadProgress
+		changes      []uploadFormData
+		wantSent     int64
+		wantComplete bool
+	}{
+		{
+			name: "Test_No_Progress_Not_Asked",
+		},
+		{
+			name:         "Test_Whole_Shard_Held",
+			progress:     &BlobberUploadProgress{Uploaded: true, ShardSize: 4096, MerkleRoot: "merkle"},
+			changes:      []uploadFormData{{Path: "/2.txt"}, {Path: "/1.txt", MerkleRoot: "merkle"}},
+			wantSent:     4096,
+			wantComplete: true,
+		},
+		{
+			name:     "Test_Other_Merkle_Root_Not_Held",
+			progress: &BlobberUploadProgress{Uploaded: true, ShardSize: 4096, MerkleRoot: "merkle"},
+			changes:  []uploadFormData{{Path: "/1.txt", MerkleRoot: "other"}},
+		},
+		{
+			name:     "Test_Part_Held",
+			progress: &BlobberUploadProgress{BytesSent: 1024},
+			changes:  []uploadFormData{{Path: "/1.txt"}},
+			wantSent: 1024,
+		},
+		{
+			name:     "Test_Part_Lost",
+			progress: &BlobberUploadProgress{BytesSent: 1024},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+				return strings.HasPrefix(req.URL.Path, tt.name) &&
+					strings.Contains(req.URL.Path, zboxutil.CONNECTION_ENDPOINT)
+			})).Return(func(req *http.Request) *http.Response {
+				require.NotNil(tt.progress, "the blobber without progress is asked")
+				details := connectionDetails{ConnectionID: req.URL.Query().Get("connection_id")}
+				for _, change := range tt.changes {
+					input, err := json.Marshal(change)
+					require.NoError(err)
+					details.Changes = append(details.Changes, &connectionChange{Input: string(input)})
+				}
+				body, err := json.Marshal(details)
+				require.NoError(err)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				}
+			}, nil)
+
+			j := &UploadJournal{
+				ConnectionID: "conn",
+				RemotePath:   "/1.txt",
+				Blobbers:     make(map[string]*BlobberUploadProgress),
+			}
+			blobber := &blockchain.StorageNode{ID: mockBlobberId, Baseurl: tt.name + mockBlobberUrl}
+			if tt.progress != nil {
+				j.Blobbers[blobber.ID] = tt.progress
+			}
+			sent, complete := j.holdsUpload(context.Background(), mockAllocationTxId, blobber)
+			require.EqualValues(tt.wantSent, sent)
+			require.EqualValues(tt.wantComplete, complete)
+		})
+	}
+}
+
+func TestAllocation_ResumeUpload(t *testing.T) {
+	require := require.New(t)
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	uploadJournalDir = t.TempDir()
+	uploadPartSize = fileref.CHUNK_SIZE
+	getFileInfo := GetFileInfo
+	GetFileInfo = os.Stat
+	defer func() {
+		uploadJournalDir = ""
+		uploadPartSize = 4 * 1024 * 1024
+		GetFileInfo = getFileInfo
+	}()
+
+	a := &Allocation{ID: mockAllocationId, Tx: mockAllocationTxId, DataShards: 2, ParityShards: 2}
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      mockBlobberId + strconv.Itoa(i),
+			Baseurl: t.Name() + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+	a.uploadChan = make(chan *UploadRequest, 1)
+	a.ctx, a.ctxCancelF = context.WithCancel(context.Background())
+	defer a.ctxCancelF()
+	a.uploadProgressMap = make(map[string]*UploadRequest)
+	a.mutex = &sync.Mutex{}
+	a.initialized = true
+	sdkInitialized = true
+	setupMockCommitRequest(a)
+
+	// three chunks by shard, the shards of the blobbers are kept to check what
+	// they get
+	content := make([]byte, 3*2*fileref.CHUNK_SIZE)
+	for i := range content {
+		content[i] = byte(i * 7)
+	}
+	localPath := filepath.Join(t.TempDir(), "1.txt")
+	require.NoError(ioutil.WriteFile(localPath, content, 0644))
+	fileInfo, err := os.Stat(localPath)
+	require.NoError(err)
+	erasureencoder, err := encoder.NewEncoder(2, 2)
+	require.NoError(err)
+	shards := make([][]byte, numBlobbers)
+	for i := 0; i < len(content); i += 2 * fileref.CHUNK_SIZE {
+		chunkShards, err := erasureencoder.Encode(content[i : i+2*fileref.CHUNK_SIZE])
+		require.NoError(err)
+		for pos := range shards {
+			shards[pos] = append(shards[pos], chunkShards[pos]...)
+		}
+	}
+	h := sha1.New()
+	h.Write(shards[1][:fileref.CHUNK_SIZE])
+
+	// the first blobber holds its shard, the second one its first chunk, the
+	// third one has lost its first chunk and the last one got nothing
+	journal := &UploadJournal{
+		AllocationID: a.ID,
+		ConnectionID: "conn",
+		LocalPath:    localPath,
+		RemotePath:   "/1.txt",
+		Size:         fileInfo.Size(),
+		ModTime:      fileInfo.ModTime().UnixNano(),
+		Blobbers: map[string]*BlobberUploadProgress{
+			a.Blobbers[0].ID: {Uploaded: true, ShardSize: 3 * fileref.CHUNK_SIZE, MerkleRoot: "merkle"},
+			a.Blobbers[1].ID: {BytesSent: fileref.CHUNK_SIZE, HashState: hashState(h)},
+			a.Blobbers[2].ID: {BytesSent: fileref.CHUNK_SIZE},
+		},
+		path: uploadJournalPath(a.ID, "/1.txt"),
+	}
+	journal.save()
+
+	blobberIdx := func(req *http.Request) int {
+		idx, err := strconv.Atoi(strings.Split(strings.TrimPrefix(req.URL.Path, t.Name()+mockBlobberUrl), "/")[0])
+		require.NoError(err)
+		return idx
+	}
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.Contains(req.URL.Path, zboxutil.CONNECTION_ENDPOINT)
+	})).Return(func(req *http.Request) *http.Response {
+		details := connectionDetails{ConnectionID: "conn"}
+		var input []byte
+		switch blobberIdx(req) {
+		case 0:
+			input, _ = json.Marshal(uploadFormData{Path: "/1.txt", MerkleRoot: "merkle"})
+		case 1:
+			input, _ = json.Marshal(uploadFormData{Path: "/1.txt"})
+		}
+		if input != nil {
+			details.Changes = append(details.Changes, &connectionChange{Input: string(input)})
+		}
+		body, _ := json.Marshal(details)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.Contains(req.URL.Path, zboxutil.FILE_META_ENDPOINT)
+	})).Return(func(*http.Request) *http.Response {
+		return &http.Response{
+			StatusCode: http.StatusBadRequest,
+			Body:       ioutil.NopCloser(strings.NewReader("not found")),
+		}
+	}, nil)
+
+	// the blobbers keep the parts they get and answer with the size held
+	var mutex sync.Mutex
+	received := map[int][]byte{1: shards[1][:fileref.CHUNK_SIZE]}
+	offsets := make(map[int][]int64)
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.Contains(req.URL.Path, zboxutil.UPLOAD_ENDPOINT)
+	})).Return(func(req *http.Request) *http.Response {
+		idx := blobberIdx(req)
+		reader, err := req.MultipartReader()
+		require.NoError(err)
+		var data []byte
+		var formData uploadFormData
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			require.NoError(err)
+			value, err := ioutil.ReadAll(part)
+			require.NoError(err)
+			switch part.FormName() {
+			case "uploadFile":
+				data = value
+			case "uploadMeta":
+				require.NoError(json.Unmarshal(value, &formData))
+			}
+		}
+		mutex.Lock()
+		defer mutex.Unlock()
+		require.EqualValues(len(received[idx]), formData.UploadOffset)
+		received[idx] = append(received[idx], data...)
+		offsets[idx] = append(offsets[idx], formData.UploadOffset)
+		body, _ := json.Marshal(uploadResult{
+			Filename:   formData.Filename,
+			ShardSize:  int64(len(received[idx])),
+			Hash:       formData.Hash,
+			MerkleRoot: formData.MerkleRoot,
+		})
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+
+	status := &mocks.StatusCallback{}
+	status.On("Started", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	status.On("InProgress", mock.Anything, mock.Anything, mock.Anything, mock.Anything, mock.Anything).Maybe()
+	status.On("Completed", a.ID, "/1.txt", "1.txt", mock.Anything, mock.Anything, OpUpload).Once()
+	require.NoError(a.ResumeUpload("/1.txt", status))
+	uploadReq := <-a.uploadChan
+	require.EqualValues("conn", uploadReq.connectionID)
+	uploadReq.processUpload(a.ctx, a)
+	status.AssertExpectations(t)
+
+	require.NotContains(received, 0)
+	for pos := 1; pos < numBlobbers; pos++ {
+		require.EqualValues(shards[pos], received[pos], "blobber %v", pos)
+	}
+	require.EqualValues([]int64{fileref.CHUNK_SIZE, 2 * fileref.CHUNK_SIZE}, offsets[1])
+	require.EqualValues([]int64{0, fileref.CHUNK_SIZE, 2 * fileref.CHUNK_SIZE}, offsets[3])
+	_, err = loadUploadJournal(uploadJournalPath(a.ID, "/1.txt"))
+	require.Error(err)
+}
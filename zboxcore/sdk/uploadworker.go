@@ -1,6 +1,7 @@
 package sdk
 
 import (
+	"bufio"
 	"bytes"
 	"context"
 	"crypto/sha1"
@@ -14,6 +15,7 @@ import (
 	"mime/multipart"
 	"net/http"
 	"os"
+	"path"
 	"sync"
 
 	"github.com/0chain/errors"
@@ -46,6 +48,26 @@ type UploadFileMeta struct {
 	ThumbnailSize int64
 	ThumbnailHash string
 	Attributes    fileref.Attributes
+	CustomMeta    string
+}
+
+// UploadOption changes the way a file is uploaded.
+type UploadOption func(req *UploadRequest)
+
+// withCustomMeta sets the custom meta of the uploaded file.
+func withCustomMeta(customMeta string) UploadOption {
+	return func(req *UploadRequest) {
+		req.filemeta.CustomMeta = customMeta
+	}
+}
+
+// WithCustomMeta attaches the key/value pairs to the uploaded file. They're
+// kept as a JSON object in the custom meta of the file, along with the pairs
+// set by the previous options.
+func WithCustomMeta(meta map[string]string) UploadOption {
+	return func(req *UploadRequest) {
+		req.filemeta.CustomMeta = mergeCustomMeta(req.filemeta.CustomMeta, meta)
+	}
 }
 
 type uploadFormData struct {
@@ -63,8 +85,15 @@ type uploadFormData struct {
 	CustomMeta          string             `json:"custom_meta,omitempty"`
 	EncryptedKey        string             `json:"encrypted_key,omitempty"`
 	Attributes          fileref.Attributes `json:"attributes,omitempty"`
+	UploadOffset        int64              `json:"upload_offset"`
+	IsFinal             bool               `json:"is_final"`
 }
 
+// uploadPartSize is the shard size sent in one request by the journaled
+// uploads. The blobber keeps the parts it got, an interrupted upload continues
+// after the last one.
+var uploadPartSize int64 = 4 * 1024 * 1024
+
 type uploadResult struct {
 	Filename   string `json:"filename"`
 	ShardSize  int64  `json:"size"`
@@ -74,6 +103,8 @@ type uploadResult struct {
 
 type UploadRequest struct {
 	filepath          string
+	reader            io.Reader
+	sizeUnknown       bool
 	thumbnailpath     string
 	remotefilepath    string
 	statusCallback    StatusCallback
@@ -99,6 +130,14 @@ type UploadRequest struct {
 	isUploadCanceled  bool
 	completedCallback func(filepath string)
 	err               error
+	// journal keeps the progress on disk for ResumeUpload, nil if disabled
+	journal *UploadJournal
+	// resumed are the files of the blobbers holding the upload already,
+	// keyed by the blobber position; they are committed without upload
+	resumed map[uint64]*fileref.FileRef
+	// dirAttrs caches the attributes of the parent directories of a
+	// transfer, nil to list the parent of every new file
+	dirAttrs *dirAttributes
 	Consensus
 }
 
@@ -114,14 +153,10 @@ func (req *UploadRequest) prepareUpload(
 	uploadThumbCh chan []byte,
 	wg *sync.WaitGroup,
 ) {
-	bodyReader, bodyWriter := io.Pipe()
-	formWriter := multipart.NewWriter(bodyWriter)
-	httpreq, _ := zboxutil.NewUploadRequest(blobber.Baseurl, a.Tx, bodyReader, req.isUpdate)
+	defer wg.Done()
 	//timeout := time.Duration(int64(math.Max(10, float64(obj.file.Size)/(CHUNK_SIZE*float64(len(obj.blobbers)/2)))))
 	//ctx, cncl := context.WithTimeout(context.Background(), (time.Second * timeout))
 
-	httpreq.Header.Add("Content-Type", formWriter.FormDataContentType())
-	var formData uploadFormData
 	shardSize := (req.filemeta.Size + int64(a.DataShards) - 1) / int64(a.DataShards)
 	chunkSizeWithHeader := int64(fileref.CHUNK_SIZE)
 	if req.isEncrypted {
@@ -134,194 +169,295 @@ func (req *UploadRequest) prepareUpload(
 	}
 	thumbnailSize := int64(0)
 	remaining := shardSize
-	sent := 0
-	go func() {
-		fileMerkleRoot := ""
-		fileContentHash := ""
-		thumbContentHash := ""
-		var (
-			fileField io.Writer
-			err       error
-		)
-		fileField, err = formWriter.CreateFormFile("uploadFile", file.Name)
-		if err != nil {
-			Logger.Error("Create form failed: ", err)
-			bodyWriter.CloseWithError(err)
-			// Just read the data to unblock
-			for remaining > 0 {
-				dataBytes := <-uploadCh
-				remaining = remaining - int64(len(dataBytes))
-			}
-			_ = <-uploadCh
+	sent := int64(0)
+	// a resumed blobber holds the shard up to the held bytes, the data before
+	// is only hashed again
+	held, heldState := req.journal.bytesSent(blobber.ID)
+	// a failed blobber gets nothing more, its data is still read to not block
+	// the others
+	failed := false
+	fail := func(err error) {
+		Logger.Error(blobber.Baseurl, " Upload : ", err)
+		req.err = err
+		failed = true
+	}
+	var part *uploadPart
+
+	// Setup file hash compute
+	h := sha1.New()
+	//merkleHash := sha3.New256()
+	hWr := io.MultiWriter(h)
+	merkleHashes := make([]hash.Hash, 1024)
+	merkleLeaves := make([]util.Hashable, 1024)
+	for idx := range merkleHashes {
+		merkleHashes[idx] = sha3.New256()
+	}
+	// Read the data, a nil chunk marks the end of a stream of unknown size
+	for req.sizeUnknown || remaining > 0 {
+		dataBytes, ok := <-uploadCh
+		if !ok {
+			part.abort()
 			return
 		}
+		if dataBytes == nil {
+			break
+		}
+		hWr.Write(dataBytes)
+		merkleChunkSize := 64
+		for i := 0; i < len(dataBytes); i += merkleChunkSize {
+			end := i + merkleChunkSize
+			if end > len(dataBytes) {
+				end = len(dataBytes)
+			}
+			offset := i / merkleChunkSize
+			merkleHashes[offset].Write(dataBytes[i:end])
+		}
+		if sent >= held && !failed {
+			if part == nil {
+				part = req.startUploadPart(a, blobber, file.Name, sent)
+			}
+			part.write(dataBytes)
+		}
+		remaining = remaining - int64(len(dataBytes))
+		sent = sent + int64(len(dataBytes))
+		if held > 0 && sent == held && !bytes.Equal(hashState(h), heldState) {
+			fail(errors.New("resume_failed", "The local file doesn't match the uploaded part"))
+		}
+		if req.statusCallback != nil {
+			req.statusCallback.InProgress(a.ID, req.remotefilepath, OpUpload, int(sent)*(a.DataShards+a.ParityShards), nil)
+		}
+		// a journaled upload is sent in parts, the blobber keeps the parts
+		// it got for a resume
+		if req.journal != nil && part != nil && part.size >= uploadPartSize && remaining > 0 {
+			formData := uploadFormData{
+				ConnectionID: req.connectionID,
+				Filename:     file.Name,
+				Path:         file.Path,
+				UploadOffset: part.offset,
+			}
+			r, err := part.finish(&formData, req.isUpdate)
+			if err == nil && r.ShardSize != sent {
+				err = errors.New("upload_failed", "Unexpected upload response data")
+			}
+			if err != nil {
+				fail(err)
+			} else {
+				req.journal.setBytesSent(blobber.ID, sent, hashState(h))
+			}
+			part = nil
+		}
+	}
+	if req.sizeUnknown {
+		shardSize = sent
+	}
+	for idx := range merkleHashes {
+		merkleLeaves[idx] = util.NewStringHashable(hex.EncodeToString(merkleHashes[idx].Sum(nil)))
+	}
+	var mt util.MerkleTreeI = &util.MerkleTree{}
+	mt.ComputeTree(merkleLeaves)
+	if !req.isRepair {
+		// Wait for file hash to be ready
+		// Logger.Debug("Waiting for file hash....")
+		_ = <-uploadCh
+		// Logger.Debug("File Hash ready", obj.file.Hash)
+	}
+	fileContentHash := hex.EncodeToString(h.Sum(nil))
+	fileMerkleRoot := mt.GetRoot()
+	if !failed && part == nil {
+		part = req.startUploadPart(a, blobber, file.Name, sent)
+	}
+
+	thumbContentHash := ""
+	if len(req.thumbnailpath) > 0 {
+		thumbnailSize = (req.filemeta.ThumbnailSize + int64(a.DataShards) - 1) / int64(a.DataShards)
+		chunkSizeWithHeader := int64(fileref.CHUNK_SIZE)
+		if req.isEncrypted {
+			chunkSizeWithHeader -= 16
+			chunkSizeWithHeader -= 2 * 1024
+		}
+		chunksPerShard := (thumbnailSize + chunkSizeWithHeader - 1) / chunkSizeWithHeader
+		if req.isEncrypted {
+			thumbnailSize += chunksPerShard * (16 + (2 * 1024))
+		}
+		remaining := thumbnailSize
+
+		var fileField io.Writer = ioutil.Discard
+		if !failed {
+			fileField = part.createFile("uploadThumbnailFile", file.Name+".thumb")
+		}
 		// Setup file hash compute
 		h := sha1.New()
-		//merkleHash := sha3.New256()
 		hWr := io.MultiWriter(h)
-		merkleHashes := make([]hash.Hash, 1024)
-		merkleLeaves := make([]util.Hashable, 1024)
-		for idx := range merkleHashes {
-			merkleHashes[idx] = sha3.New256()
-		}
 		// Read the data
 		for remaining > 0 {
-			dataBytes, ok := <-uploadCh
+			dataBytes, ok := <-uploadThumbCh
 			if !ok {
+				part.abort()
 				return
 			}
 			fileField.Write(dataBytes)
 			hWr.Write(dataBytes)
-			merkleChunkSize := 64
-			for i := 0; i < len(dataBytes); i += merkleChunkSize {
-				end := i + merkleChunkSize
-				if end > len(dataBytes) {
-					end = len(dataBytes)
-				}
-				offset := i / merkleChunkSize
-				merkleHashes[offset].Write(dataBytes[i:end])
-			}
 			remaining = remaining - int64(len(dataBytes))
-			sent = sent + len(dataBytes)
-			if req.statusCallback != nil {
-				req.statusCallback.InProgress(a.ID, req.remotefilepath, OpUpload, sent*(a.DataShards+a.ParityShards), nil)
-			}
-		}
-		for idx := range merkleHashes {
-			merkleLeaves[idx] = util.NewStringHashable(hex.EncodeToString(merkleHashes[idx].Sum(nil)))
 		}
-		var mt util.MerkleTreeI = &util.MerkleTree{}
-		mt.ComputeTree(merkleLeaves)
 		if !req.isRepair {
 			// Wait for file hash to be ready
 			// Logger.Debug("Waiting for file hash....")
-			_ = <-uploadCh
+			_ = <-uploadThumbCh
 			// Logger.Debug("File Hash ready", obj.file.Hash)
 		}
-		fileContentHash = hex.EncodeToString(h.Sum(nil))
-		fileMerkleRoot = mt.GetRoot()
+		thumbContentHash = hex.EncodeToString(h.Sum(nil))
+	}
+	if failed {
+		part.abort()
+		return
+	}
 
-		if len(req.thumbnailpath) > 0 {
-			thumbnailSize = (req.filemeta.ThumbnailSize + int64(a.DataShards) - 1) / int64(a.DataShards)
-			chunkSizeWithHeader := int64(fileref.CHUNK_SIZE)
-			if req.isEncrypted {
-				chunkSizeWithHeader -= 16
-				chunkSizeWithHeader -= 2 * 1024
-			}
-			chunksPerShard := (thumbnailSize + chunkSizeWithHeader - 1) / chunkSizeWithHeader
-			if req.isEncrypted {
-				thumbnailSize += chunksPerShard * (16 + (2 * 1024))
-			}
-			remaining := thumbnailSize
+	formData := uploadFormData{
+		ConnectionID:        req.connectionID,
+		Filename:            file.Name,
+		Path:                file.Path,
+		ActualHash:          req.filemeta.Hash,
+		ActualSize:          req.filemeta.Size,
+		ActualThumbnailHash: req.filemeta.ThumbnailHash,
+		ActualThumbnailSize: req.filemeta.ThumbnailSize,
+		MimeType:            req.filemeta.MimeType,
+		Attributes:          req.filemeta.Attributes,
+		CustomMeta:          req.filemeta.CustomMeta,
+		Hash:                fileContentHash,
+		ThumbnailHash:       thumbContentHash,
+		MerkleRoot:          fileMerkleRoot,
+		UploadOffset:        part.offset,
+		IsFinal:             true,
+	}
+	if req.isEncrypted {
+		formData.EncryptedKey = req.encscheme.GetEncryptedKey()
+	}
+	r, err := part.finish(&formData, req.isUpdate)
+	if err != nil {
+		fail(err)
+		return
+	}
+	if r.Filename != formData.Filename || r.ShardSize != shardSize ||
+		r.Hash != formData.Hash || r.MerkleRoot != formData.MerkleRoot {
+		fail(errors.New("upload_failed", "Unexpected upload response data"))
+		return
+	}
+	req.consensus++
+	Logger.Info(blobber.Baseurl, formData.Path, " uploaded")
+	file.MerkleRoot = formData.MerkleRoot
+	file.ContentHash = formData.Hash
+	file.ThumbnailHash = formData.ThumbnailHash
+	file.ThumbnailSize = thumbnailSize
+	file.Size = shardSize
+	file.Path = formData.Path
+	file.ActualFileHash = formData.ActualHash
+	file.ActualFileSize = formData.ActualSize
+	file.ActualThumbnailHash = formData.ActualThumbnailHash
+	file.ActualThumbnailSize = formData.ActualThumbnailSize
+	file.EncryptedKey = formData.EncryptedKey
+	file.CalculateHash()
+	req.journal.setUploaded(blobber.ID, file)
+}
+
+// uploadPart is an upload request to a blobber. The shard data is streamed
+// in the request body while it runs, the form data ends it.
+type uploadPart struct {
+	offset     int64
+	size       int64
+	bodyWriter *io.PipeWriter
+	formWriter *multipart.Writer
+	fileField  io.Writer
+	result     uploadResult
+	done       chan error
+}
+
+// startUploadPart starts the upload request of the shard data from the
+// offset on.
+func (req *UploadRequest) startUploadPart(a *Allocation,
+	blobber *blockchain.StorageNode, name string, offset int64) *uploadPart {
 
-			fileField, err := formWriter.CreateFormFile("uploadThumbnailFile", file.Name+".thumb")
+	bodyReader, bodyWriter := io.Pipe()
+	part := &uploadPart{
+		offset:     offset,
+		bodyWriter: bodyWriter,
+		formWriter: multipart.NewWriter(bodyWriter),
+		fileField:  ioutil.Discard,
+		done:       make(chan error, 1),
+	}
+	httpreq, err := zboxutil.NewUploadRequest(blobber.Baseurl, a.Tx, bodyReader, req.isUpdate)
+	if err != nil {
+		bodyReader.CloseWithError(err)
+		part.done <- err
+		return part
+	}
+	httpreq.Header.Add("Content-Type", part.formWriter.FormDataContentType())
+	go func() {
+		err := zboxutil.HttpDo(a.ctx, a.ctxCancelF, httpreq, func(resp *http.Response, err error) error {
 			if err != nil {
-				Logger.Error("Create form failed: ", err)
-				return
-			}
-			// Setup file hash compute
-			h := sha1.New()
-			hWr := io.MultiWriter(h)
-			// Read the data
-			for remaining > 0 {
-				dataBytes, ok := <-uploadThumbCh
-				if !ok {
-					return
-				}
-				fileField.Write(dataBytes)
-				hWr.Write(dataBytes)
-				remaining = remaining - int64(len(dataBytes))
+				return err
 			}
-			if !req.isRepair {
-				// Wait for file hash to be ready
-				// Logger.Debug("Waiting for file hash....")
-				_ = <-uploadThumbCh
-				// Logger.Debug("File Hash ready", obj.file.Hash)
+			defer resp.Body.Close()
+
+			respbody, err := ioutil.ReadAll(resp.Body)
+			if err != nil {
+				return err
 			}
-			thumbContentHash = hex.EncodeToString(h.Sum(nil))
-		}
-
-		formData = uploadFormData{
-			ConnectionID:        req.connectionID,
-			Filename:            file.Name,
-			Path:                file.Path,
-			ActualHash:          req.filemeta.Hash,
-			ActualSize:          req.filemeta.Size,
-			ActualThumbnailHash: req.filemeta.ThumbnailHash,
-			ActualThumbnailSize: req.filemeta.ThumbnailSize,
-			MimeType:            req.filemeta.MimeType,
-			Attributes:          req.filemeta.Attributes,
-			Hash:                fileContentHash,
-			ThumbnailHash:       thumbContentHash,
-			MerkleRoot:          fileMerkleRoot,
-		}
-		if req.isEncrypted {
-			formData.EncryptedKey = req.encscheme.GetEncryptedKey()
-		}
-		_ = formWriter.WriteField("connection_id", req.connectionID)
-		var metaData []byte
-		metaData, err = json.Marshal(formData)
-		// Logger.Debug("Upload with",string(metaData))
-		if err == nil {
-			if req.isUpdate {
-				_ = formWriter.WriteField("updateMeta", string(metaData))
-			} else {
-				_ = formWriter.WriteField("uploadMeta", string(metaData))
+			if resp.StatusCode != http.StatusOK {
+				Logger.Error(blobber.Baseurl, " Upload error response: ", resp.StatusCode, string(respbody))
+				return errors.New("", string(respbody))
 			}
-
-			bodyWriter.CloseWithError(formWriter.Close())
-		}
+			return json.Unmarshal(respbody, &part.result)
+		})
+		// the data written after the request has ended is dropped
+		bodyReader.CloseWithError(err)
+		part.done <- err
 	}()
-	_ = zboxutil.HttpDo(a.ctx, a.ctxCancelF, httpreq, func(resp *http.Response, err error) error {
-		if err != nil {
-			Logger.Error("Upload : ", err)
-			req.err = err
-			return err
-		}
-		defer resp.Body.Close()
+	part.fileField = part.createFile("uploadFile", name)
+	return part
+}
 
-		respbody, err := ioutil.ReadAll(resp.Body)
-		if err != nil {
-			Logger.Error("Error: Resp ", err)
-			req.err = err
-			return err
-		}
-		if resp.StatusCode != http.StatusOK {
-			Logger.Error(blobber.Baseurl, " Upload error response: ", resp.StatusCode, string(respbody))
-			req.err = errors.New("", string(respbody))
-			return err
-		}
-		var r uploadResult
-		err = json.Unmarshal(respbody, &r)
-		if err != nil {
-			Logger.Error(blobber.Baseurl, " Upload response parse error: ", err)
-			req.err = err
-			return err
-		}
-		if r.Filename != formData.Filename || r.ShardSize != shardSize ||
-			r.Hash != formData.Hash || r.MerkleRoot != formData.MerkleRoot {
-			err = fmt.Errorf(blobber.Baseurl, "Unexpected upload response data", string(respbody))
-			Logger.Error(err)
-			req.err = err
-			return err
-		}
-		req.consensus++
-		Logger.Info(blobber.Baseurl, formData.Path, " uploaded")
-		file.MerkleRoot = formData.MerkleRoot
-		file.ContentHash = formData.Hash
-		file.ThumbnailHash = formData.ThumbnailHash
-		file.ThumbnailSize = thumbnailSize
-		file.Size = shardSize
-		file.Path = formData.Path
-		file.ActualFileHash = formData.ActualHash
-		file.ActualFileSize = formData.ActualSize
-		file.ActualThumbnailHash = formData.ActualThumbnailHash
-		file.ActualThumbnailSize = formData.ActualThumbnailSize
-		file.EncryptedKey = formData.EncryptedKey
-		file.CalculateHash()
-		return nil
-	})
-	wg.Done()
+func (p *uploadPart) createFile(fieldname, filename string) io.Writer {
+	fileField, err := p.formWriter.CreateFormFile(fieldname, filename)
+	if err != nil {
+		// the request has failed, finish reports it
+		return ioutil.Discard
+	}
+	return fileField
+}
+
+func (p *uploadPart) write(data []byte) {
+	p.fileField.Write(data)
+	p.size += int64(len(data))
+}
+
+// finish ends the part with the form data and returns the blobber's result.
+func (p *uploadPart) finish(formData *uploadFormData, isUpdate bool) (*uploadResult, error) {
+	metaData, err := json.Marshal(formData)
+	if err != nil {
+		p.bodyWriter.CloseWithError(err)
+		<-p.done
+		return nil, err
+	}
+	_ = p.formWriter.WriteField("connection_id", formData.ConnectionID)
+	if isUpdate {
+		_ = p.formWriter.WriteField("updateMeta", string(metaData))
+	} else {
+		_ = p.formWriter.WriteField("uploadMeta", string(metaData))
+	}
+	p.bodyWriter.CloseWithError(p.formWriter.Close())
+	if err = <-p.done; err != nil {
+		return nil, err
+	}
+	return &p.result, nil
+}
+
+// abort stops the request, the blobber drops the part.
+func (p *uploadPart) abort() {
+	if p == nil {
+		return
+	}
+	p.bodyWriter.CloseWithError(errors.New("upload_aborted", "Upload aborted"))
+	<-p.done
 }
 
 // setups upload for each blobber with same file
@@ -340,6 +476,7 @@ func (req *UploadRequest) setupUpload(a *Allocation) error {
 		req.file[i].Type = fileref.FILE
 		req.file[i].AllocationID = a.ID
 		req.file[i].Attributes = req.filemeta.Attributes
+		req.file[i].CustomMeta = req.filemeta.CustomMeta
 	}
 
 	if !req.isRepair {
@@ -360,7 +497,7 @@ func (req *UploadRequest) setupUpload(a *Allocation) error {
 
 	req.wg = &sync.WaitGroup{}
 	req.wg.Add(numUploads)
-	req.consensus = 0
+	req.consensus = float32(len(req.resumed))
 
 	// Start upload for each blobber
 	var c, pos uint64 = 0, 0
@@ -416,6 +553,14 @@ func (req *UploadRequest) pushData(data []byte) error {
 }
 
 func (req *UploadRequest) completePush() error {
+	if req.sizeUnknown {
+		var c, pos uint64 = 0, 0
+		for i := req.uploadMask; !i.Equals64(0); i = i.And(zboxutil.NewUint128(1).Lsh(pos).Not()) {
+			pos = uint64(i.TrailingZeros())
+			req.uploadDataCh[c] <- nil
+			c++
+		}
+	}
 	if !req.isRepair {
 		req.filemeta.Hash = hex.EncodeToString(req.fileHash.Sum(nil))
 		//fmt.Println("req.filemeta.Hash=" + req.filemeta.Hash)
@@ -438,128 +583,45 @@ func (req *UploadRequest) processUpload(ctx context.Context, a *Allocation) {
 		defer req.completedCallback(req.filepath)
 	}
 
-	var inFile *os.File
-	inFile, err := os.Open(req.filepath)
-	if err != nil && req.statusCallback != nil {
-		req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("open_file_failed", err.Error()))
-		return
-	}
-	defer inFile.Close()
-	mimetype, err := zboxutil.GetFileContentType(inFile)
-	if err != nil && req.statusCallback != nil {
-		req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("mime_type_error", err.Error()))
-		return
-	}
-	req.filemeta.MimeType = mimetype
-	err = req.setupUpload(a)
-	if err != nil && req.statusCallback != nil {
-		req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("setup_upload_failed", err.Error()))
-		return
-	}
-	size := req.filemeta.Size
-	// Calculate number of bytes per shard.
-	perShard := (size + int64(a.DataShards) - 1) / int64(a.DataShards)
-	wg := &sync.WaitGroup{}
-	wg.Add(1)
-	if len(req.thumbnailpath) > 0 {
-		wg.Add(1)
-		go req.processThumbnail(a, wg)
-	}
-	go func() {
-		defer wg.Done()
-		// Pad data to Shards*perShard.
-		padding := make([]byte, (int64(a.DataShards)*perShard)-size)
-		dataReader := io.MultiReader(inFile, bytes.NewBuffer(padding))
-		chunkSizeWithHeader := int64(fileref.CHUNK_SIZE)
-		if req.isEncrypted {
-			chunkSizeWithHeader -= 16
-			chunkSizeWithHeader -= 2 * 1024
-		}
-		chunksPerShard := (perShard + chunkSizeWithHeader - 1) / chunkSizeWithHeader
-		Logger.Info("Size:", size, " perShard:", perShard, " chunks/shard:", chunksPerShard)
-		req.isUploadCanceled = false
+	if err := req.applyRemoteAttributes(a); err != nil {
 		if req.statusCallback != nil {
-			req.statusCallback.Started(a.ID, req.remotefilepath, OpUpload, int(perShard)*(a.DataShards+a.ParityShards))
+			req.statusCallback.Error(a.ID, req.filepath, OpUpload, err)
 		}
-
-		for ctr := int64(0); ctr < chunksPerShard; ctr++ {
-			remaining := int64(math.Min(float64(perShard-(ctr*chunkSizeWithHeader)), float64(chunkSizeWithHeader)))
-			b1 := make([]byte, remaining*int64(a.DataShards))
-			_, err = dataReader.Read(b1)
-			if err != nil && req.statusCallback != nil {
-				req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("read_failed", err.Error()))
-				return
-			}
-			if req.isUploadCanceled {
-				req.isUploadCanceled = false
-				if !req.isUpdate && !req.isRepair {
-					go a.DeleteFile(req.remotefilepath)
-				}
-				if req.statusCallback != nil {
-					req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("user_aborted", "Upload aborted by user"))
-				}
-				return
-			}
-			err = req.pushData(b1)
-			if err != nil {
-				req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("push_error", err.Error()))
-				return
-			}
-
-		}
-		err = req.completePush()
-		if err != nil && req.statusCallback != nil {
-			req.statusCallback.Error(a.ID, req.remotefilepath, OpUpload, err)
-			return
-		}
-	}()
-	wg.Wait()
-	Logger.Info("Completed the upload. Submitting for commit")
-
-	for _, ch := range req.uploadDataCh {
-		close(ch)
+		return
 	}
 
-	for _, ch := range req.uploadThumbCh {
-		close(ch)
+	perShard, ok := req.uploadToBlobbers(a)
+	if !ok {
+		return
 	}
-	Logger.Info("Closed all the channels. Submitting for commit")
+
 	req.consensus = 0
-	wg = &sync.WaitGroup{}
-	ones := req.uploadMask.CountOnes()
+	commitMask := req.uploadMask
+	for pos := range req.resumed {
+		commitMask = commitMask.Or(zboxutil.NewUint128(1).Lsh(pos))
+	}
+	wg := &sync.WaitGroup{}
+	ones := commitMask.CountOnes()
 	wg.Add(ones)
 	commitReqs := make([]*CommitRequest, ones)
-	var c, pos uint64 = 0, 0
-	for i := req.uploadMask; !i.Equals64(0); i = i.And(zboxutil.NewUint128(1).Lsh(pos).Not()) {
+	var c, n, pos uint64 = 0, 0, 0
+	for i := commitMask; !i.Equals64(0); i = i.And(zboxutil.NewUint128(1).Lsh(pos).Not()) {
 		pos = uint64(i.TrailingZeros())
-		//go req.prepareUpload(a, a.Blobbers[pos], req.file[c], req.uploadDataCh[c], req.wg)
+		file, ok := req.resumed[pos]
+		if !ok {
+			file = req.file[c]
+			c++
+		}
 		commitReq := &CommitRequest{}
 		commitReq.allocationID = a.ID
 		commitReq.allocationTx = a.Tx
 		commitReq.blobber = a.Blobbers[pos]
-		if req.isUpdate {
-			newChange := &allocationchange.UpdateFileChange{}
-			newChange.NewFile = req.file[c]
-			newChange.NumBlocks = req.file[c].NumBlocks
-			newChange.Operation = allocationchange.UPDATE_OPERATION
-			newChange.Size = req.file[c].Size
-			newChange.NewFile.Attributes = req.file[c].Attributes
-			commitReq.changes = append(commitReq.changes, newChange)
-		} else {
-			newChange := &allocationchange.NewFileChange{}
-			newChange.File = req.file[c]
-			newChange.NumBlocks = req.file[c].NumBlocks
-			newChange.Operation = allocationchange.INSERT_OPERATION
-			newChange.Size = req.file[c].Size
-			newChange.File.Attributes = req.file[c].Attributes
-			commitReq.changes = append(commitReq.changes, newChange)
-		}
-
+		commitReq.changes = append(commitReq.changes, req.fileChange(file))
 		commitReq.connectionID = req.connectionID
 		commitReq.wg = wg
-		commitReqs[c] = commitReq
+		commitReqs[n] = commitReq
 		go AddCommitRequest(commitReq)
-		c++
+		n++
 	}
 	wg.Wait()
 
@@ -609,6 +671,7 @@ func (req *UploadRequest) processUpload(ctx context.Context, a *Allocation) {
 	if !req.isConsensusOk() {
 		if req.consensus != 0 {
 			Logger.Info("Commit consensus failed, Deleting remote file....")
+			req.journal.remove()
 			a.deleteFile(req.remotefilepath, req.consensus, req.consensus)
 		}
 		if req.statusCallback != nil {
@@ -617,6 +680,7 @@ func (req *UploadRequest) processUpload(ctx context.Context, a *Allocation) {
 		}
 	}
 
+	req.journal.remove()
 	if req.statusCallback != nil {
 		sizeInCallback := int64(float32(perShard) * req.consensus)
 		OpID := OpUpload
@@ -629,6 +693,301 @@ func (req *UploadRequest) processUpload(ctx context.Context, a *Allocation) {
 	return
 }
 
+// fileChange returns the allocation change which commits the uploaded file.
+func (req *UploadRequest) fileChange(file *fileref.FileRef) allocationchange.AllocationChange {
+	if req.isUpdate {
+		newChange := &allocationchange.UpdateFileChange{}
+		newChange.NewFile = file
+		newChange.NumBlocks = file.NumBlocks
+		newChange.Operation = allocationchange.UPDATE_OPERATION
+		newChange.Size = file.Size
+		newChange.NewFile.Attributes = file.Attributes
+		return newChange
+	}
+	newChange := &allocationchange.NewFileChange{}
+	newChange.File = file
+	newChange.NumBlocks = file.NumBlocks
+	newChange.Operation = allocationchange.INSERT_OPERATION
+	newChange.Size = file.Size
+	newChange.File.Attributes = file.Attributes
+	return newChange
+}
+
+// dirAttributes caches the attributes of the remote directories for the
+// uploads of a transfer, so the files of a directory don't list it each.
+type dirAttributes struct {
+	mu    sync.Mutex
+	attrs map[string]*dirAttributesEntry
+}
+
+type dirAttributesEntry struct {
+	once  sync.Once
+	attrs fileref.Attributes
+}
+
+func newDirAttributes() *dirAttributes {
+	return &dirAttributes{attrs: make(map[string]*dirAttributesEntry)}
+}
+
+// get returns the attributes of the directory, listed once by the first
+// upload asking for them.
+func (d *dirAttributes) get(a *Allocation, dir string) fileref.Attributes {
+	d.mu.Lock()
+	entry, ok := d.attrs[dir]
+	if !ok {
+		entry = &dirAttributesEntry{}
+		d.attrs[dir] = entry
+	}
+	d.mu.Unlock()
+	entry.once.Do(func() {
+		if ref := remoteFileRef(a, dir); ref != nil {
+			entry.attrs = ref.Attributes
+		}
+	})
+	return entry.attrs
+}
+
+// withDirAttributes shares the cache of the directory attributes between the
+// uploads of a transfer.
+func withDirAttributes(d *dirAttributes) UploadOption {
+	return func(req *UploadRequest) {
+		req.dirAttrs = d
+	}
+}
+
+// remoteFileRef returns the consensus ref of the remote path, nil if there's
+// none.
+func remoteFileRef(a *Allocation, remotePath string) *fileref.FileRef {
+	listReq := &ListRequest{}
+	listReq.allocationID = a.ID
+	listReq.allocationTx = a.Tx
+	listReq.blobbers = a.Blobbers
+	listReq.consensusThresh = (float32(a.DataShards) * 100) / float32(a.DataShards+a.ParityShards)
+	listReq.fullconsensus = float32(a.DataShards + a.ParityShards)
+	listReq.ctx = a.ctx
+	listReq.remotefilepath = remotePath
+	_, ref, _ := listReq.getFileConsensusFromBlobbers()
+	return ref
+}
+
+// applyRemoteAttributes applies the attributes kept by the blobbers before
+// the upload. An update of a locked file fails, a new file without attributes
+// of its own inherits the attributes of its directory.
+func (req *UploadRequest) applyRemoteAttributes(a *Allocation) error {
+	if req.isRepair || (!req.isUpdate && !req.filemeta.Attributes.IsZero()) {
+		return nil
+	}
+	if req.isUpdate {
+		ref := remoteFileRef(a, req.remotefilepath)
+		if ref == nil {
+			return nil
+		}
+		return checkUnlocked(ref)
+	}
+	dir := path.Dir(req.remotefilepath)
+	if req.dirAttrs != nil {
+		req.filemeta.Attributes = req.dirAttrs.get(a, dir)
+		return nil
+	}
+	// a new directory has nothing to inherit
+	if ref := remoteFileRef(a, dir); ref != nil {
+		req.filemeta.Attributes = ref.Attributes
+	}
+	return nil
+}
+
+// uploadToBlobbers sends the file to the blobbers in the request connection
+// without committing it. It returns the shard size, or false if the upload
+// has been stopped; the error is reported to the status callback then.
+func (req *UploadRequest) uploadToBlobbers(a *Allocation) (int64, bool) {
+	var source io.Reader
+	if req.reader != nil {
+		bufReader := bufio.NewReader(req.reader)
+		head, err := bufReader.Peek(261)
+		if err != nil && err != io.EOF {
+			if req.statusCallback != nil {
+				req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("read_failed", err.Error()))
+			}
+			return 0, false
+		}
+		req.filemeta.MimeType = zboxutil.GetContentType(head)
+		source = bufReader
+	} else {
+		var inFile *os.File
+		inFile, err := os.Open(req.filepath)
+		if err != nil {
+			if req.statusCallback != nil {
+				req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("open_file_failed", err.Error()))
+			}
+			return 0, false
+		}
+		defer inFile.Close()
+		mimetype, err := zboxutil.GetFileContentType(inFile)
+		if err != nil {
+			if req.statusCallback != nil {
+				req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("mime_type_error", err.Error()))
+			}
+			return 0, false
+		}
+		req.filemeta.MimeType = mimetype
+		source = inFile
+	}
+	if len(req.filemeta.Attributes.ContentType) > 0 {
+		req.filemeta.MimeType = req.filemeta.Attributes.ContentType
+	}
+	err := req.setupUpload(a)
+	if err != nil {
+		if req.statusCallback != nil {
+			req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("setup_upload_failed", err.Error()))
+		}
+		return 0, false
+	}
+	req.journal.save()
+	size := req.filemeta.Size
+	// Calculate number of bytes per shard.
+	perShard := (size + int64(a.DataShards) - 1) / int64(a.DataShards)
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+	if len(req.thumbnailpath) > 0 {
+		wg.Add(1)
+		go req.processThumbnail(a, wg)
+	}
+	// pushed is set once all the data is sent, the upload stops otherwise
+	pushed := false
+	go func() {
+		defer wg.Done()
+		chunkSizeWithHeader := int64(fileref.CHUNK_SIZE)
+		if req.isEncrypted {
+			chunkSizeWithHeader -= 16
+			chunkSizeWithHeader -= 2 * 1024
+		}
+		req.isUploadCanceled = false
+		if req.sizeUnknown {
+			if req.statusCallback != nil {
+				req.statusCallback.Started(a.ID, req.remotefilepath, OpUpload, -1)
+			}
+			if !req.pushStream(a, source, chunkSizeWithHeader) {
+				return
+			}
+			err = req.completePush()
+			if err != nil && req.statusCallback != nil {
+				req.statusCallback.Error(a.ID, req.remotefilepath, OpUpload, err)
+			}
+			pushed = err == nil
+			return
+		}
+		// Pad data to Shards*perShard.
+		padding := make([]byte, (int64(a.DataShards)*perShard)-size)
+		dataReader := io.MultiReader(source, bytes.NewBuffer(padding))
+		chunksPerShard := (perShard + chunkSizeWithHeader - 1) / chunkSizeWithHeader
+		Logger.Info("Size:", size, " perShard:", perShard, " chunks/shard:", chunksPerShard)
+		if req.statusCallback != nil {
+			req.statusCallback.Started(a.ID, req.remotefilepath, OpUpload, int(perShard)*(a.DataShards+a.ParityShards))
+		}
+
+		for ctr := int64(0); ctr < chunksPerShard; ctr++ {
+			remaining := int64(math.Min(float64(perShard-(ctr*chunkSizeWithHeader)), float64(chunkSizeWithHeader)))
+			b1 := make([]byte, remaining*int64(a.DataShards))
+			_, err = io.ReadFull(dataReader, b1)
+			if err != nil {
+				if req.statusCallback != nil {
+					req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("read_failed", err.Error()))
+				}
+				return
+			}
+			if req.checkForCancel(a) {
+				return
+			}
+			err = req.pushData(b1)
+			if err != nil {
+				if req.statusCallback != nil {
+					req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("push_error", err.Error()))
+				}
+				return
+			}
+
+		}
+		err = req.completePush()
+		if err != nil {
+			if req.statusCallback != nil {
+				req.statusCallback.Error(a.ID, req.remotefilepath, OpUpload, err)
+			}
+			return
+		}
+		pushed = true
+	}()
+	wg.Wait()
+	if req.sizeUnknown {
+		perShard = (req.filemeta.Size + int64(a.DataShards) - 1) / int64(a.DataShards)
+	}
+	Logger.Info("Completed the upload. Submitting for commit")
+
+	for _, ch := range req.uploadDataCh {
+		close(ch)
+	}
+
+	for _, ch := range req.uploadThumbCh {
+		close(ch)
+	}
+	Logger.Info("Closed all the channels. Submitting for commit")
+	return perShard, pushed
+}
+
+// pushStream reads the source chunk by chunk till EOF and pushes every chunk
+// to the blobbers. The last chunk may be short, it is padded only up to a
+// multiple of the data shards. It returns false if the upload has failed or
+// was canceled, the status callback has been notified in this case.
+func (req *UploadRequest) pushStream(a *Allocation, source io.Reader, chunkSizeWithHeader int64) bool {
+	var size int64
+	for {
+		b1 := make([]byte, chunkSizeWithHeader*int64(a.DataShards))
+		n, err := io.ReadFull(source, b1)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && err != io.ErrUnexpectedEOF {
+			if req.statusCallback != nil {
+				req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("read_failed", err.Error()))
+			}
+			return false
+		}
+		if req.checkForCancel(a) {
+			return false
+		}
+		size += int64(n)
+		req.remaining += int64(n)
+		perShard := (int64(n) + int64(a.DataShards) - 1) / int64(a.DataShards)
+		err = req.pushData(b1[:perShard*int64(a.DataShards)])
+		if err != nil {
+			if req.statusCallback != nil {
+				req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("push_error", err.Error()))
+			}
+			return false
+		}
+		if n < len(b1) {
+			break
+		}
+	}
+	req.filemeta.Size = size
+	Logger.Info("Stream size:", size)
+	return true
+}
+
+func (req *UploadRequest) checkForCancel(a *Allocation) bool {
+	if !req.isUploadCanceled {
+		return false
+	}
+	req.isUploadCanceled = false
+	req.journal.remove()
+	if !req.isUpdate && !req.isRepair {
+		go a.DeleteFile(req.remotefilepath)
+	}
+	if req.statusCallback != nil {
+		req.statusCallback.Error(a.ID, req.filepath, OpUpload, errors.New("user_aborted", "Upload aborted by user"))
+	}
+	return true
+}
+
 func (req *UploadRequest) IsFullConsensusSupported() bool {
 	var maxBlobbers = req.GetMaxBlobbersSupported()
 
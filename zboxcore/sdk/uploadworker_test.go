@@ -1,7 +1,23 @@
 package sdk
 
 import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
 	"testing"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
 )
 
 func TestMaxBlobbersRequiredGreaterThanImplicitLimit128(t *testing.T) {
@@ -62,4 +78,188 @@ func TestNumBlobbersRequiredZero(t *testing.T) {
 	if !req.IsFullConsensusSupported() {
 		t.Errorf("IsFullConsensusSupported() = %v, want %v", false, true)
 	}
-}
\ No newline at end of file
+}
+
+func TestUploadRequest_pushStream(t *testing.T) {
+	const (
+		dataShards   = 2
+		parityShards = 1
+	)
+	tests := []struct {
+		name       string
+		size       int
+		wantChunks []int
+	}{
+		{
+			name:       "Test_Empty_Stream",
+			size:       0,
+			wantChunks: []int{},
+		},
+		{
+			name:       "Test_Single_Short_Chunk",
+			size:       101,
+			wantChunks: []int{51},
+		},
+		{
+			name:       "Test_Full_Chunks_Only",
+			size:       2 * fileref.CHUNK_SIZE * dataShards,
+			wantChunks: []int{fileref.CHUNK_SIZE, fileref.CHUNK_SIZE},
+		},
+		{
+			name:       "Test_Final_Short_Chunk",
+			size:       fileref.CHUNK_SIZE*dataShards + 10,
+			wantChunks: []int{fileref.CHUNK_SIZE, 5},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			a := &Allocation{DataShards: dataShards, ParityShards: parityShards}
+			req := &UploadRequest{
+				datashards:   dataShards,
+				parityshards: parityShards,
+				sizeUnknown:  true,
+				isRepair:     true,
+				filemeta:     &UploadFileMeta{},
+			}
+			req.setUploadMask(dataShards + parityShards)
+			req.uploadDataCh = make([]chan []byte, dataShards+parityShards)
+			for i := range req.uploadDataCh {
+				req.uploadDataCh[i] = make(chan []byte, len(tt.wantChunks))
+			}
+
+			content := bytes.Repeat([]byte{1}, tt.size)
+			require.True(req.pushStream(a, bytes.NewReader(content), fileref.CHUNK_SIZE))
+			require.EqualValues(tt.size, req.filemeta.Size)
+			require.EqualValues(0, req.remaining)
+			for _, ch := range req.uploadDataCh {
+				require.Len(ch, len(tt.wantChunks))
+				for _, want := range tt.wantChunks {
+					require.Len(<-ch, want)
+				}
+			}
+		})
+	}
+}
+
+func TestUploadRequest_applyRemoteAttributes(t *testing.T) {
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	dirAttrs := fileref.Attributes{ContentType: "text/plain", Locked: true}
+	tests := []struct {
+		name       string
+		isUpdate   bool
+		attrs      fileref.Attributes
+		remoteRef  *fileref.FileRef
+		wantAttrs  fileref.Attributes
+		wantErrMsg string
+	}{
+		{
+			name:      "Test_Dir_Attributes_Inherited",
+			remoteRef: &fileref.FileRef{Ref: fileref.Ref{Type: fileref.DIRECTORY}, Attributes: dirAttrs},
+			wantAttrs: dirAttrs,
+		},
+		{
+			name:      "Test_Own_Attributes_Kept",
+			attrs:     fileref.Attributes{ContentDisposition: "attachment"},
+			remoteRef: &fileref.FileRef{Ref: fileref.Ref{Type: fileref.DIRECTORY}, Attributes: dirAttrs},
+			wantAttrs: fileref.Attributes{ContentDisposition: "attachment"},
+		},
+		{
+			name: "Test_New_Dir_Nothing_Inherited",
+		},
+		{
+			name:      "Test_Update_Unlocked_Success",
+			isUpdate:  true,
+			remoteRef: &fileref.FileRef{Ref: fileref.Ref{Type: fileref.FILE}},
+		},
+		{
+			name:       "Test_Update_Locked_Failed",
+			isUpdate:   true,
+			remoteRef:  &fileref.FileRef{Ref: fileref.Ref{Type: fileref.FILE, Path: "/d/1.txt"}, Attributes: dirAttrs},
+			wantErrMsg: "file_locked: /d/1.txt is locked by its attributes",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			require := require.New(t)
+			mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+				return strings.HasPrefix(req.URL.Path, tt.name) &&
+					strings.Contains(req.URL.Path, zboxutil.FILE_META_ENDPOINT)
+			})).Return(func(*http.Request) *http.Response {
+				if tt.remoteRef == nil {
+					return &http.Response{
+						StatusCode: http.StatusBadRequest,
+						Body:       ioutil.NopCloser(strings.NewReader("not found")),
+					}
+				}
+				body, err := json.Marshal(tt.remoteRef)
+				require.NoError(err)
+				return &http.Response{
+					StatusCode: http.StatusOK,
+					Body:       ioutil.NopCloser(bytes.NewReader(body)),
+				}
+			}, nil)
+
+			a := &Allocation{DataShards: 2, ParityShards: 2}
+			setupMockAllocation(t, a)
+			for i := 0; i < numBlobbers; i++ {
+				a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+					ID:      mockBlobberId + strconv.Itoa(i),
+					Baseurl: tt.name + mockBlobberUrl + strconv.Itoa(i),
+				})
+			}
+			req := &UploadRequest{
+				remotefilepath: "/d/1.txt",
+				isUpdate:       tt.isUpdate,
+				filemeta:       &UploadFileMeta{Attributes: tt.attrs},
+			}
+			err := req.applyRemoteAttributes(a)
+			if tt.wantErrMsg != "" {
+				require.Error(err)
+				require.EqualValues(tt.wantErrMsg, errors.Top(err))
+				return
+			}
+			require.NoError(err)
+			require.EqualValues(tt.wantAttrs, req.filemeta.Attributes)
+		})
+	}
+}
+
+type failingReader struct{}
+
+func (failingReader) Read(p []byte) (int, error) {
+	return 0, errors.New("read_failed", "mock read failure")
+}
+
+func TestUploadRequest_uploadToBlobbers_Failed_Source(t *testing.T) {
+	a := &Allocation{DataShards: 2, ParityShards: 2}
+	tests := []struct {
+		name string
+		req  *UploadRequest
+	}{
+		{
+			name: "Test_Reader_Failed",
+			req:  &UploadRequest{reader: failingReader{}, filemeta: &UploadFileMeta{}},
+		},
+		{
+			name: "Test_Missing_File_Failed",
+			req:  &UploadRequest{filepath: "missing.txt", filemeta: &UploadFileMeta{}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// without a status callback the upload stops all the same
+			_, ok := tt.req.uploadToBlobbers(a)
+			require.False(t, ok)
+		})
+	}
+}
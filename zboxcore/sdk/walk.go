@@ -0,0 +1,241 @@
+package sdk
+
+import (
+	"path"
+	"path/filepath"
+	"time"
+
+	"github.com/0chain/errors"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+)
+
+// walkWorkers is the number of directories listed at once by Walk.
+const walkWorkers = 8
+
+// SkipDir is returned by a WalkFunc to skip a directory. Returned for a file,
+// it skips the remaining entries of the directory of the file.
+var SkipDir = filepath.SkipDir
+
+// WalkFunc is called by Walk for every entry of the tree, the root included.
+// The entry is nil when the root can't be listed, and err is the error of the
+// listing when the root or a directory can't be listed. A non nil error other
+// than SkipDir stops the walk, Walk then returns it.
+type WalkFunc func(remotePath string, entry *ListResult, err error) error
+
+// walkListing is the listing of a directory fetched ahead of its walk.
+type walkListing struct {
+	done chan struct{}
+	dir  *ListResult
+	err  error
+}
+
+// Walk walks the remote tree at the root, calling fn for every file and
+// directory in it. The entries of a directory are visited in the order of
+// the blobbers, before the content of its subdirectories, which are then
+// walked one after the other. The listings of the subdirectories are fetched
+// concurrently ahead of their walk.
+func (a *Allocation) Walk(root string, fn WalkFunc) error {
+	if !a.isInitialized() {
+		return notInitialized
+	}
+	if len(root) == 0 {
+		return errors.New("invalid_path", "Invalid path for the walk")
+	}
+	root = zboxutil.RemoteClean(root)
+	if !zboxutil.IsRemoteAbs(root) {
+		return errors.New("invalid_path", "Path should be valid and absolute")
+	}
+
+	dir, err := a.listDirAll(root)
+	if err == nil && dir.Type != fileref.DIRECTORY {
+		err = errors.New("invalid_path", "Path should be an existing directory")
+	}
+	if err != nil {
+		return fn(root, nil, err)
+	}
+	return a.walkRoot(root, dir, fn)
+}
+
+// walkRoot walks the tree of the root directory listed already.
+func (a *Allocation) walkRoot(root string, dir *ListResult, fn WalkFunc) error {
+	err := fn(root, dir, nil)
+	if err != nil {
+		if err == SkipDir {
+			return nil
+		}
+		return err
+	}
+	err = a.walkDir(dir, fn, make(chan struct{}, walkWorkers))
+	if err == SkipDir {
+		return nil
+	}
+	return err
+}
+
+func (a *Allocation) walkDir(dir *ListResult, fn WalkFunc, sem chan struct{}) error {
+	var subdirs []*ListResult
+	for _, child := range dir.Children {
+		err := fn(child.Path, child, nil)
+		if err == SkipDir {
+			if child.Type == fileref.DIRECTORY {
+				continue
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if child.Type == fileref.DIRECTORY {
+			subdirs = append(subdirs, child)
+		}
+	}
+
+	listings := make([]*walkListing, len(subdirs))
+	fetch := func(i int) {
+		listing := &walkListing{done: make(chan struct{})}
+		listings[i] = listing
+		sem <- struct{}{}
+		go func(dirPath string) {
+			defer func() { <-sem }()
+			defer close(listing.done)
+			listing.dir, listing.err = a.listDirAll(dirPath)
+		}(subdirs[i].Path)
+	}
+	// the listings ahead are left to finish when the walk stops
+	for i := 0; i < len(subdirs) && i < walkWorkers; i++ {
+		fetch(i)
+	}
+	for i, sub := range subdirs {
+		if next := i + walkWorkers; next < len(subdirs) {
+			fetch(next)
+		}
+		listing := listings[i]
+		<-listing.done
+		if listing.err != nil {
+			err := fn(sub.Path, sub, listing.err)
+			if err != nil && err != SkipDir {
+				return err
+			}
+			continue
+		}
+		err := a.walkDir(listing.dir, fn, sem)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FindQuery selects the entries returned by Find. The zero fields match all
+// the entries.
+type FindQuery struct {
+	// Name is a path.Match pattern matched against the name of the entries.
+	Name string
+	// MimeType is a path.Match pattern matched against the mime type of the
+	// files, like "image/*".
+	MimeType string
+	// Type is fileref.FILE or fileref.DIRECTORY.
+	Type string
+	// MinSize and MaxSize bound the actual size of the files, a zero MaxSize
+	// doesn't bound it.
+	MinSize int64
+	MaxSize int64
+	// CreatedAfter, CreatedBefore, UpdatedAfter and UpdatedBefore bound the
+	// times of the entries.
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	UpdatedAfter  time.Time
+	UpdatedBefore time.Time
+	// Attributes matches the attributes of the entries.
+	Attributes func(attrs fileref.Attributes) bool
+	// Limit is the maximum number of entries found, zero finds all of them.
+	Limit int
+}
+
+func (q *FindQuery) validate() error {
+	if _, err := path.Match(q.Name, ""); err != nil {
+		return errors.Wrap(err, "invalid name pattern")
+	}
+	if _, err := path.Match(q.MimeType, ""); err != nil {
+		return errors.Wrap(err, "invalid mime type pattern")
+	}
+	if len(q.Type) > 0 && q.Type != fileref.FILE && q.Type != fileref.DIRECTORY {
+		return errors.New("invalid_type", "Type should be a file or a directory")
+	}
+	return nil
+}
+
+// matchTime tells whether the value is in the bounds, the zero bounds don't
+// bound it.
+func matchTime(value string, after, before time.Time) bool {
+	if after.IsZero() && before.IsZero() {
+		return true
+	}
+	t, ok := parseListTime(value)
+	if !ok {
+		return false
+	}
+	return (after.IsZero() || t.After(after)) && (before.IsZero() || t.Before(before))
+}
+
+func (q *FindQuery) match(lr *ListResult) bool {
+	if len(q.Name) > 0 {
+		if ok, _ := path.Match(q.Name, lr.Name); !ok {
+			return false
+		}
+	}
+	if len(q.MimeType) > 0 {
+		if ok, _ := path.Match(q.MimeType, lr.MimeType); !ok {
+			return false
+		}
+	}
+	if len(q.Type) > 0 && lr.Type != q.Type {
+		return false
+	}
+	if lr.ActualSize < q.MinSize || (q.MaxSize > 0 && lr.ActualSize > q.MaxSize) {
+		return false
+	}
+	if !matchTime(lr.CreatedAt, q.CreatedAfter, q.CreatedBefore) ||
+		!matchTime(lr.UpdatedAt, q.UpdatedAfter, q.UpdatedBefore) {
+		return false
+	}
+	if q.Attributes != nil && !q.Attributes(lr.Attributes) {
+		return false
+	}
+	return true
+}
+
+// errFindLimit stops the walk of Find once the limit is reached.
+var errFindLimit = errors.New("find_limit", "Find limit reached")
+
+// Find walks the remote tree at the root and returns the entries matching
+// the query, in the order of Walk. The root itself isn't returned. A nil
+// query finds all the entries.
+func (a *Allocation) Find(root string, query *FindQuery) ([]*ListResult, error) {
+	if query == nil {
+		query = &FindQuery{}
+	}
+	if err := query.validate(); err != nil {
+		return nil, err
+	}
+	root = zboxutil.RemoteClean(root)
+	found := make([]*ListResult, 0)
+	err := a.Walk(root, func(remotePath string, entry *ListResult, err error) error {
+		if err != nil {
+			return err
+		}
+		if remotePath == root || !query.match(entry) {
+			return nil
+		}
+		found = append(found, entry)
+		if query.Limit > 0 && len(found) >= query.Limit {
+			return errFindLimit
+		}
+		return nil
+	})
+	if err != nil && err != errFindLimit {
+		return nil, err
+	}
+	return found, nil
+}
@@ -0,0 +1,165 @@
+package sdk
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/0chain/gosdk/core/zcncrypto"
+	"github.com/0chain/gosdk/zboxcore/blockchain"
+	zclient "github.com/0chain/gosdk/zboxcore/client"
+	"github.com/0chain/gosdk/zboxcore/fileref"
+	"github.com/0chain/gosdk/zboxcore/mocks"
+	"github.com/0chain/gosdk/zboxcore/zboxutil"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAllocation_Walk(t *testing.T) {
+	var mockClient = mocks.HttpClient{}
+	zboxutil.Client = &mockClient
+
+	client := zclient.GetClient()
+	client.Wallet = &zcncrypto.Wallet{
+		ClientID:  mockClientId,
+		ClientKey: mockClientKey,
+	}
+
+	tree := map[string][]string{
+		"/":    {"a", "b", "1.txt"},
+		"/a":   {"x", "2.png"},
+		"/a/x": {"3.txt"},
+		"/b":   {},
+	}
+	listings := make(map[string][]byte)
+	for dir, names := range tree {
+		var entities []map[string]interface{}
+		for i, name := range names {
+			entity := map[string]interface{}{
+				"name":        name,
+				"path":        zboxutil.Join(dir, name),
+				"lookup_hash": strconv.Itoa(i),
+				"type":        fileref.DIRECTORY,
+			}
+			if strings.Contains(name, ".") {
+				entity["type"] = fileref.FILE
+				entity["actual_file_size"] = (i + 1) * 10
+				entity["actual_file_hash"] = name
+				entity["mimetype"] = "text/plain"
+			}
+			entities = append(entities, entity)
+		}
+		body, err := json.Marshal(&fileref.ListResult{
+			Meta:     map[string]interface{}{"type": fileref.DIRECTORY, "path": dir, "name": dir},
+			Entities: entities,
+		})
+		require.NoError(t, err)
+		listings[fileref.GetReferenceLookup("", dir)] = body
+	}
+
+	mockClient.On("Do", mock.MatchedBy(func(req *http.Request) bool {
+		return strings.HasPrefix(req.URL.Path, t.Name()) &&
+			strings.Contains(req.URL.Path, zboxutil.LIST_ENDPOINT)
+	})).Return(func(req *http.Request) *http.Response {
+		body, ok := listings[req.URL.Query().Get("path_hash")]
+		if !ok {
+			return &http.Response{
+				StatusCode: http.StatusBadRequest,
+				Body:       ioutil.NopCloser(bytes.NewReader(nil)),
+			}
+		}
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(bytes.NewReader(body)),
+		}
+	}, nil)
+
+	a := &Allocation{DataShards: 2, ParityShards: 2}
+	setupMockAllocation(t, a)
+	for i := 0; i < numBlobbers; i++ {
+		a.Blobbers = append(a.Blobbers, &blockchain.StorageNode{
+			ID:      mockBlobberId + strconv.Itoa(i),
+			Baseurl: t.Name() + mockBlobberUrl + strconv.Itoa(i),
+		})
+	}
+
+	t.Run("Test_Walk_Order", func(t *testing.T) {
+		var visited []string
+		err := a.Walk("/", func(remotePath string, entry *ListResult, err error) error {
+			require.NoError(t, err)
+			visited = append(visited, remotePath)
+			return nil
+		})
+		require.NoError(t, err)
+		require.EqualValues(t, []string{
+			"/", "/a", "/b", "/1.txt", "/a/x", "/a/2.png", "/a/x/3.txt",
+		}, visited)
+	})
+
+	t.Run("Test_Walk_Skip_Dir", func(t *testing.T) {
+		var visited []string
+		err := a.Walk("/", func(remotePath string, entry *ListResult, err error) error {
+			visited = append(visited, remotePath)
+			if remotePath == "/a/x" || remotePath == "/1.txt" {
+				return SkipDir
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		require.EqualValues(t, []string{"/", "/a", "/b", "/1.txt", "/a/x", "/a/2.png"}, visited)
+	})
+
+	t.Run("Test_Walk_Missing_Root", func(t *testing.T) {
+		err := a.Walk("/missing", func(remotePath string, entry *ListResult, err error) error {
+			require.Nil(t, entry)
+			return err
+		})
+		require.Error(t, err)
+	})
+
+	t.Run("Test_Find", func(t *testing.T) {
+		tests := []struct {
+			name  string
+			query *FindQuery
+			want  []string
+		}{
+			{
+				name: "Test_All",
+				want: []string{"/a", "/b", "/1.txt", "/a/x", "/a/2.png", "/a/x/3.txt"},
+			},
+			{
+				name:  "Test_Name_Glob",
+				query: &FindQuery{Name: "*.txt"},
+				want:  []string{"/1.txt", "/a/x/3.txt"},
+			},
+			{
+				name:  "Test_Size",
+				query: &FindQuery{Type: fileref.FILE, MinSize: 15},
+				want:  []string{"/1.txt", "/a/2.png"},
+			},
+			{
+				name:  "Test_Limit",
+				query: &FindQuery{Type: fileref.DIRECTORY, Limit: 2},
+				want:  []string{"/a", "/b"},
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				found, err := a.Find("/", tt.query)
+				require.NoError(t, err)
+				var paths []string
+				for _, entry := range found {
+					paths = append(paths, entry.Path)
+				}
+				require.EqualValues(t, tt.want, paths)
+			})
+		}
+
+		_, err := a.Find("/", &FindQuery{Name: "["})
+		require.Error(t, err)
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"net/http"
 	"net/url"
 	"os"
+	"strconv"
 	"time"
 
 	"github.com/0chain/errors"
@@ -41,6 +42,7 @@ const (
 	ALLOCATION_ENDPOINT      = "/allocation"
 	UPLOAD_ENDPOINT          = "/v1/file/upload/"
 	ATTRS_ENDPOINT           = "/v1/file/attributes/"
+	CUSTOM_META_ENDPOINT     = "/v1/file/custommeta/" // not served by the released blobbers yet
 	RENAME_ENDPOINT          = "/v1/file/rename/"
 	COPY_ENDPOINT            = "/v1/file/copy/"
 	LIST_ENDPOINT            = "/v1/file/list/"
@@ -175,6 +177,27 @@ func NewCommitRequest(baseUrl, allocation string, body io.Reader) (*http.Request
 	return req, nil
 }
 
+func NewConnectionRequest(baseUrl, allocation, connectionID string) (*http.Request, error) {
+	nurl, err := url.Parse(baseUrl)
+	if err != nil {
+		return nil, err
+	}
+	nurl.Path += CONNECTION_ENDPOINT + allocation
+	params := url.Values{}
+	params.Add("connection_id", connectionID)
+	nurl.RawQuery = params.Encode() // Escape Query Parameters
+	req, err := http.NewRequest(http.MethodGet, nurl.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setClientInfoWithSign(req, allocation); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
 func NewReferencePathRequest(baseUrl, allocation string, paths []string) (*http.Request, error) {
 	nurl, err := url.Parse(baseUrl)
 	if err != nil {
@@ -356,6 +379,20 @@ func NewListRequest(baseUrl, allocation string, path string, auth_token string)
 	return req, nil
 }
 
+// NewListPageRequest is the NewListRequest for the limit entries of the
+// directory from the offset on.
+func NewListPageRequest(baseUrl, allocation string, path string, auth_token string, offset, limit int) (*http.Request, error) {
+	req, err := NewListRequest(baseUrl, allocation, path, auth_token)
+	if err != nil {
+		return nil, err
+	}
+	params := req.URL.Query()
+	params.Add("offset", strconv.Itoa(offset))
+	params.Add("limit", strconv.Itoa(limit))
+	req.URL.RawQuery = params.Encode()
+	return req, nil
+}
+
 func NewUploadRequest(baseUrl, allocation string, body io.Reader, update bool) (*http.Request, error) {
 	url := fmt.Sprintf("%s%s%s", baseUrl, UPLOAD_ENDPOINT, allocation)
 	var req *http.Request
@@ -376,6 +413,22 @@ func NewUploadRequest(baseUrl, allocation string, body io.Reader, update bool) (
 	return req, nil
 }
 
+func NewCustomMetaRequest(baseUrl, allocation string, body io.Reader) (
+	req *http.Request, err error) {
+
+	var url = fmt.Sprintf("%s%s%s", baseUrl, CUSTOM_META_ENDPOINT, allocation)
+	req, err = http.NewRequest(http.MethodPost, url, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := setClientInfoWithSign(req, allocation); err != nil {
+		return nil, err
+	}
+
+	return req, nil
+}
+
 func NewAttributesRequest(baseUrl, allocation string, body io.Reader) (
 	req *http.Request, err error) {
 
@@ -66,12 +66,17 @@ func GetFileContentType(out *os.File) (string, error) {
 		return "", err
 	}
 
-	kind, _ := filetype.Match(buffer)
+	return GetContentType(buffer), nil
+}
+
+// GetContentType detects the mime type from the leading bytes of a content.
+func GetContentType(head []byte) string {
+	kind, _ := filetype.Match(head)
 	if kind == filetype.Unknown {
-		return "application/octet-stream", nil
+		return "application/octet-stream"
 	}
 
-	return kind.MIME.Value, nil
+	return kind.MIME.Value
 }
 
 func GetFullRemotePath(localPath, remotePath string) string {